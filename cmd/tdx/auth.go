@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+func runAuth(args []string) error {
+	if len(args) == 0 || args[0] != "init" {
+		fmt.Fprintln(os.Stderr, "Usage: tdx auth init [flags]")
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			return flag.ErrHelp
+		}
+		return errors.New("unknown auth command, want init")
+	}
+	return runAuthInit(args[1:])
+}
+
+func runAuthInit(args []string) error {
+	fs := flag.NewFlagSet("auth init", flag.ContinueOnError)
+	file := fs.String("file", defaultCredentialFile(), "credential file to write")
+	keyring := fs.Bool("keyring", false, "store the credentials in the OS keyring instead of a file")
+	appID := fs.String("app-id", "", "TDX client ID (asked for if not given)")
+	verify := fs.Bool("verify", true, "check the credentials by fetching a token before saving them")
+	force := fs.Bool("force", false, "overwrite an existing credential file without asking")
+	timeout := fs.Duration("timeout", 30*time.Second, "token request timeout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx auth init [flags]")
+		fmt.Fprintln(fs.Output(), "Asks for a TDX client ID and secret, from the API key page of the TDX member")
+		fmt.Fprintln(fs.Output(), "center, checks them and saves them where other tdx commands find them.")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		fs.Usage()
+		return errors.New("auth init takes no arguments")
+	}
+	if !*keyring && *file == "" {
+		return errors.New("no config directory for the credential file, set --file")
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	if !*keyring && !*force {
+		if _, err := os.Stat(*file); err == nil {
+			answer, err := promptLine(in, fmt.Sprintf("%s exists, overwrite it? [y/N] ", *file))
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+				return errors.New("credential file left unchanged")
+			}
+		}
+	}
+	credential := tdxproxy.Credential{AppID: *appID}
+	for credential.AppID == "" {
+		if credential.AppID, err = promptLine(in, "Client ID: "); err != nil {
+			return err
+		}
+	}
+	for credential.AppKey == "" {
+		if credential.AppKey, err = promptSecret(in, "Client secret: "); err != nil {
+			return err
+		}
+	}
+
+	if *verify {
+		fmt.Fprint(os.Stderr, "Checking the credentials... ")
+		if err := verifyCredential(credential, *timeout); err != nil {
+			fmt.Fprintln(os.Stderr, "failed")
+			return fmt.Errorf("TDX did not accept the credentials: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "ok")
+	}
+
+	if *keyring {
+		data, err := json.Marshal(credential)
+		if err != nil {
+			return err
+		}
+		if err := keyringSet(data); err != nil {
+			return err
+		}
+		if err := markKeyring(); err != nil {
+			return fmt.Errorf("failed to record that the credentials are in the keyring: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "Saved the credentials in the OS keyring.")
+		return nil
+	}
+	data, err := json.MarshalIndent(credential, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeCredentialFile(*file, append(data, '\n')); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Saved the credentials to %s.\n", *file)
+	if *file != defaultCredentialFile() {
+		fmt.Fprintf(os.Stderr, "Pass --credentials %s or set TDX_CREDENTIALS_FILE to use them.\n", *file)
+	}
+	return nil
+}
+
+// verifyCredential fetches a token with credential.
+func verifyCredential(credential tdxproxy.Credential, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return tdxproxy.NewTDXProxy(credential.AppID, credential.AppKey, logger).RefreshToken(ctx)
+}
+
+// writeCredentialFile writes data readable by the user only, replacing the
+// file atomically so that a failed write leaves the old one in place.
+func writeCredentialFile(name string, data []byte) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func promptLine(in *bufio.Reader, text string) (string, error) {
+	fmt.Fprint(os.Stderr, text)
+	line, err := in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return "", errors.New("input ended before setup was done")
+		}
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// promptSecret reads a line without echoing it when stdin is a terminal
+// that stty can configure.
+func promptSecret(in *bufio.Reader, text string) (string, error) {
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	return promptLine(in, text)
+}
+
+func stty(setting string) error {
+	cmd := exec.Command("stty", setting)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+func runCompletion(args []string) error {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx completion bash|zsh|fish")
+		fmt.Fprintln(fs.Output(), "Prints a completion script for the shell. For example, add to ~/.bashrc:")
+		fmt.Fprintln(fs.Output(), "  source <(tdx completion bash)")
+		fmt.Fprintln(fs.Output(), "or run once:")
+		fmt.Fprintln(fs.Output(), "  tdx completion fish > ~/.config/fish/completions/tdx.fish")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("completion needs a shell")
+	}
+	script, ok := completionScripts[positional[0]]
+	if !ok {
+		return fmt.Errorf("unknown shell %q, want bash, zsh or fish", positional[0])
+	}
+	_, err = io.WriteString(os.Stdout, script)
+	return err
+}
+
+// The scripts ask tdx itself for candidates: "tdx __complete <words>" prints
+// the candidates for the last word, which may be empty. Candidates ending in
+// "/" are partial paths, completed without a trailing space.
+var completionScripts = map[string]string{
+	"bash": `_tdx() {
+	local IFS=$'\n'
+	COMPREPLY=($(tdx __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+		compopt -o nospace
+	fi
+}
+complete -o default -F _tdx tdx
+`,
+	"zsh": `#compdef tdx
+_tdx() {
+	local -a candidates paths
+	candidates=("${(@f)$(tdx __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	candidates=(${candidates:#})
+	if (( ${#candidates} == 0 )); then
+		_files
+		return
+	fi
+	paths=(${(M)candidates:#*/})
+	candidates=(${candidates:#*/})
+	compadd -S '' -- $paths
+	compadd -- $candidates
+}
+compdef _tdx tdx
+`,
+	"fish": `function __tdx_complete
+	set -l words (commandline -opc)
+	tdx __complete $words[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c tdx -f -a '(__tdx_complete)'
+`,
+}
+
+// valueFlags maps the flags completed from a fixed set of values to them.
+var valueFlags = map[string][]string{
+	"output": {"table", "json", "yaml"},
+}
+
+// pathFlags lists the flags taking a TDX path.
+var pathFlags = map[string]bool{
+	"watch": true,
+}
+
+// complete prints the completion candidates for the last of words, the
+// arguments after "tdx" on the command line.
+func complete(w io.Writer, words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	var flagName string
+	if len(words) > 2 {
+		flagName = strings.TrimLeft(words[len(words)-2], "-")
+	}
+	var candidates []string
+	switch {
+	case len(words) == 1:
+		for name := range commands {
+			candidates = append(candidates, name)
+		}
+	case pathFlags[flagName]:
+		candidates = completePath(current)
+	case valueFlags[flagName] != nil:
+		candidates = valueFlags[flagName]
+	case strings.HasPrefix(current, "-"):
+	case words[0] == "get":
+		candidates = completePath(current)
+	case words[0] == "auth" && len(words) == 2:
+		candidates = []string{"init"}
+	case words[0] == "completion":
+		candidates = []string{"bash", "zsh", "fish"}
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		fmt.Fprintln(w, match)
+	}
+}
+
+// completePath completes a TDX path from the endpoint catalog one segment at
+// a time, so that "v2/B" offers "v2/Bike/" and "v2/Bus/" rather than every
+// path below them. Placeholders with known values are expanded; a path ends
+// at its first other placeholder.
+func completePath(prefix string) []string {
+	seen := map[string]bool{}
+	var candidates []string
+	for _, endpoint := range tdxproxy.Endpoints {
+		for _, path := range expandKnown(endpoint.Path) {
+			if !strings.HasPrefix(path, prefix) {
+				continue
+			}
+			if i := strings.IndexByte(path[len(prefix):], '/'); i >= 0 {
+				path = path[:len(prefix)+i+1]
+			}
+			if !seen[path] {
+				seen[path] = true
+				candidates = append(candidates, path)
+			}
+		}
+	}
+	return candidates
+}
+
+// expandKnown returns the paths a catalog path expands to, cut before its
+// first placeholder without known values.
+func expandKnown(path string) []string {
+	start := strings.IndexByte(path, '{')
+	if start < 0 {
+		return []string{path}
+	}
+	end := strings.IndexByte(path[start:], '}')
+	if end < 0 {
+		return []string{path}
+	}
+	values, ok := tdxproxy.PlaceholderValues[path[start+1:start+end]]
+	if !ok {
+		return []string{path[:start]}
+	}
+	var paths []string
+	for _, value := range values {
+		paths = append(paths, expandKnown(path[:start]+value+path[start+end+1:])...)
+	}
+	return paths
+}
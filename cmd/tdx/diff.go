@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	key := fs.String("key", "", "record field identifying a record, e.g. StopUID")
+	dir := fs.String("dir", "", "snapshot store directory; lets snapshots be given as name@version")
+	out := addOutputFlags(fs, "json")
+	out.addColumnsFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx diff <snapA> <snapB> --key <field> [--dir <store>]")
+		fmt.Fprintln(fs.Output(), "A snapshot is a file path, or name@version (version 0 for the latest) with --dir.")
+		fmt.Fprintln(fs.Output(), "Table output lists one change per line; --columns adds fields of the new record,")
+		fmt.Fprintln(fs.Output(), "or of the old one for removed records.")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 || *key == "" {
+		fs.Usage()
+		return errors.New("diff needs two snapshots and --key")
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+
+	before, err := loadSnapshot(*dir, positional[0])
+	if err != nil {
+		return err
+	}
+	after, err := loadSnapshot(*dir, positional[1])
+	if err != nil {
+		return err
+	}
+	diff, err := tdxproxy.DiffRecords(before.Records, after.Records, *key)
+	if err != nil {
+		return err
+	}
+
+	out.infof("%d added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+	return out.emit(diff, func(w io.Writer) error {
+		return writeDiffTable(out, w, diff, *key)
+	})
+}
+
+// writeDiffTable lists the changes of diff with the record key, the top-level
+// fields that changed, and the columns selected with --columns.
+func writeDiffTable(out *output, w io.Writer, diff *tdxproxy.SnapshotDiff, key string) error {
+	columns := append([]string{"change", key, "fields"}, splitColumns(out.columns)...)
+	var rows []json.RawMessage
+	addRow := func(change string, record json.RawMessage, fields []string) error {
+		var row map[string]any
+		if err := json.Unmarshal(record, &row); err != nil {
+			return err
+		}
+		row["change"], row["fields"] = change, strings.Join(fields, ",")
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, data)
+		return nil
+	}
+	for _, record := range diff.Added {
+		if err := addRow("added", record, nil); err != nil {
+			return err
+		}
+	}
+	for _, record := range diff.Removed {
+		if err := addRow("removed", record, nil); err != nil {
+			return err
+		}
+	}
+	for _, c := range diff.Changed {
+		fields, err := changedFields(c.Old, c.New)
+		if err != nil {
+			return err
+		}
+		if err := addRow("changed", c.New, fields); err != nil {
+			return err
+		}
+	}
+	return out.writeTable(w, columns, rows)
+}
+
+// changedFields returns the sorted names of the top-level fields that differ
+// between two records.
+func changedFields(before, after json.RawMessage) ([]string, error) {
+	var oldFields, newFields map[string]json.RawMessage
+	if err := json.Unmarshal(before, &oldFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &newFields); err != nil {
+		return nil, err
+	}
+	var fields []string
+	for name, value := range newFields {
+		if !jsonEqual(oldFields[name], value) {
+			fields = append(fields, name)
+		}
+	}
+	for name := range oldFields {
+		if _, ok := newFields[name]; !ok {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// loadSnapshot loads a snapshot from a file, or from the store in dir when
+// given as name@version.
+func loadSnapshot(dir, arg string) (*tdxproxy.Snapshot, error) {
+	if name, version, ok := strings.Cut(arg, "@"); ok && dir != "" {
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot version in %q", arg)
+		}
+		return tdxproxy.NewSnapshotStore(dir).Load(name, v)
+	}
+	return tdxproxy.LoadSnapshotFile(arg)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+func runGet(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	credentials := fs.String("credentials", "", "credential file (default $TDX_CREDENTIALS_FILE, then the credentials saved by tdx auth init, or no auth)")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout")
+	filter := fs.String("filter", "", "OData $filter expression")
+	top := fs.Int("top", 0, "return at most this many records (0 for all)")
+	interactive := fs.Bool("i", false, "pick the path from the endpoint catalog interactively")
+	dryRun := fs.Bool("dry-run", false, "print the resolved request, with the token redacted, instead of sending it")
+	var params stringList
+	fs.Var(&params, "param", "query parameter as name=value, e.g. $orderby=StopUID (repeatable)")
+	out := addOutputFlags(fs, "table")
+	out.addColumnsFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx get <path> [flags]")
+		fmt.Fprintln(fs.Output(), "       tdx get -i [flags]")
+		fmt.Fprintln(fs.Output(), "Fetches the records of a TDX path, e.g. v2/Bus/Stop/City/Taipei.")
+		fmt.Fprintln(fs.Output(), "With -i, search the endpoint catalog and pick the path instead.")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *interactive && len(positional) != 0 || !*interactive && len(positional) != 1 {
+		fs.Usage()
+		return errors.New("get needs one TDX path, or -i")
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+	if *interactive {
+		path, err := newPicker(os.Stdin, os.Stderr).pickEndpoint()
+		if err != nil {
+			return err
+		}
+		out.infof("tdx get %s\n", path)
+		positional = []string{path}
+	}
+
+	query := map[string]string{"$format": "JSON"}
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --param %q, want name=value", param)
+		}
+		query[name] = tdxproxy.EscapeParam(value)
+	}
+	if *filter != "" {
+		if err := tdxproxy.ValidateFilter(*filter); err != nil {
+			return err
+		}
+		query["$filter"] = tdxproxy.EscapeParam(*filter)
+	}
+	if *top > 0 {
+		query["$top"] = strconv.Itoa(*top)
+	}
+
+	level := slog.LevelWarn
+	if out.quiet {
+		level = slog.LevelError
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	proxy, err := newProxy(*credentials, logger)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		proxy.SetDryRun(os.Stdout)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	resp, err := proxy.GetContext(ctx, strings.TrimPrefix(positional[0], "/"), query, nil, *timeout)
+	if errors.Is(err, tdxproxy.ErrDryRun) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	records, err := tdxproxy.DecodeRecords(body)
+	if err != nil {
+		return err
+	}
+
+	out.infof("%d records\n", len(records))
+	return out.emitRecords(records)
+}
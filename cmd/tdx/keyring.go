@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The OS keyring is reached through its command-line tool, security on macOS
+// and secret-tool (libsecret) on Linux, so tdx needs no cgo. The entry holds
+// a credential file's JSON.
+const (
+	keyringService = "tdx"
+	keyringAccount = "credentials"
+)
+
+var errNoKeyring = errors.New("no supported keyring: tdx uses security on macOS and secret-tool on Linux")
+
+// keyringSet stores secret, which must be a single line, in the OS keyring,
+// replacing any earlier entry.
+func keyringSet(secret []byte) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// security -i reads the command from stdin, which keeps the secret
+		// off the command line where other processes could see it. -U
+		// updates an existing entry.
+		if bytes.ContainsAny(secret, "\r\n") {
+			return errors.New("the keyring secret must be a single line")
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader("add-generic-password -U -s " + keyringService + " -a " + keyringAccount + " -w " + securityQuote(secret) + "\n")
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=TDX credentials", "service", keyringService, "account", keyringAccount)
+		cmd.Stdin = bytes.NewReader(secret)
+	default:
+		return errNoKeyring
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return errNoKeyring
+		}
+		return fmt.Errorf("failed to store credentials in the keyring: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// securityQuote quotes s as one word of a security -i command line.
+func securityQuote(s []byte) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(string(s)) + `"`
+}
+
+// keyringMarker returns the file that tdx auth init creates when it stores
+// credentials in the keyring, so that other commands query the keyring only
+// then, or "" if the user has no config directory.
+func keyringMarker() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tdx", "keyring")
+}
+
+// keyringConfigured reports whether credentials were stored in the keyring.
+func keyringConfigured() bool {
+	marker := keyringMarker()
+	if marker == "" {
+		return false
+	}
+	_, err := os.Stat(marker)
+	return err == nil
+}
+
+// markKeyring creates the keyring marker.
+func markKeyring() error {
+	marker := keyringMarker()
+	if marker == "" {
+		return errors.New("no config directory to record that the credentials are in the keyring")
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(marker, nil, 0o600)
+}
+
+// keyringGet returns the secret stored by keyringSet, or an error if there
+// is none or no keyring.
+func keyringGet() ([]byte, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount)
+	default:
+		return nil, errNoKeyring
+	}
+	secret, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	if secret = bytes.TrimSpace(secret); len(secret) == 0 {
+		return nil, errors.New("no credentials in the keyring")
+	}
+	return secret, nil
+}
@@ -0,0 +1,83 @@
+// Command tdx is a command-line client for the TDX platform built on tdxproxy.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"auth":       {usage: "auth init [flags]                   set up and save TDX credentials", run: runAuth},
+	"completion": {usage: "completion bash|zsh|fish            print a shell completion script", run: runCompletion},
+	"diff":       {usage: "diff <snapA> <snapB> --key <field>  compare two dataset snapshots", run: runDiff},
+	"get":        {usage: "get <path> [flags]                  fetch the records of a TDX path", run: runGet},
+	"replay":     {usage: "replay <log> [flags]                replay recorded requests against a gateway", run: runReplay},
+	"run":        {usage: "run <jobs.yaml>                     run a declarative fetch pipeline", run: runRun},
+	"serve":      {usage: "serve [flags]                       run the HTTP gateway", run: runServe},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	if os.Args[1] == "__complete" {
+		complete(os.Stdout, os.Args[2:])
+		return
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "tdx: unknown command %q\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "tdx:", err)
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: tdx <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+}
+
+// parseArgs parses flags that may appear before, between or after positional
+// arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// output renders a command's result as a table for people, or as JSON or
+// YAML for scripts, and decides what else the command may print.
+type output struct {
+	format  string
+	columns string
+	quiet   bool
+	w       io.Writer
+}
+
+// addOutputFlags registers the --output and --quiet flags on fs.
+func addOutputFlags(fs *flag.FlagSet, format string) *output {
+	o := &output{w: os.Stdout}
+	fs.StringVar(&o.format, "output", format, "output format: table, json or yaml")
+	fs.BoolVar(&o.quiet, "quiet", false, "print the result only: no summaries, progress or table header")
+	return o
+}
+
+// addColumnsFlag registers the --columns flag for commands printing records.
+func (o *output) addColumnsFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.columns, "columns", "", "comma-separated fields shown in table output, e.g. StopUID,StopName.En (default: the fields of the first record)")
+}
+
+func (o *output) validate() error {
+	switch o.format {
+	case "table", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, want table, json or yaml", o.format)
+}
+
+// infof prints a summary or progress line to stderr, unless quiet.
+func (o *output) infof(format string, args ...any) {
+	if !o.quiet {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// emit writes value as JSON or YAML, or calls table in table mode.
+func (o *output) emit(value any, table func(w io.Writer) error) error {
+	switch o.format {
+	case "json":
+		encoder := json.NewEncoder(o.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		return writeYAML(o.w, value)
+	}
+	return table(o.w)
+}
+
+// emitRecords writes records, showing the selected columns in table mode.
+func (o *output) emitRecords(records []json.RawMessage) error {
+	return o.emit(records, func(w io.Writer) error {
+		columns := splitColumns(o.columns)
+		if len(columns) == 0 && len(records) > 0 {
+			columns = objectKeys(records[0])
+		}
+		return o.writeTable(w, columns, records)
+	})
+}
+
+// writeTable writes one row per record, with a cell per column. A column
+// names a field, or a nested field as a dotted path such as StopName.En.
+func (o *output) writeTable(w io.Writer, columns []string, records []json.RawMessage) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if !o.quiet {
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	}
+	for i, record := range records {
+		decoder := json.NewDecoder(bytes.NewReader(record))
+		decoder.UseNumber()
+		var fields any
+		if err := decoder.Decode(&fields); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		cells := make([]string, len(columns))
+		for j, column := range columns {
+			cells[j] = tableCell(lookupField(fields, column))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func splitColumns(columns string) []string {
+	var names []string
+	for _, name := range strings.Split(columns, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// lookupField returns the value at a dotted path in a decoded JSON value, or
+// nil if there is none.
+func lookupField(value any, path string) any {
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// tableCell formats a value for a table cell: scalars as they are and nested
+// values as compact JSON, on one line.
+func tableCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(v)
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// objectKeys returns the keys of a JSON object in document order.
+func objectKeys(record json.RawMessage) []string {
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, token.(string))
+		var skip json.RawMessage
+		if err := decoder.Decode(&skip); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// writeYAML writes value as block-style YAML, keeping the field names and
+// order of its JSON encoding.
+func writeYAML(w io.Writer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle clears the flow and quoting styles the YAML parser records for
+// JSON input, so the encoder chooses its own.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+// pickerShown is the number of matches the picker lists at a time.
+const pickerShown = 10
+
+// picker lets the user choose from lists by typing fuzzy search terms and
+// then the number of a match. It reads lines, so it needs no terminal modes.
+type picker struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func newPicker(in io.Reader, out io.Writer) *picker {
+	return &picker{in: bufio.NewScanner(in), out: out}
+}
+
+// pickEndpoint asks for a catalog endpoint and the values of its
+// placeholders, and returns the resolved path.
+func (p *picker) pickEndpoint() (string, error) {
+	labels := make([]string, len(tdxproxy.Endpoints))
+	for i, endpoint := range tdxproxy.Endpoints {
+		labels[i] = fmt.Sprintf("%-55s %s", endpoint.Path, endpoint.Description)
+	}
+	i, err := p.pick("endpoint", labels)
+	if err != nil {
+		return "", err
+	}
+	endpoint := tdxproxy.Endpoints[i]
+	values := map[string]string{}
+	for _, name := range endpoint.Placeholders() {
+		if known := tdxproxy.PlaceholderValues[name]; known != nil {
+			j, err := p.pick(name, known)
+			if err != nil {
+				return "", err
+			}
+			values[name] = known[j]
+			continue
+		}
+		value, err := p.prompt(name + ": ")
+		if err != nil {
+			return "", err
+		}
+		values[name] = url.PathEscape(value)
+	}
+	return endpoint.Expand(values), nil
+}
+
+// pick returns the index of the label the user chooses. An empty line
+// chooses the best match.
+func (p *picker) pick(what string, labels []string) (int, error) {
+	matches := fuzzyMatch("", labels)
+	for {
+		for n, i := range matches[:min(len(matches), pickerShown)] {
+			fmt.Fprintf(p.out, "%3d  %s\n", n+1, labels[i])
+		}
+		if len(matches) > pickerShown {
+			fmt.Fprintf(p.out, "     ... %d more, type to narrow down\n", len(matches)-pickerShown)
+		}
+		line, err := p.prompt(what + "> ")
+		if err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= min(len(matches), pickerShown) {
+			return matches[n-1], nil
+		}
+		if line == "" && len(matches) > 0 {
+			return matches[0], nil
+		}
+		if found := fuzzyMatch(line, labels); len(found) > 0 {
+			matches = found
+		} else {
+			fmt.Fprintf(p.out, "no %s matches %q\n", what, line)
+		}
+	}
+}
+
+func (p *picker) prompt(text string) (string, error) {
+	fmt.Fprint(p.out, text)
+	if !p.in.Scan() {
+		if err := p.in.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("no endpoint picked")
+	}
+	return strings.TrimSpace(p.in.Text()), nil
+}
+
+// fuzzyMatch returns the indexes of the labels matching every term of query,
+// best match first. A term matches when its letters appear in the label in
+// order, case-insensitively; matches with fewer letters in between rank
+// higher.
+func fuzzyMatch(query string, labels []string) []int {
+	terms := strings.Fields(strings.ToLower(query))
+	scores := map[int]int{}
+	var matches []int
+	for i, label := range labels {
+		label = strings.ToLower(label)
+		total := 0
+		for _, term := range terms {
+			score, ok := fuzzyScore(label, term)
+			if !ok {
+				total = -1
+				break
+			}
+			total += score
+		}
+		if total >= 0 {
+			scores[i] = total
+			matches = append(matches, i)
+		}
+	}
+	sort.SliceStable(matches, func(a, b int) bool { return scores[matches[a]] < scores[matches[b]] })
+	return matches
+}
+
+// fuzzyScore reports whether term is a subsequence of label, and the number
+// of label bytes skipped between its first and last matched letters.
+func fuzzyScore(label, term string) (int, bool) {
+	start := strings.IndexByte(label, term[0])
+	if start < 0 {
+		return 0, false
+	}
+	pos, gaps := start+1, 0
+	for k := 1; k < len(term); k++ {
+		next := strings.IndexByte(label[pos:], term[k])
+		if next < 0 {
+			return 0, false
+		}
+		gaps += next
+		pos += next + 1
+	}
+	return gaps, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+// newProxy creates a proxy from a credential file, falling back to the
+// TDX_CREDENTIALS_FILE environment variable, then to the credentials saved by
+// tdx auth init, and then to unauthenticated access.
+func newProxy(credentialFile string, logger *slog.Logger) (*tdxproxy.TDXProxy, error) {
+	if credentialFile != "" || os.Getenv("TDX_CREDENTIALS_FILE") != "" {
+		return tdxproxy.NewTDXProxyFromCredentialFile(credentialFile, logger)
+	}
+	if file := defaultCredentialFile(); file != "" {
+		if _, err := os.Stat(file); err == nil {
+			return tdxproxy.NewTDXProxyFromCredentialFile(file, logger)
+		}
+	}
+	if keyringConfigured() {
+		secret, err := keyringGet()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials from the keyring: %w", err)
+		}
+		credentials, err := tdxproxy.ParseCredentials(secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credentials in the keyring: %w", err)
+		}
+		proxy := tdxproxy.NewTDXProxyNoAuth(logger)
+		proxy.SetCredentials(credentials...)
+		return proxy, nil
+	}
+	return tdxproxy.NewTDXProxyNoAuth(logger), nil
+}
+
+// defaultCredentialFile returns where tdx auth init saves credentials by
+// default, or "" if the user has no config directory.
+func defaultCredentialFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tdx", "credentials.json")
+}
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+var _ flag.Value = (*stringList)(nil)
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
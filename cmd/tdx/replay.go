@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replayRequest is a recorded request: when it was sent, relative to the first
+// one, and its TDX path with query.
+type replayRequest struct {
+	offset time.Duration
+	path   string
+}
+
+type replayResult struct {
+	status  int
+	latency time.Duration
+	cached  bool
+	err     error
+}
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "http://localhost:8080", "gateway base URL")
+	speed := fs.Float64("speed", 1, "replay speed relative to the recording; 0 sends as fast as possible")
+	concurrency := fs.Int("concurrency", 64, "maximum requests in flight")
+	out := addOutputFlags(fs, "table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx replay <log> [flags]")
+		fmt.Fprintln(fs.Output(), "Replays the GET requests of a HAR capture, or of a text log with one")
+		fmt.Fprintln(fs.Output(), "\"[<RFC 3339 time>] <path>\" per line, against a gateway and reports")
+		fmt.Fprintln(fs.Output(), "status codes, latency and the share of responses served from its cache.")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("replay needs one request log")
+	}
+	if *speed < 0 || *concurrency < 1 {
+		return errors.New("speed must not be negative and concurrency must be positive")
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+
+	requests, err := loadReplayLog(positional[0])
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		return errors.New("request log has no GET requests")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out.infof("replaying %d requests against %s\n", len(requests), *target)
+	start := time.Now()
+	results := replay(ctx, strings.TrimSuffix(*target, "/"), requests, *speed, *concurrency)
+	report := newReplayReport(results, time.Since(start))
+	return out.emit(report, func(w io.Writer) error {
+		printReplayReport(w, report)
+		return nil
+	})
+}
+
+// replay sends the requests on their recorded schedule, scaled by speed.
+func replay(ctx context.Context, target string, requests []replayRequest, speed float64, concurrency int) []replayResult {
+	client := &http.Client{Timeout: time.Minute}
+	results := make([]replayResult, len(requests))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i, req := range requests {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(req.offset) / speed))
+			select {
+			case <-ctx.Done():
+				return results[:i]
+			case <-time.After(time.Until(due)):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return results[:i]
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = replayOne(ctx, client, target+"/"+path)
+		}(i, req.path)
+	}
+	wg.Wait()
+	return results
+}
+
+func replayOne(ctx context.Context, client *http.Client, target string) replayResult {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return replayResult{err: err}
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return replayResult{err: err, latency: time.Since(start)}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return replayResult{
+		status:  resp.StatusCode,
+		latency: time.Since(start),
+		// The proxy sets Age on responses served from its cache.
+		cached: resp.Header.Get("Age") != "",
+	}
+}
+
+// replayReport summarizes a replay. Durations are in milliseconds.
+type replayReport struct {
+	Requests  int            `json:"requests"`
+	ElapsedMS float64        `json:"elapsed_ms"`
+	Rate      float64        `json:"rate"`
+	Errors    int            `json:"errors"`
+	Statuses  map[string]int `json:"statuses"`
+	CacheHits int            `json:"cache_hits"`
+	// CacheHitRatio is the share of answered requests served from the cache.
+	CacheHitRatio float64 `json:"cache_hit_ratio"`
+	LatencyMS     struct {
+		P50 float64 `json:"p50"`
+		P95 float64 `json:"p95"`
+		P99 float64 `json:"p99"`
+		Max float64 `json:"max"`
+	} `json:"latency_ms"`
+}
+
+func newReplayReport(results []replayResult, elapsed time.Duration) replayReport {
+	report := replayReport{
+		Requests:  len(results),
+		ElapsedMS: milliseconds(elapsed),
+		Rate:      float64(len(results)) / elapsed.Seconds(),
+		Statuses:  map[string]int{},
+	}
+	var latencies []time.Duration
+	for _, r := range results {
+		if r.err != nil {
+			report.Errors++
+			continue
+		}
+		report.Statuses[strconv.Itoa(r.status)]++
+		latencies = append(latencies, r.latency)
+		if r.cached {
+			report.CacheHits++
+		}
+	}
+	if answered := len(results) - report.Errors; answered > 0 {
+		report.CacheHitRatio = float64(report.CacheHits) / float64(answered)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) float64 {
+		if len(latencies) == 0 {
+			return 0
+		}
+		return milliseconds(latencies[int(p*float64(len(latencies)-1))])
+	}
+	report.LatencyMS.P50 = percentile(0.5)
+	report.LatencyMS.P95 = percentile(0.95)
+	report.LatencyMS.P99 = percentile(0.99)
+	report.LatencyMS.Max = percentile(1)
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func printReplayReport(w io.Writer, report replayReport) {
+	ms := func(v float64) time.Duration { return time.Duration(v * float64(time.Millisecond)) }
+	fmt.Fprintf(w, "requests:   %d in %s (%.1f/s)\n", report.Requests, ms(report.ElapsedMS).Round(time.Millisecond), report.Rate)
+	fmt.Fprintf(w, "errors:     %d\n", report.Errors)
+	codes := make([]string, 0, len(report.Statuses))
+	for code := range report.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "status %s: %d\n", code, report.Statuses[code])
+	}
+	if report.Requests > report.Errors {
+		fmt.Fprintf(w, "cache hits: %d (%.1f%%)\n", report.CacheHits, 100*report.CacheHitRatio)
+	}
+	fmt.Fprintf(w, "latency:    p50 %s, p95 %s, p99 %s, max %s\n",
+		ms(report.LatencyMS.P50), ms(report.LatencyMS.P95), ms(report.LatencyMS.P99), ms(report.LatencyMS.Max))
+}
+
+// loadReplayLog reads a HAR file or a text request log.
+func loadReplayLog(path string) ([]replayRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseHARLog(data)
+	}
+	return parseTextLog(data)
+}
+
+func parseHARLog(data []byte) ([]replayRequest, error) {
+	var har struct {
+		Log struct {
+			Entries []struct {
+				StartedDateTime time.Time `json:"startedDateTime"`
+				Request         struct {
+					Method string `json:"method"`
+					URL    string `json:"url"`
+				} `json:"request"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR: %w", err)
+	}
+	var requests []replayRequest
+	var first time.Time
+	for _, entry := range har.Log.Entries {
+		if entry.Request.Method != http.MethodGet {
+			continue
+		}
+		path, ok := tdxPath(entry.Request.URL)
+		if !ok {
+			continue
+		}
+		if first.IsZero() {
+			first = entry.StartedDateTime
+		}
+		requests = append(requests, replayRequest{offset: entry.StartedDateTime.Sub(first), path: path})
+	}
+	return sortReplay(requests), nil
+}
+
+func parseTextLog(data []byte) ([]replayRequest, error) {
+	var requests []replayRequest
+	var first time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var offset time.Duration
+		if len(fields) > 1 {
+			t, err := time.Parse(time.RFC3339Nano, fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if first.IsZero() {
+				first = t
+			}
+			offset = t.Sub(first)
+			fields = fields[1:]
+		}
+		path, ok := tdxPath(fields[0])
+		if !ok {
+			return nil, fmt.Errorf("line %d: not a TDX path: %s", line, fields[0])
+		}
+		requests = append(requests, replayRequest{offset: offset, path: path})
+	}
+	return sortReplay(requests), scanner.Err()
+}
+
+// tdxPath turns a recorded URL into the path the gateway serves: absolute TDX
+// URLs lose their base, and paths their leading slash. Auth requests are skipped.
+func tdxPath(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	path := u.Path
+	if u.IsAbs() {
+		_, rest, ok := strings.Cut(path, "/api/basic/")
+		if !ok {
+			return "", false
+		}
+		path = rest
+	}
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", false
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path, true
+}
+
+func sortReplay(requests []replayRequest) []replayRequest {
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].offset < requests[j].offset })
+	return requests
+}
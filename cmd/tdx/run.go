@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/chihsuanwu/tdxproxy/pipeline"
+)
+
+func runRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx run <jobs.yaml>")
+		fmt.Fprintln(fs.Output(), "Runs the jobs of a pipeline spec. Scheduled jobs repeat until interrupted.")
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return errors.New("run needs one spec file")
+	}
+
+	spec, err := pipeline.Load(positional[0])
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return pipeline.Run(ctx, spec)
+}
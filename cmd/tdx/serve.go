@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	credentials := fs.String("credentials", "", "credential file (default $TDX_CREDENTIALS_FILE, then the credentials saved by tdx auth init, or no auth)")
+	timeout := fs.Duration("timeout", 10*time.Second, "upstream request timeout")
+	cacheTTL := fs.Duration("cache-ttl", 0, "cache responses for this long (0 disables the cache)")
+	negativeTTL := fs.Duration("negative-cache-ttl", 0, "cache 404 and empty responses for this long (0 disables negative caching)")
+	interval := fs.Duration("interval", 30*time.Second, "polling interval of watched endpoints")
+	stateDir := fs.String("state-dir", "", "keep the state of watched endpoints in this directory, so restarts resend no unchanged content")
+	drainTimeout := fs.Duration("drain-timeout", 30*time.Second, "how long to wait for in-flight requests on shutdown")
+	signingKey := fs.String("signing-key-file", "", "require requests signed with the HMAC secret in this file")
+	keysFile := fs.String("keys", "", "require API keys, stored with their usage in this file")
+	adminToken := fs.String("admin-token-file", "", "enable the /admin routes with the bearer token in this file")
+	debugBuffer := fs.Int("debug-buffer", 0, "keep the last N upstream exchanges for GET /admin/recent (0 disables)")
+	accessLog := fs.String("access-log", "", "write an access log to this file, or - for stderr")
+	accessSample := fs.Float64("access-log-sample", 1, "fraction of successful requests to log (errors are always logged)")
+	accessMaxSize := fs.Int64("access-log-max-size", 100, "rotate the access log file at this many MiB (0 disables rotation)")
+	accessBackups := fs.Int("access-log-backups", 5, "number of rotated access log files to keep")
+	configFile := fs.String("config", "", "YAML file of settings applied live: rate limit, cache, credentials, routes")
+	statsdAddr := fs.String("statsd", "", "push metrics to the StatsD server at this host:port")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "push metrics to this OTLP/HTTP endpoint, e.g. http://localhost:4318/v1/metrics")
+	metricsInterval := fs.Duration("metrics-interval", 10*time.Second, "interval between metrics pushes")
+	warmUp := fs.Bool("warm-up", false, "fetch auth tokens before listening and exit if the credentials are rejected")
+	corsMaxAge := fs.Duration("cors-max-age", 10*time.Minute, "how long browsers may cache CORS preflight responses")
+	var corsOrigins stringList
+	fs.Var(&corsOrigins, "cors-origin", "allow browser requests from this origin, or * for any (repeatable)")
+	var watch stringList
+	fs.Var(&watch, "watch", "TDX path to poll and expose under /stream/<path> (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tdx serve [flags]")
+		fs.PrintDefaults()
+	}
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	proxy, err := newProxy(*credentials, logger)
+	if err != nil {
+		return err
+	}
+	if *cacheTTL > 0 && *configFile == "" {
+		proxy.SetCache(tdxproxy.NewMemoryCache(), *cacheTTL)
+	}
+	proxy.SetNegativeCacheTTL(*negativeTTL)
+	proxy.SetDebugBuffer(*debugBuffer, 0)
+
+	gateway := tdxproxy.NewGateway(proxy, *timeout)
+	if *signingKey != "" {
+		secret, err := os.ReadFile(*signingKey)
+		if err != nil {
+			return fmt.Errorf("failed to read signing key: %w", err)
+		}
+		gateway.RequireSignature(bytes.TrimSpace(secret), 0)
+	}
+	switch *accessLog {
+	case "":
+	case "-":
+		gateway.SetAccessLog(slog.New(slog.NewJSONHandler(os.Stderr, nil)), *accessSample)
+	default:
+		file, err := tdxproxy.OpenRotatingFile(*accessLog, *accessMaxSize<<20, *accessBackups)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		gateway.SetAccessLog(slog.New(slog.NewJSONHandler(file, nil)), *accessSample)
+	}
+	if *configFile != "" {
+		reloader := newConfigReloader(*configFile, proxy, gateway, *cacheTTL, *negativeTTL, logger)
+		if err := reloader.Reload(ctx); err != nil {
+			return err
+		}
+		gateway.SetReloadFunc(reloader.Reload)
+		go reloader.watch(ctx)
+	}
+	if *warmUp {
+		warmCtx, cancel := context.WithTimeout(ctx, *timeout)
+		err := proxy.WarmUp(warmCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to fetch auth token: %w", err)
+		}
+	}
+	if len(corsOrigins) > 0 {
+		gateway.SetCORS(&tdxproxy.CORSConfig{AllowedOrigins: corsOrigins, MaxAge: *corsMaxAge})
+	}
+	var keys *tdxproxy.KeyStore
+	if *keysFile != "" {
+		keys, err = tdxproxy.OpenKeyStore(*keysFile)
+		if err != nil {
+			return err
+		}
+		gateway.SetKeyStore(keys)
+		go saveKeysPeriodically(ctx, keys, logger)
+	}
+	if *adminToken != "" {
+		token, err := os.ReadFile(*adminToken)
+		if err != nil {
+			return fmt.Errorf("failed to read admin token: %w", err)
+		}
+		gateway.SetAdminToken(string(bytes.TrimSpace(token)))
+	}
+	var background sync.WaitGroup
+	if len(watch) > 0 {
+		watcher := tdxproxy.NewWatcher(proxy, *interval)
+		for _, path := range watch {
+			watcher.Watch(strings.TrimPrefix(path, "/"), nil)
+		}
+		if *stateDir != "" {
+			store, err := tdxproxy.NewFileStateStore(*stateDir)
+			if err != nil {
+				return err
+			}
+			watcher.SetStateStore(store, "watcher")
+		}
+		gateway.SetWatcher(watcher)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			watcher.Run(ctx)
+		}()
+	}
+	var exporters []tdxproxy.MetricsExporter
+	if *statsdAddr != "" {
+		exporter, err := tdxproxy.NewStatsDExporter(*statsdAddr, "")
+		if err != nil {
+			return err
+		}
+		defer exporter.Close()
+		exporters = append(exporters, exporter)
+	}
+	if *otlpEndpoint != "" {
+		exporters = append(exporters, tdxproxy.NewOTLPExporter(*otlpEndpoint, "tdx-gateway"))
+	}
+	for _, exporter := range exporters {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			proxy.PushMetrics(ctx, exporter, *metricsInterval)
+		}()
+	}
+
+	server := &http.Server{Addr: *addr, Handler: gateway}
+	server.RegisterOnShutdown(gateway.Drain)
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Gateway listening", slog.String("addr", *addr))
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// A second signal kills the process instead of waiting for the drain.
+	stop()
+	logger.Info("Shutting down, draining requests", slog.Duration("timeout", *drainTimeout))
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+	shutdownErr := server.Shutdown(drainCtx)
+	if shutdownErr != nil {
+		logger.Warn("Requests still in flight at drain deadline", slog.String("error", shutdownErr.Error()))
+	}
+	background.Wait()
+
+	var errs []error
+	if keys != nil {
+		if err := keys.Save(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save API key usage: %w", err))
+		}
+	}
+	if err := proxy.FlushCache(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush cache: %w", err))
+	}
+	logger.Info("Gateway stopped")
+	return errors.Join(errs...)
+}
+
+// saveKeysPeriodically persists API key usage, which is otherwise only written
+// when keys are issued or revoked.
+func saveKeysPeriodically(ctx context.Context, keys *tdxproxy.KeyStore, logger *slog.Logger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := keys.Save(); err != nil {
+				logger.Error("Failed to save API key usage", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	pathpkg "path"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+	"gopkg.in/yaml.v3"
+)
+
+// configPollInterval is how often the config and credential files are checked for changes.
+const configPollInterval = 2 * time.Second
+
+// serveConfig is the part of the gateway configuration that can change while
+// it runs, read from the YAML file given with -config:
+//
+//	rate_limit: 5           # outbound TDX requests per second, 0 for no limit
+//	burst: 10
+//	credentials: tdx.json   # credential file, overrides -credentials
+//	cache:
+//	  ttl: 5m               # overrides -cache-ttl
+//	  negative_ttl: 30s     # overrides -negative-cache-ttl
+//	  endpoints:            # cache only these paths; empty caches all
+//	    - v2/Bus/Route/City/*
+//	headers:                # request headers forwarded to TDX
+//	  allow: [If-None-Match, If-Modified-Since, X-Request-ID]
+//	routes:                 # response transforms
+//	  - path: v2/Bus/Stop/City/*
+//	    lang: en
+//	    geojson: true
+//	    select: [StopUID, StopName]
+type serveConfig struct {
+	RateLimit   float64 `yaml:"rate_limit"`
+	Burst       int     `yaml:"burst"`
+	Credentials string  `yaml:"credentials"`
+	Cache       struct {
+		TTL         *time.Duration `yaml:"ttl"`
+		NegativeTTL *time.Duration `yaml:"negative_ttl"`
+		Endpoints   []string       `yaml:"endpoints"`
+	} `yaml:"cache"`
+	Headers tdxproxy.HeaderPolicy    `yaml:"headers"`
+	Routes  []tdxproxy.TransformRule `yaml:"routes"`
+}
+
+func loadServeConfig(path string) (*serveConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config serveConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s:\n%w", path, err)
+	}
+	return &config, nil
+}
+
+// validate checks every setting and returns the problems found, all at once.
+func (config *serveConfig) validate() error {
+	var errs []error
+	if config.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit: %g is negative; use 0 for no limit", config.RateLimit))
+	}
+	if config.Burst < 0 {
+		errs = append(errs, fmt.Errorf("burst: %d is negative", config.Burst))
+	}
+	if config.Cache.TTL != nil && *config.Cache.TTL < 0 {
+		errs = append(errs, fmt.Errorf("cache.ttl: %s is negative; use 0 to disable the cache", *config.Cache.TTL))
+	}
+	if config.Cache.NegativeTTL != nil && *config.Cache.NegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("cache.negative_ttl: %s is negative; use 0 to disable negative caching", *config.Cache.NegativeTTL))
+	}
+	if config.Credentials != "" {
+		if _, err := tdxproxy.LoadCredentials(config.Credentials); err != nil {
+			errs = append(errs, fmt.Errorf("credentials: %s: %w", config.Credentials, err))
+		}
+	}
+	for i, rule := range config.Routes {
+		if _, err := pathpkg.Match(rule.Path, ""); err != nil || rule.Path == "" {
+			errs = append(errs, fmt.Errorf("routes[%d]: invalid path pattern %q", i, rule.Path))
+		}
+	}
+	for i, pattern := range config.Cache.Endpoints {
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("cache.endpoints[%d]: invalid pattern %q", i, pattern))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// configReloader applies the config file to a running gateway. The cache and
+// rate limiter are kept across reloads, so changing a setting does not start
+// from a cold cache, and credentials are only replaced when they changed.
+type configReloader struct {
+	path        string
+	proxy       *tdxproxy.TDXProxy
+	gateway     *tdxproxy.Gateway
+	cache       *tdxproxy.MemoryCache
+	limiter     *tdxproxy.TokenBucket
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+	logger      *slog.Logger
+
+	mu          sync.Mutex
+	modTimes    map[string]time.Time
+	credentials []tdxproxy.Credential
+}
+
+func newConfigReloader(path string, proxy *tdxproxy.TDXProxy, gateway *tdxproxy.Gateway, cacheTTL, negativeTTL time.Duration, logger *slog.Logger) *configReloader {
+	c := &configReloader{
+		path:        path,
+		proxy:       proxy,
+		gateway:     gateway,
+		cache:       tdxproxy.NewMemoryCache(),
+		limiter:     tdxproxy.NewTokenBucket(0, 1),
+		cacheTTL:    cacheTTL,
+		negativeTTL: negativeTTL,
+		logger:      logger,
+		modTimes:    make(map[string]time.Time),
+	}
+	proxy.SetRateLimiter(c.limiter)
+	return c
+}
+
+// Reload reads the config file and applies it. An invalid file leaves the
+// running configuration unchanged.
+func (c *configReloader) Reload(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Recorded before parsing so a broken file is reported once, not on every poll.
+	c.modTimes[c.path] = modTime(c.path)
+	config, err := loadServeConfig(c.path)
+	if err != nil {
+		return err
+	}
+	var credentials []tdxproxy.Credential
+	if config.Credentials != "" {
+		if credentials, err = tdxproxy.LoadCredentials(config.Credentials); err != nil {
+			return fmt.Errorf("failed to load credentials: %w", err)
+		}
+		c.modTimes[config.Credentials] = modTime(config.Credentials)
+	}
+
+	c.limiter.SetRate(config.RateLimit, config.Burst)
+	ttl := c.cacheTTL
+	if config.Cache.TTL != nil {
+		ttl = *config.Cache.TTL
+	}
+	if ttl > 0 {
+		c.proxy.SetCache(c.cache, ttl)
+	} else {
+		c.proxy.SetCache(nil, 0)
+	}
+	negativeTTL := c.negativeTTL
+	if config.Cache.NegativeTTL != nil {
+		negativeTTL = *config.Cache.NegativeTTL
+	}
+	c.proxy.SetNegativeCacheTTL(negativeTTL)
+	c.gateway.SetCachedPaths(config.Cache.Endpoints)
+	c.gateway.SetTransforms(config.Routes)
+	c.gateway.SetHeaderPolicy(config.Headers)
+	if credentials != nil && !slices.Equal(credentials, c.credentials) {
+		c.proxy.SetCredentials(credentials...)
+		c.logger.Info("Credentials replaced", slog.Int("count", len(credentials)))
+	}
+	c.credentials = credentials
+
+	c.logger.Info("Configuration loaded", slog.String("file", c.path))
+	return nil
+}
+
+// watch reloads the configuration on SIGHUP and when the config or
+// credential file changes, until ctx is done.
+func (c *configReloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+		}
+		if err := c.Reload(ctx); err != nil {
+			c.logger.Error("Failed to reload configuration", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (c *configReloader) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path, seen := range c.modTimes {
+		if !modTime(path).Equal(seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
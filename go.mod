@@ -1,3 +1,5 @@
 module github.com/chihsuanwu/tdxproxy
 
 go 1.23.2
+
+require gopkg.in/yaml.v3 v3.0.1
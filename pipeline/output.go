@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+// newSink creates the sink for a job's output. The built-in output types are
+// handled here; any other type is opened from the tdxproxy sink registry.
+func newSink(job *Job) (tdxproxy.Sink, error) {
+	switch job.Output.Type {
+	case "", "stdout":
+		return &writerSink{w: os.Stdout, format: job.Format}, nil
+	case "file":
+		return &fileSink{name: job.Name, path: job.Output.Path, format: job.Format}, nil
+	case "snapshot":
+		return &snapshotSink{name: job.Name, store: tdxproxy.NewSnapshotStore(job.Output.Path)}, nil
+	}
+	return tdxproxy.OpenSink(job.Output.Type, job.Output.Options)
+}
+
+// writerSink writes each batch to a writer in the job's format.
+type writerSink struct {
+	w      io.Writer
+	format string
+}
+
+func (s *writerSink) Write(ctx context.Context, batch tdxproxy.Batch) error {
+	data, err := encodeRecords(s.format, batch.Records)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *writerSink) Flush(ctx context.Context) error { return nil }
+func (s *writerSink) Close() error                    { return nil }
+
+// fileSink writes each batch to a file whose path template expands {name},
+// {date} and {time} from the batch time.
+type fileSink struct {
+	name   string
+	path   string
+	format string
+}
+
+func (s *fileSink) Write(ctx context.Context, batch tdxproxy.Batch) error {
+	data, err := encodeRecords(s.format, batch.Records)
+	if err != nil {
+		return err
+	}
+	path := strings.NewReplacer(
+		"{name}", s.name,
+		"{date}", batch.Time.Format("2006-01-02"),
+		"{time}", batch.Time.Format("150405"),
+	).Replace(s.path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *fileSink) Flush(ctx context.Context) error { return nil }
+func (s *fileSink) Close() error                    { return nil }
+
+// snapshotSink saves each batch as the next snapshot version of the job.
+type snapshotSink struct {
+	name  string
+	store *tdxproxy.SnapshotStore
+}
+
+func (s *snapshotSink) Write(ctx context.Context, batch tdxproxy.Batch) error {
+	_, err := s.store.Save(s.name, batch.Endpoint, batch.Records)
+	return err
+}
+
+func (s *snapshotSink) Flush(ctx context.Context) error { return nil }
+func (s *snapshotSink) Close() error                    { return nil }
+
+func encodeRecords(format string, records []json.RawMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "", "json":
+		if records == nil {
+			records = []json.RawMessage{}
+		}
+		data, err := json.Marshal(records)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	case "jsonl":
+		for _, record := range records {
+			if err := json.Compact(&buf, record); err != nil {
+				return nil, err
+			}
+			buf.WriteByte('\n')
+		}
+	case "csv":
+		if err := writeCSV(&buf, records); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCSV writes one row per record with the union of top-level fields as
+// columns. Strings are written as is; nested values as compact JSON.
+func writeCSV(buf *bytes.Buffer, records []json.RawMessage) error {
+	rows := make([]map[string]json.RawMessage, len(records))
+	columns := map[string]bool{}
+	for i, record := range records {
+		if err := json.Unmarshal(record, &rows[i]); err != nil {
+			return fmt.Errorf("record %d is not an object: %w", i, err)
+		}
+		for k := range rows[i] {
+			columns[k] = true
+		}
+	}
+	header := make([]string, 0, len(columns))
+	for k := range columns {
+		header = append(header, k)
+	}
+	sort.Strings(header)
+
+	w := csv.NewWriter(buf)
+	w.Write(header)
+	for _, row := range rows {
+		line := make([]string, len(header))
+		for i, column := range header {
+			raw, ok := row[column]
+			if !ok || string(raw) == "null" {
+				continue
+			}
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				line[i] = s
+				continue
+			}
+			var compact bytes.Buffer
+			json.Compact(&compact, raw)
+			line[i] = compact.String()
+		}
+		w.Write(line)
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,205 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+)
+
+// fanOutConcurrency is the number of cities fetched at once for jobs with cities.
+const fanOutConcurrency = 4
+
+// Run executes the spec with a proxy built from its credentials. One-shot jobs
+// run once; scheduled jobs repeat until ctx is done. The returned error joins
+// the errors of failed one-shot jobs; failures of scheduled runs are logged.
+func Run(ctx context.Context, spec *Spec) error {
+	logger := slog.Default()
+	var proxy *tdxproxy.TDXProxy
+	if spec.Credentials == "" && os.Getenv("TDX_CREDENTIALS_FILE") == "" {
+		proxy = tdxproxy.NewTDXProxyNoAuth(logger)
+	} else {
+		var err error
+		proxy, err = tdxproxy.NewTDXProxyFromCredentialFile(spec.Credentials, logger)
+		if err != nil {
+			return fmt.Errorf("failed to create proxy: %w", err)
+		}
+	}
+	return RunWithProxy(ctx, proxy, spec, logger)
+}
+
+// RunWithProxy is like Run but uses the given proxy and logger.
+func RunWithProxy(ctx context.Context, proxy *tdxproxy.TDXProxy, spec *Spec, logger *slog.Logger) error {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	stopMetrics, err := pushMetrics(ctx, proxy, spec.Metrics)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(spec.Jobs))
+	for i := range spec.Jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = runJob(ctx, proxy, &spec.Jobs[i], logger)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func runJob(ctx context.Context, proxy *tdxproxy.TDXProxy, job *Job, logger *slog.Logger) (err error) {
+	sink, err := newSink(job)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	defer func() {
+		if closeErr := sink.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("job %s: %w", job.Name, closeErr))
+		}
+	}()
+
+	if job.Schedule == "" {
+		if err := runOnce(ctx, proxy, job, sink); err != nil {
+			return fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		return nil
+	}
+
+	interval, err := time.ParseDuration(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := runOnce(ctx, proxy, job, sink); err != nil {
+			logger.Error("Pipeline job failed", slog.String("job", job.Name), slog.String("error", err.Error()))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func runOnce(ctx context.Context, proxy *tdxproxy.TDXProxy, job *Job, sink tdxproxy.Sink) error {
+	records, fetchErr := fetch(ctx, proxy, job)
+	if len(records) == 0 && fetchErr != nil {
+		return fetchErr
+	}
+	batch := tdxproxy.Batch{Endpoint: job.Endpoint, Time: time.Now(), Records: records}
+	if err := sink.Write(ctx, batch); err != nil {
+		return errors.Join(fetchErr, err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		return errors.Join(fetchErr, err)
+	}
+	return fetchErr
+}
+
+// fetch returns the job's records. For fan-out jobs, records of the cities
+// that succeeded are returned together with the error of those that failed,
+// and each record gets a City field unless it already has one.
+func fetch(ctx context.Context, proxy *tdxproxy.TDXProxy, job *Job) ([]json.RawMessage, error) {
+	if len(job.Cities) == 0 {
+		resp, err := proxy.GetContext(ctx, job.Endpoint, job.Params, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		return tdxproxy.DecodeRecords(body)
+	}
+
+	cities := job.Cities
+	if len(cities) == 1 && cities[0] == "all" {
+		cities = nil
+	}
+	results, fetchErr := proxy.ForEachCity(ctx, job.Endpoint, job.Params, fanOutConcurrency, cities...)
+	merged, err := tdxproxy.MergeCityResults(results)
+	if err != nil {
+		return nil, errors.Join(fetchErr, err)
+	}
+	records := make([]json.RawMessage, 0, len(merged))
+	for _, r := range merged {
+		records = append(records, withCity(r.Record, r.City))
+	}
+	return records, fetchErr
+}
+
+// withCity adds a City field to a JSON object record that lacks one.
+func withCity(record json.RawMessage, city string) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return record
+	}
+	if _, ok := fields["City"]; ok {
+		return record
+	}
+	trimmed := bytes.TrimSpace(record)
+	name, _ := json.Marshal(city)
+	var buf bytes.Buffer
+	buf.WriteString(`{"City":`)
+	buf.Write(name)
+	if len(fields) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.Write(trimmed[1:])
+	return buf.Bytes()
+}
+
+// pushMetrics starts pushing the proxy's stats as configured and returns the
+// function that pushes them a last time and stops.
+func pushMetrics(ctx context.Context, proxy *tdxproxy.TDXProxy, metrics Metrics) (func(), error) {
+	var exporters []tdxproxy.MetricsExporter
+	if metrics.StatsD != "" {
+		exporter, err := tdxproxy.NewStatsDExporter(metrics.StatsD, "")
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if metrics.OTLP != "" {
+		exporters = append(exporters, tdxproxy.NewOTLPExporter(metrics.OTLP, "tdx-pipeline"))
+	}
+	interval := 10 * time.Second
+	if metrics.Interval != "" {
+		interval, _ = time.ParseDuration(metrics.Interval)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, exporter := range exporters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			proxy.PushMetrics(ctx, exporter, interval)
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+		for _, exporter := range exporters {
+			if closer, ok := exporter.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,153 @@
+// Package pipeline runs declarative TDX harvest jobs described in YAML.
+//
+//	credentials: tdx-credentials.json
+//	jobs:
+//	  - name: bus-eta
+//	    endpoint: v2/Bus/EstimatedTimeOfArrival/City/{city}
+//	    cities: [Taipei, Taichung]
+//	    params:
+//	      $top: "1000"
+//	    schedule: 1m
+//	    format: jsonl
+//	    output:
+//	      type: file
+//	      path: data/{name}/{date}/{time}.jsonl
+//	metrics:
+//	  statsd: localhost:8125
+//	  interval: 10s
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chihsuanwu/tdxproxy/tdxproxy"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a set of jobs sharing one proxy.
+type Spec struct {
+	// Credentials is a credential file for the proxy; if empty,
+	// TDX_CREDENTIALS_FILE is used, and without it requests are unauthenticated.
+	Credentials string  `yaml:"credentials"`
+	Jobs        []Job   `yaml:"jobs"`
+	Metrics     Metrics `yaml:"metrics"`
+}
+
+// Metrics pushes the proxy's stats while the spec runs and once when it
+// ends, for jobs too short-lived to be scraped.
+type Metrics struct {
+	// StatsD is the host:port of a StatsD server.
+	StatsD string `yaml:"statsd"`
+	// OTLP is the URL of an OTLP/HTTP metrics endpoint, such as
+	// http://localhost:4318/v1/metrics.
+	OTLP string `yaml:"otlp"`
+	// Interval between pushes, 10s by default.
+	Interval string `yaml:"interval"`
+}
+
+// Job fetches one endpoint, optionally for several cities, and writes the records to an output.
+type Job struct {
+	Name     string            `yaml:"name"`
+	Endpoint string            `yaml:"endpoint"`
+	Params   map[string]string `yaml:"params"`
+	// Cities fans the request out over cities, substituted for {city} in Endpoint.
+	// The single value "all" selects every city.
+	Cities []string `yaml:"cities"`
+	// Schedule is the interval between runs, e.g. "30s" or "5m". Empty runs the job once.
+	Schedule string `yaml:"schedule"`
+	// Format is json (default), jsonl or csv.
+	Format string `yaml:"format"`
+	Output Output `yaml:"output"`
+}
+
+// Output selects where a job's records go.
+type Output struct {
+	// Type is stdout (default), file, snapshot, or the name of a sink
+	// registered with tdxproxy.RegisterSink.
+	Type string `yaml:"type"`
+	// Path is the file path template for file outputs, expanding {name}, {date}
+	// and {time}, or the store directory for snapshot outputs.
+	Path string `yaml:"path"`
+	// Options are passed to the factory of a registered sink.
+	Options map[string]string `yaml:"options"`
+}
+
+// Load reads a spec from a YAML file.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a YAML spec.
+func Parse(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline spec: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate checks every job and returns all problems found.
+func (spec *Spec) Validate() error {
+	if len(spec.Jobs) == 0 {
+		return errors.New("pipeline spec has no jobs")
+	}
+	var errs []error
+	names := map[string]bool{}
+	for i, job := range spec.Jobs {
+		label := fmt.Sprintf("job %d", i)
+		if job.Name != "" {
+			label = fmt.Sprintf("job %q", job.Name)
+		}
+		if job.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", label))
+		} else if names[job.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", label))
+		}
+		names[job.Name] = true
+		if job.Endpoint == "" {
+			errs = append(errs, fmt.Errorf("%s: endpoint is required", label))
+		}
+		if len(job.Cities) > 0 && !strings.Contains(job.Endpoint, "{city}") {
+			errs = append(errs, fmt.Errorf("%s: cities given but endpoint has no {city} placeholder", label))
+		}
+		if job.Schedule != "" {
+			if d, err := time.ParseDuration(job.Schedule); err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("%s: schedule %q is not a positive duration", label, job.Schedule))
+			}
+		}
+		switch job.Format {
+		case "", "json", "jsonl", "csv":
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown format %q", label, job.Format))
+		}
+		switch job.Output.Type {
+		case "", "stdout":
+		case "file", "snapshot":
+			if job.Output.Path == "" {
+				errs = append(errs, fmt.Errorf("%s: %s output needs a path", label, job.Output.Type))
+			}
+		default:
+			if !slices.Contains(tdxproxy.Sinks(), job.Output.Type) {
+				errs = append(errs, fmt.Errorf("%s: unknown output type %q", label, job.Output.Type))
+			}
+		}
+	}
+	if spec.Metrics.Interval != "" {
+		if d, err := time.ParseDuration(spec.Metrics.Interval); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("metrics: interval %q is not a positive duration", spec.Metrics.Interval))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,290 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AlertMode selects a family of TDX alert endpoints.
+type AlertMode string
+
+const (
+	AlertBus     AlertMode = "bus"
+	AlertMetro   AlertMode = "metro"
+	AlertRail    AlertMode = "rail"
+	AlertFreeway AlertMode = "freeway"
+)
+
+// AlertSeverity is the unified severity of an alert.
+type AlertSeverity int
+
+const (
+	SeverityInfo AlertSeverity = iota
+	SeverityWarning
+	SeveritySevere
+)
+
+func (s AlertSeverity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeveritySevere:
+		return "severe"
+	}
+	return "info"
+}
+
+func (s AlertSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// AlertEntity is something an alert affects, such as a route, stop, station or line.
+type AlertEntity struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name Name   `json:"name"`
+}
+
+// Alert is a service alert or traffic news item in a form shared by all modes.
+type Alert struct {
+	Mode AlertMode `json:"mode"`
+	// Source is the city, metro operator or system the alert came from.
+	Source      string          `json:"source"`
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Severity    AlertSeverity   `json:"severity"`
+	Affected    []AlertEntity   `json:"affected,omitempty"`
+	Published   time.Time       `json:"published"`
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Raw         json.RawMessage `json:"raw"`
+}
+
+// alertSource is one endpoint feeding Alerts.
+type alertSource struct {
+	mode   AlertMode
+	source string
+	path   string
+}
+
+// metroOperators maps cities to the metro systems serving them.
+var metroOperators = map[string][]string{
+	"Taipei":    {"TRTC"},
+	"NewTaipei": {"NTDLRT", "TRTC"},
+	"Taoyuan":   {"TYMC"},
+	"Taichung":  {"TMRT"},
+	"Kaohsiung": {"KRTC", "KLRT"},
+}
+
+// alertSources lists the endpoints for modes and cities. Rail and freeway
+// alerts are nationwide and not filtered by city.
+func alertSources(modes []AlertMode, cities []string) ([]alertSource, error) {
+	if len(modes) == 0 {
+		modes = []AlertMode{AlertBus, AlertMetro, AlertRail, AlertFreeway}
+	}
+	if len(cities) == 0 {
+		cities = Cities
+	}
+	for _, city := range cities {
+		if err := checkBusCity(city, false); err != nil {
+			return nil, err
+		}
+	}
+	var sources []alertSource
+	for _, mode := range modes {
+		switch mode {
+		case AlertBus:
+			for _, city := range cities {
+				sources = append(sources, alertSource{mode, city, "v2/Bus/Alert/City/" + city})
+			}
+		case AlertMetro:
+			seen := map[string]bool{}
+			for _, city := range cities {
+				for _, operator := range metroOperators[city] {
+					if !seen[operator] {
+						seen[operator] = true
+						sources = append(sources, alertSource{mode, operator, "v2/Rail/Metro/Alert/" + operator})
+					}
+				}
+			}
+		case AlertRail:
+			sources = append(sources,
+				alertSource{mode, "TRA", "v3/Rail/TRA/Alert"},
+				alertSource{mode, "THSR", "v2/Rail/THSR/AlertInfo"},
+			)
+		case AlertFreeway:
+			sources = append(sources, alertSource{mode, "Freeway", "v2/Road/Traffic/Live/News/Freeway"})
+		default:
+			return nil, fmt.Errorf("unknown alert mode %q", mode)
+		}
+	}
+	return sources, nil
+}
+
+// Alerts fetches the alerts of the given modes and cities from every matching
+// endpoint and returns them newest first. No modes means all modes and no
+// cities means all Cities. Alerts from endpoints that succeeded are returned
+// together with an error describing those that failed.
+func (proxy *TDXProxy) Alerts(ctx context.Context, modes []AlertMode, cities []string) ([]Alert, error) {
+	sources, err := alertSources(modes, cities)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		alerts []Alert
+		errs   []error
+	)
+	sem := make(chan struct{}, 4)
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source alertSource) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			found, err := proxy.fetchAlerts(ctx, source)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", source.path, err))
+				return
+			}
+			alerts = append(alerts, found...)
+		}(source)
+	}
+	wg.Wait()
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Published.After(alerts[j].Published)
+	})
+	return alerts, errors.Join(errs...)
+}
+
+func (proxy *TDXProxy) fetchAlerts(ctx context.Context, source alertSource) ([]Alert, error) {
+	body, err := proxy.fetchBody(ctx, source.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]Alert, 0, len(records))
+	for i, record := range records {
+		alert, err := parseAlert(i, record)
+		if err != nil {
+			return nil, err
+		}
+		alert.Mode, alert.Source = source.mode, source.source
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// parseAlert reads the fields the alert and news schemas have in common,
+// accepting the different names the modes use for them.
+func parseAlert(index int, record json.RawMessage) (Alert, error) {
+	var fields map[string]json.RawMessage
+	if err := decodeRecord(index, record, &fields); err != nil {
+		return Alert{}, err
+	}
+	alert := Alert{
+		ID:          alertString(fields, "AlertID", "NewsID", "AlertInfoID"),
+		Title:       alertString(fields, "Title"),
+		Description: alertString(fields, "Description", "Content"),
+		Severity:    alertSeverity(fields),
+		Published:   alertTime(fields, "PublishTime", "UpdateTime"),
+		Start:       alertTime(fields, "StartTime", "EffectiveTime"),
+		End:         alertTime(fields, "EndTime", "ExpireTime"),
+		Raw:         record,
+	}
+	if scope, ok := fields["Scope"]; ok {
+		alert.Affected = alertEntities(scope)
+	}
+	return alert, nil
+}
+
+// alertSeverity maps the numeric Level of an alert, where present, to a
+// severity: 1 or less is info, 2 a warning and 3 or more severe.
+func alertSeverity(fields map[string]json.RawMessage) AlertSeverity {
+	level, err := strconv.Atoi(alertString(fields, "Level"))
+	switch {
+	case err != nil || level <= 1:
+		return SeverityInfo
+	case level == 2:
+		return SeverityWarning
+	}
+	return SeveritySevere
+}
+
+// alertEntities collects the entities listed in an alert's Scope.
+func alertEntities(scope json.RawMessage) []AlertEntity {
+	kinds := []struct{ list, typ, id, name string }{
+		{"Operators", "operator", "OperatorID", "OperatorName"},
+		{"Routes", "route", "RouteUID", "RouteName"},
+		{"Stops", "stop", "StopUID", "StopName"},
+		{"Lines", "line", "LineID", "LineName"},
+		{"Stations", "station", "StationID", "StationName"},
+	}
+	var lists map[string][]map[string]json.RawMessage
+	if err := json.Unmarshal(scope, &lists); err != nil {
+		return nil
+	}
+	var entities []AlertEntity
+	for _, kind := range kinds {
+		for _, item := range lists[kind.list] {
+			entities = append(entities, AlertEntity{
+				Type: kind.typ,
+				ID:   alertString(item, kind.id),
+				Name: alertName(item[kind.name]),
+			})
+		}
+	}
+	return entities
+}
+
+// alertString returns the first of the named fields that is present, as text.
+func alertString(fields map[string]json.RawMessage, names ...string) string {
+	for _, name := range names {
+		raw, ok := fields[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+		return string(raw)
+	}
+	return ""
+}
+
+func alertTime(fields map[string]json.RawMessage, names ...string) time.Time {
+	for _, name := range names {
+		if t, err := time.Parse(time.RFC3339, alertString(fields, name)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// alertName decodes a bilingual name, or a plain string as the Chinese name.
+func alertName(raw json.RawMessage) Name {
+	var name Name
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return name
+	}
+	var s string
+	json.Unmarshal(raw, &s)
+	return Name{ZhTw: s}
+}
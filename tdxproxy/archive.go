@@ -0,0 +1,130 @@
+package tdxproxy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// ForEachFile calls fn with the name and content of every file in r.
+// Gzip streams are decompressed transparently, tar archives inside them are
+// iterated, and zip archives are expanded (spooled to a temporary file, since
+// zip needs random access). Anything else is passed through as a single file
+// named name. fn must consume the reader before returning.
+func ForEachFile(r io.Reader, name string, fn func(name string, r io.Reader) error) error {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zipMagic))
+
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		if gz.Name != "" {
+			name = gz.Name
+		} else {
+			name = strings.TrimSuffix(name, ".gz")
+		}
+		return forEachTarOrPlain(gz, name, fn)
+	case bytes.HasPrefix(head, zipMagic):
+		return forEachZipEntry(br, fn)
+	default:
+		return fn(name, br)
+	}
+}
+
+// forEachTarOrPlain iterates a tar archive if r holds one, otherwise hands r to fn as is.
+func forEachTarOrPlain(r io.Reader, name string, fn func(name string, r io.Reader) error) error {
+	br := bufio.NewReaderSize(r, 512)
+	head, _ := br.Peek(512)
+	if len(head) < 512 || !bytes.Equal(head[257:262], []byte("ustar")) {
+		return fn(name, br)
+	}
+
+	tr := tar.NewReader(br)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func forEachZipEntry(r io.Reader, fn func(name string, r io.Reader) error) error {
+	tmp, err := os.CreateTemp("", "tdxproxy-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return fmt.Errorf("failed to spool zip archive: %w", err)
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := forEachZipFile(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachZipFile(file *zip.File, fn func(name string, r io.Reader) error) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s in zip archive: %w", file.Name, err)
+	}
+	defer rc.Close()
+	return fn(file.Name, rc)
+}
+
+// Download fetches url, typically a historical API path under TDX_URL_HISTORICAL,
+// and calls fn for every file it contains, decompressing and unpacking archives
+// as described for ForEachFile. Downloads bypass the response cache.
+func (proxy *TDXProxy) Download(ctx context.Context, url string, params map[string]string, fn func(name string, r io.Reader) error) error {
+	resp, err := proxy.requestWithRetry(ctx, url, params, nil, 0, &requestOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	name, _, _ := strings.Cut(path.Base(url), "?")
+	if _, disposition, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && disposition["filename"] != "" {
+		name = disposition["filename"]
+	}
+	return ForEachFile(resp.Body, name, fn)
+}
@@ -0,0 +1,219 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AuthProvider supplies the bearer tokens the proxy sends to TDX, in place of
+// the OAuth client-credentials flow used with a Credential, e.g. to use
+// tokens fetched elsewhere or minted by a central secrets service.
+// Implementations must be safe for concurrent use.
+type AuthProvider interface {
+	// Token returns a valid token. It is called before every attempt, so
+	// providers fetching tokens should keep them until they expire.
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenInvalidator is implemented by providers that keep tokens. The proxy
+// calls Invalidate when TDX rejects a token with 401, and on RefreshToken, so
+// that the next Token call fetches a new one.
+type TokenInvalidator interface {
+	Invalidate()
+}
+
+// AuthProviderFunc adapts a function to an AuthProvider.
+type AuthProviderFunc func(ctx context.Context) (string, error)
+
+func (f AuthProviderFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticToken returns a provider that always supplies token, such as one
+// fetched by another process. Requests fail with 401 once it expires.
+func StaticToken(token string) AuthProvider {
+	return AuthProviderFunc(func(context.Context) (string, error) {
+		if token == "" {
+			return "", errors.New("empty static token")
+		}
+		return token, nil
+	})
+}
+
+// CachedTokenProvider keeps the token returned by a fetch function until a
+// minute before it expires, or until it is invalidated. Concurrent callers
+// finding no valid token share one fetch.
+type CachedTokenProvider struct {
+	fetch func(ctx context.Context) (string, time.Time, error)
+	clock Clock
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewCachedTokenProvider creates a provider that gets tokens from fetch, which
+// returns a token and when it expires.
+func NewCachedTokenProvider(fetch func(ctx context.Context) (token string, expires time.Time, err error)) *CachedTokenProvider {
+	return &CachedTokenProvider{fetch: fetch, clock: systemClock{}}
+}
+
+func (p *CachedTokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && p.clock.Now().Before(p.expires) {
+		return p.token, nil
+	}
+	token, expires, err := p.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", errors.New("token provider returned an empty token")
+	}
+	p.token, p.expires = token, expires.Add(-time.Minute)
+	return token, nil
+}
+
+// Invalidate drops the kept token.
+func (p *CachedTokenProvider) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.token = ""
+}
+
+// Expiry returns when the kept token is replaced, zero if there is none.
+func (p *CachedTokenProvider) Expiry() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == "" {
+		return time.Time{}
+	}
+	return p.expires
+}
+
+// NewTDXProxyWithAuthProvider creates a proxy that authenticates with the
+// tokens supplied by provider.
+func NewTDXProxyWithAuthProvider(provider AuthProvider, logger *slog.Logger) *TDXProxy {
+	proxy := NewTDXProxyNoAuth(logger)
+	proxy.auth = provider
+	return proxy
+}
+
+// SetAuthProvider makes the proxy authenticate with the tokens supplied by
+// provider, taking precedence over its credentials. Passing nil returns to the
+// credentials.
+func (proxy *TDXProxy) SetAuthProvider(provider AuthProvider) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.auth = provider
+}
+
+// invalidateToken tells provider that its current token was rejected.
+func invalidateToken(provider AuthProvider) {
+	if invalidator, ok := provider.(TokenInvalidator); ok {
+		invalidator.Invalidate()
+	}
+}
+
+// TokenRequest customizes the OAuth token request made for credentials, for
+// integrations that require more than bare client credentials.
+type TokenRequest struct {
+	// GrantType replaces the "client_credentials" grant type when set.
+	GrantType string
+	// Scope and Audience are sent as the scope and audience fields when set.
+	Scope    string
+	Audience string
+	// Fields are further form fields. The grant type, client ID and secret
+	// cannot be overridden here.
+	Fields url.Values
+}
+
+// SetTokenRequest sets the fields of token requests and drops the current
+// tokens, so that the next request fetches one with the new fields.
+func (proxy *TDXProxy) SetTokenRequest(request TokenRequest) {
+	request.Fields = maps.Clone(request.Fields)
+
+	proxy.tokenMu.Lock()
+	proxy.authToken = ""
+	proxy.tokenMu.Unlock()
+	proxy.mu.Lock()
+	proxy.tokenForm = request
+	pool := proxy.credentials
+	proxy.mu.Unlock()
+	if pool != nil {
+		pool.invalidateAll()
+	}
+}
+
+// form returns the form of a token request for a client ID and secret.
+func (r TokenRequest) form(appID, appKey string) url.Values {
+	form := url.Values{}
+	for k, v := range r.Fields {
+		form[k] = v
+	}
+	if r.Scope != "" {
+		form.Set("scope", r.Scope)
+	}
+	if r.Audience != "" {
+		form.Set("audience", r.Audience)
+	}
+	grantType := r.GrantType
+	if grantType == "" {
+		grantType = "client_credentials"
+	}
+	form.Set("grant_type", grantType)
+	form.Set("client_id", appID)
+	form.Set("client_secret", appKey)
+	return form
+}
+
+// NewTDXProxyContext is like NewTDXProxy but fetches the first token before
+// returning, so that bad credentials fail at startup instead of on the first
+// request. See WarmUp.
+func NewTDXProxyContext(ctx context.Context, appID, appKey string, logger *slog.Logger) (*TDXProxy, error) {
+	proxy := NewTDXProxy(appID, appKey, logger)
+	if err := proxy.WarmUp(ctx); err != nil {
+		return nil, err
+	}
+	return proxy, nil
+}
+
+// WarmUp fetches the tokens requests need now rather than on first use: the
+// token of the single credential, of every credential of a CredentialPool,
+// or of the AuthProvider. It does nothing for proxies without credentials.
+// The error joins the failure of every credential; TDX rejecting one matches
+// ErrUnauthorized.
+func (proxy *TDXProxy) WarmUp(ctx context.Context) error {
+	settings := proxy.settings()
+	if settings.auth != nil {
+		_, err := settings.auth.Token(ctx)
+		return err
+	}
+	if pool := settings.credentials; pool != nil {
+		pool.mu.Lock()
+		entries := slices.Clone(pool.entries)
+		pool.mu.Unlock()
+		var errs []error
+		for _, c := range entries {
+			if _, err := pool.token(ctx, proxy, c, 0); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", c.AppID, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	proxy.tokenMu.Lock()
+	defer proxy.tokenMu.Unlock()
+	if proxy.appID == "" || proxy.appKey == "" || proxy.authToken != "" && proxy.clock.Now().Unix() <= proxy.expiredTime {
+		return nil
+	}
+	return proxy.updateAuthLocked(ctx, 0)
+}
@@ -0,0 +1,299 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// avroSchema is a parsed Avro schema node.
+type avroSchema struct {
+	typ     string
+	name    string
+	fields  []avroField
+	items   *avroSchema
+	values  *avroSchema
+	symbols []string
+	union   []*avroSchema
+}
+
+type avroField struct {
+	name       string
+	schema     *avroSchema
+	def        any
+	hasDefault bool
+}
+
+// AvroEncoder encodes JSON records in Avro binary form according to a schema.
+// It supports the primitive types, records, arrays, maps, enums and unions,
+// which covers the shapes of TDX records. Named types may be referenced after
+// their definition.
+//
+// With a non-negative schema ID, each message is prefixed with the Confluent
+// Schema Registry wire format header (a zero byte and the big-endian ID).
+type AvroEncoder struct {
+	schema   *avroSchema
+	schemaID int32
+}
+
+// NewAvroEncoder parses an Avro schema in JSON form. Pass a schemaID of -1 to
+// omit the Schema Registry header.
+func NewAvroEncoder(schema string, schemaID int32) (*AvroEncoder, error) {
+	var raw any
+	if err := json.Unmarshal([]byte(schema), &raw); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	parsed, err := parseAvroSchema(raw, map[string]*avroSchema{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	return &AvroEncoder{schema: parsed, schemaID: schemaID}, nil
+}
+
+func (e *AvroEncoder) Encode(record json.RawMessage) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(record))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to decode record: %w", err)
+	}
+
+	var buf []byte
+	if e.schemaID >= 0 {
+		buf = append(buf, 0)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(e.schemaID))
+	}
+	buf, err := appendAvro(buf, e.schema, value, "$")
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func parseAvroSchema(raw any, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{typ: v}, nil
+		}
+		if schema, ok := named[v]; ok {
+			return schema, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []any:
+		union := &avroSchema{typ: "union"}
+		for _, branch := range v {
+			schema, err := parseAvroSchema(branch, named)
+			if err != nil {
+				return nil, err
+			}
+			union.union = append(union.union, schema)
+		}
+		return union, nil
+	case map[string]any:
+		typ, _ := v["type"].(string)
+		name, _ := v["name"].(string)
+		switch typ {
+		case "record":
+			schema := &avroSchema{typ: typ, name: name}
+			if name != "" {
+				named[name] = schema
+			}
+			fields, _ := v["fields"].([]any)
+			for _, f := range fields {
+				field, _ := f.(map[string]any)
+				fieldName, _ := field["name"].(string)
+				if fieldName == "" {
+					return nil, fmt.Errorf("record %s has a field without a name", name)
+				}
+				fieldSchema, err := parseAvroSchema(field["type"], named)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", fieldName, err)
+				}
+				def, hasDefault := field["default"]
+				schema.fields = append(schema.fields, avroField{name: fieldName, schema: fieldSchema, def: def, hasDefault: hasDefault})
+			}
+			return schema, nil
+		case "enum":
+			schema := &avroSchema{typ: typ, name: name}
+			symbols, _ := v["symbols"].([]any)
+			for _, s := range symbols {
+				symbol, _ := s.(string)
+				schema.symbols = append(schema.symbols, symbol)
+			}
+			if name != "" {
+				named[name] = schema
+			}
+			return schema, nil
+		case "array":
+			items, err := parseAvroSchema(v["items"], named)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{typ: typ, items: items}, nil
+		case "map":
+			values, err := parseAvroSchema(v["values"], named)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{typ: typ, values: values}, nil
+		default:
+			return parseAvroSchema(v["type"], named)
+		}
+	}
+	return nil, fmt.Errorf("unsupported schema node %v", raw)
+}
+
+func appendAvro(buf []byte, schema *avroSchema, value any, path string) ([]byte, error) {
+	mismatch := func() error {
+		return fmt.Errorf("%s: value %v does not match avro type %s", path, value, schema.typ)
+	}
+
+	switch schema.typ {
+	case "null":
+		if value != nil {
+			return nil, mismatch()
+		}
+		return buf, nil
+	case "boolean":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, mismatch()
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case "int", "long":
+		n, ok := value.(json.Number)
+		if !ok {
+			return nil, mismatch()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return nil, mismatch()
+		}
+		if schema.typ == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return nil, mismatch()
+		}
+		return binary.AppendVarint(buf, i), nil
+	case "float", "double":
+		n, ok := value.(json.Number)
+		if !ok {
+			return nil, mismatch()
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, mismatch()
+		}
+		if schema.typ == "float" {
+			return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case "string", "bytes":
+		s, ok := value.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		buf = binary.AppendVarint(buf, int64(len(s)))
+		return append(buf, s...), nil
+	case "enum":
+		s, ok := value.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		for i, symbol := range schema.symbols {
+			if symbol == s {
+				return binary.AppendVarint(buf, int64(i)), nil
+			}
+		}
+		return nil, mismatch()
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		if len(items) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(items)))
+			for i, item := range items {
+				var err error
+				if buf, err = appendAvro(buf, schema.items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case "map":
+		entries, ok := value.(map[string]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		if len(entries) > 0 {
+			buf = binary.AppendVarint(buf, int64(len(entries)))
+			keys := sortedKeys(entries)
+			for _, k := range keys {
+				buf = binary.AppendVarint(buf, int64(len(k)))
+				buf = append(buf, k...)
+				var err error
+				if buf, err = appendAvro(buf, schema.values, entries[k], path+"."+k); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return append(buf, 0), nil
+	case "record":
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		for _, field := range schema.fields {
+			fieldValue, present := fields[field.name]
+			if !present && field.hasDefault {
+				fieldValue = normalizeAvroDefault(field.def)
+			}
+			var err error
+			if buf, err = appendAvro(buf, field.schema, fieldValue, path+"."+field.name); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case "union":
+		for i, branch := range schema.union {
+			encoded, err := appendAvro(nil, branch, value, path)
+			if err != nil {
+				continue
+			}
+			buf = binary.AppendVarint(buf, int64(i))
+			return append(buf, encoded...), nil
+		}
+		return nil, fmt.Errorf("%s: value %v matches no branch of union", path, value)
+	}
+	return nil, errors.New("unsupported avro type " + schema.typ)
+}
+
+// normalizeAvroDefault converts a schema default, decoded without UseNumber,
+// to the representation appendAvro expects.
+func normalizeAvroDefault(def any) any {
+	switch v := def.(type) {
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeAvroDefault(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = normalizeAvroDefault(item)
+		}
+		return out
+	}
+	return def
+}
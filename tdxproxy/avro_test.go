@@ -0,0 +1,210 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "BusPosition",
+	"fields": [
+		{"name": "PlateNumb", "type": "string"},
+		{"name": "Direction", "type": "int"},
+		{"name": "GPSTime", "type": "long"},
+		{"name": "Position", "type": {"type": "record", "name": "Point", "fields": [
+			{"name": "PositionLat", "type": "double"},
+			{"name": "PositionLon", "type": "double"}
+		]}},
+		{"name": "Previous", "type": ["null", "Point"], "default": null},
+		{"name": "Speed", "type": ["null", "float"]},
+		{"name": "DutyStatus", "type": {"type": "enum", "name": "Duty", "symbols": ["Normal", "Start", "End"]}},
+		{"name": "IsLowFloor", "type": "boolean"},
+		{"name": "Stops", "type": {"type": "array", "items": "string"}},
+		{"name": "Counts", "type": {"type": "map", "values": "long"}},
+		{"name": "Source", "type": "string", "default": "TDX"},
+		{"name": "Raw", "type": "bytes"}
+	]
+}`
+
+// decodeAvro is the inverse of appendAvro, returning values in the form
+// Encode reads them and the remaining input.
+func decodeAvro(data []byte, schema *avroSchema) (any, []byte, error) {
+	varint := func() (int64, error) {
+		n, size := binary.Varint(data)
+		if size <= 0 {
+			return 0, errors.New("truncated varint")
+		}
+		data = data[size:]
+		return n, nil
+	}
+	switch schema.typ {
+	case "null":
+		return nil, data, nil
+	case "boolean":
+		if len(data) < 1 {
+			return nil, nil, errors.New("truncated boolean")
+		}
+		return data[0] == 1, data[1:], nil
+	case "int", "long":
+		n, err := varint()
+		return json.Number(strconv.FormatInt(n, 10)), data, err
+	case "float":
+		if len(data) < 4 {
+			return nil, nil, errors.New("truncated float")
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		return json.Number(strconv.FormatFloat(float64(f), 'f', -1, 32)), data[4:], nil
+	case "double":
+		if len(data) < 8 {
+			return nil, nil, errors.New("truncated double")
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), data[8:], nil
+	case "string", "bytes":
+		n, err := varint()
+		if err != nil || n < 0 || int64(len(data)) < n {
+			return nil, nil, errors.New("truncated string")
+		}
+		return string(data[:n]), data[n:], nil
+	case "enum":
+		i, err := varint()
+		if err != nil || i < 0 || i >= int64(len(schema.symbols)) {
+			return nil, nil, fmt.Errorf("invalid enum index %d", i)
+		}
+		return schema.symbols[i], data, nil
+	case "array", "map":
+		element := schema.items
+		if schema.typ == "map" {
+			element = schema.values
+		}
+		items, entries := []any{}, map[string]any{}
+		for {
+			n, err := varint()
+			if err != nil {
+				return nil, nil, err
+			}
+			if n == 0 {
+				break
+			}
+			for range n {
+				var key any = ""
+				if schema.typ == "map" {
+					if key, data, err = decodeAvro(data, &avroSchema{typ: "string"}); err != nil {
+						return nil, nil, err
+					}
+				}
+				var value any
+				if value, data, err = decodeAvro(data, element); err != nil {
+					return nil, nil, err
+				}
+				items = append(items, value)
+				entries[key.(string)] = value
+			}
+		}
+		if schema.typ == "map" {
+			return entries, data, nil
+		}
+		return items, data, nil
+	case "record":
+		fields := map[string]any{}
+		for _, field := range schema.fields {
+			var err error
+			if fields[field.name], data, err = decodeAvro(data, field.schema); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", field.name, err)
+			}
+		}
+		return fields, data, nil
+	case "union":
+		i, err := varint()
+		if err != nil || i < 0 || i >= int64(len(schema.union)) {
+			return nil, nil, fmt.Errorf("invalid union branch %d", i)
+		}
+		return decodeAvro(data, schema.union[i])
+	}
+	return nil, nil, errors.New("unsupported avro type " + schema.typ)
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		// want is the record as decoded, with defaults filled in.
+		want string
+	}{
+		{
+			name: "full",
+			record: `{"PlateNumb":"KKA-1234","Direction":1,"GPSTime":1714550400,
+				"Position":{"PositionLat":25.0478,"PositionLon":121.517},
+				"Previous":{"PositionLat":25.0421,"PositionLon":121.5081},
+				"Speed":12.5,"DutyStatus":"End","IsLowFloor":true,
+				"Stops":["TPE10001","TPE10002"],"Counts":{"b":-3,"a":9007199254740993},
+				"Source":"cache","Raw":"\u0000ÿ","Ignored":"x"}`,
+			want: `{"PlateNumb":"KKA-1234","Direction":1,"GPSTime":1714550400,
+				"Position":{"PositionLat":25.0478,"PositionLon":121.517},
+				"Previous":{"PositionLat":25.0421,"PositionLon":121.5081},
+				"Speed":12.5,"DutyStatus":"End","IsLowFloor":true,
+				"Stops":["TPE10001","TPE10002"],"Counts":{"a":9007199254740993,"b":-3},
+				"Source":"cache","Raw":"\u0000ÿ"}`,
+		},
+		{
+			name: "defaults and empty",
+			record: `{"PlateNumb":"","Direction":-2147483648,"GPSTime":-1,
+				"Position":{"PositionLat":-90,"PositionLon":0},
+				"Speed":null,"DutyStatus":"Normal","IsLowFloor":false,
+				"Stops":[],"Counts":{},"Raw":""}`,
+			want: `{"PlateNumb":"","Direction":-2147483648,"GPSTime":-1,
+				"Position":{"PositionLat":-90,"PositionLon":0},"Previous":null,
+				"Speed":null,"DutyStatus":"Normal","IsLowFloor":false,
+				"Stops":[],"Counts":{},"Source":"TDX","Raw":""}`,
+		},
+	}
+	for _, schemaID := range []int32{-1, 42} {
+		encoder, err := NewAvroEncoder(testAvroSchema, schemaID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/id %d", tc.name, schemaID), func(t *testing.T) {
+				data, err := encoder.Encode(json.RawMessage(tc.record))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if schemaID >= 0 {
+					header := []byte{0, 0, 0, 0, byte(schemaID)}
+					if !bytes.HasPrefix(data, header) {
+						t.Fatalf("message starts % x, want the header % x", data[:min(len(data), 5)], header)
+					}
+					data = data[len(header):]
+				}
+				decoded, rest, err := decodeAvro(data, encoder.schema)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rest) > 0 {
+					t.Errorf("%d bytes left after the record", len(rest))
+				}
+
+				var want any
+				wantDecoder := json.NewDecoder(strings.NewReader(tc.want))
+				wantDecoder.UseNumber()
+				if err := wantDecoder.Decode(&want); err != nil {
+					t.Fatal(err)
+				}
+				// Marshalling sorts keys and writes numbers as decoded.
+				got, _ := json.Marshal(decoded)
+				wantJSON, _ := json.Marshal(want)
+				if string(got) != string(wantJSON) {
+					t.Errorf("decoded %s\nwant    %s", got, wantJSON)
+				}
+			})
+		}
+	}
+}
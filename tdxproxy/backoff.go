@@ -0,0 +1,117 @@
+package tdxproxy
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Backoff computes how long to wait before retry number attempt (starting at 1).
+// resp is the response that caused the retry, or nil after a transport error.
+type Backoff interface {
+	NextDelay(attempt int, resp *http.Response) time.Duration
+}
+
+// BackoffFunc adapts a function to the Backoff interface.
+type BackoffFunc func(attempt int, resp *http.Response) time.Duration
+
+func (f BackoffFunc) NextDelay(attempt int, resp *http.Response) time.Duration {
+	return f(attempt, resp)
+}
+
+// SequenceBackoff is a Backoff whose delays depend on the delay before the
+// previous retry of the same request. The built-in retry policies call
+// NextDelayAfter from the proxy's retry loops, with a previous delay of zero
+// before the first retry.
+type SequenceBackoff interface {
+	Backoff
+	NextDelayAfter(previous time.Duration, attempt int, resp *http.Response) time.Duration
+}
+
+// nextDelay returns the delay of b, passing previous on to a SequenceBackoff
+// unless it is negative, meaning unknown.
+func nextDelay(b Backoff, previous time.Duration, attempt int, resp *http.Response) time.Duration {
+	if sb, ok := b.(SequenceBackoff); ok && previous >= 0 {
+		return sb.NextDelayAfter(previous, attempt, resp)
+	}
+	return b.NextDelay(attempt, resp)
+}
+
+// ConstantBackoff waits the same delay before every retry.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b ConstantBackoff) NextDelay(int, *http.Response) time.Duration {
+	return b.Delay
+}
+
+// defaultMaxBackoff caps the delays of backoffs without a Max, which would
+// otherwise overflow time.Duration after a few dozen attempts.
+const defaultMaxBackoff = time.Hour
+
+// backoffCap returns max, or defaultMaxBackoff if max is not positive.
+func backoffCap(max time.Duration) time.Duration {
+	if max <= 0 {
+		return defaultMaxBackoff
+	}
+	return max
+}
+
+// ExponentialBackoff waits Base, then Base*Multiplier, Base*Multiplier^2 and so on,
+// capped at Max, or at an hour when Max is not positive. A Multiplier below 1
+// is treated as 2.
+type ExponentialBackoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, _ *http.Response) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	// The delay is computed as a float and clamped before converting, so
+	// large attempt numbers cannot overflow.
+	limit := backoffCap(b.Max)
+	delay := float64(b.Base) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(limit) {
+		return limit
+	}
+	return time.Duration(delay)
+}
+
+// DecorrelatedJitterBackoff spreads retries of concurrent clients apart by
+// picking a random delay between Base and three times the previous delay,
+// capped at Max, or at an hour when Max is not positive. The delays of a
+// request thus wander rather than follow a schedule shared by every client.
+// NextDelay, lacking the previous delay, assumes the largest one the attempt
+// could have followed.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+func (b DecorrelatedJitterBackoff) NextDelay(attempt int, resp *http.Response) time.Duration {
+	previous := float64(b.Base) * math.Pow(3, float64(attempt-1))
+	if limit := backoffCap(b.Max); previous > float64(limit) {
+		previous = float64(limit)
+	}
+	return b.NextDelayAfter(time.Duration(previous), attempt, resp)
+}
+
+func (b DecorrelatedJitterBackoff) NextDelayAfter(previous time.Duration, _ int, _ *http.Response) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+	upper := 3 * float64(max(previous, b.Base))
+	if limit := backoffCap(b.Max); upper > float64(limit) {
+		upper = float64(limit)
+	}
+	if upper <= float64(b.Base) {
+		return b.Base
+	}
+	return b.Base + time.Duration(rand.Int64N(int64(upper)-int64(b.Base)))
+}
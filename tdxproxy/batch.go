@@ -0,0 +1,112 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BatchRequest is one request of a batch run by GetBatch.
+type BatchRequest struct {
+	Path   string
+	Params map[string]string
+	// Bindings holds the placeholder values the request was expanded from
+	// by ExpandTemplate, nil for requests built otherwise.
+	Bindings map[string]string
+}
+
+// BatchResult is the outcome of one request in GetBatch.
+type BatchResult struct {
+	Request BatchRequest
+	Body    []byte
+	Err     error
+}
+
+// ExpandTemplate returns a request for every combination of the values in
+// bindings, substituted for the placeholders of pathTemplate:
+//
+//	ExpandTemplate("v2/Bus/EstimatedTimeOfArrival/City/{city}/{route}", map[string][]string{
+//		"city":  {"Taipei", "NewTaipei"},
+//		"route": {"307", "265"},
+//	})
+//
+// gives four requests. The values of the first placeholder vary slowest, and
+// are path-escaped. Every placeholder needs at least one value, and every
+// binding a placeholder.
+func ExpandTemplate(pathTemplate string, bindings map[string][]string) ([]BatchRequest, error) {
+	var names []string
+	for _, name := range (Endpoint{Path: pathTemplate}).Placeholders() {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if len(bindings[name]) == 0 {
+			return nil, fmt.Errorf("path template %q: no values bound to {%s}", pathTemplate, name)
+		}
+	}
+	for name := range bindings {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("path template %q has no {%s} placeholder", pathTemplate, name)
+		}
+	}
+
+	requests := []BatchRequest{{Path: pathTemplate, Bindings: map[string]string{}}}
+	for _, name := range names {
+		expanded := make([]BatchRequest, 0, len(requests)*len(bindings[name]))
+		for _, request := range requests {
+			for _, value := range bindings[name] {
+				values := maps.Clone(request.Bindings)
+				values[name] = value
+				expanded = append(expanded, BatchRequest{
+					Path:     strings.ReplaceAll(request.Path, "{"+name+"}", url.PathEscape(value)),
+					Bindings: values,
+				})
+			}
+		}
+		requests = expanded
+	}
+	return requests, nil
+}
+
+// GetBatch sends the requests, at most concurrency at a time, and returns
+// their results in the order of requests. The error joins the errors of every
+// failed request.
+func (proxy *TDXProxy) GetBatch(ctx context.Context, requests []BatchRequest, concurrency int) ([]BatchResult, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]BatchResult, len(requests))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		results[i].Request = request
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return
+			}
+			result.Body, result.Err = proxy.fetchBody(ctx, result.Request.Path, result.Request.Params)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Request.Path, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,193 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Benchmarks for the hot paths of a request. Run them with
+//
+//	go test -run '^$' -bench . -benchmem ./tdxproxy
+//
+// and compare runs with benchstat before and after performance work.
+
+func benchProxy() *TDXProxy {
+	proxy := NewTDXProxy("id", "key", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.authToken = "token"
+	proxy.expiredTime = time.Now().Add(time.Hour).Unix()
+	return proxy
+}
+
+var benchParams = map[string]string{
+	"$format": "JSON",
+	"$top":    "30",
+	"$select": "RouteUID,RouteName,SubRoutes",
+	"$filter": "RouteName%2FZh_tw%20eq%20%27307%27",
+}
+
+// benchBody returns a v2-style response body of n bus stop records.
+func benchBody(n int) []byte {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"StopUID":"TPE%d","StopName":{"Zh_tw":"站牌%d","En":"Stop %d"},"StopPosition":{"PositionLat":25.%04d,"PositionLon":121.%04d},"UpdateTime":"2024-05-01T10:00:00+08:00"}`, i, i, i, i, i)
+	}
+	b.WriteByte(']')
+	return []byte(b.String())
+}
+
+func BenchmarkBuildFullURL(b *testing.B) {
+	proxy := benchProxy()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		proxy.buildFullURL("v2/Bus/Route/City/Taipei", benchParams)
+	}
+}
+
+func BenchmarkBuildAuthHeaders(b *testing.B) {
+	proxy := benchProxy()
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := proxy.buildAuthHeaders(ctx, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCacheKey(b *testing.B) {
+	proxy := benchProxy()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		proxy.cacheKey("v2/Bus/Route/City/Taipei", benchParams)
+	}
+}
+
+func BenchmarkCachedResponse(b *testing.B) {
+	proxy := benchProxy()
+	proxy.SetCache(NewMemoryCache(), time.Hour)
+	key := proxy.cacheKey("v2/Bus/Stop/City/Taipei", benchParams)
+	proxy.cache.Set(key, &CacheEntry{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       benchBody(100),
+		StoredAt:   time.Now(),
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, ok := proxy.cachedResponse(key, 0); !ok {
+			b.Fatal("cache miss")
+		}
+	}
+}
+
+func BenchmarkGetCacheHit(b *testing.B) {
+	proxy := benchProxy()
+	proxy.SetCache(NewMemoryCache(), time.Hour)
+	key := proxy.cacheKey("v2/Bus/Stop/City/Taipei", benchParams)
+	proxy.cache.Set(key, &CacheEntry{StatusCode: http.StatusOK, Header: http.Header{}, Body: benchBody(100), StoredAt: time.Now()})
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		resp, err := proxy.GetContext(ctx, "v2/Bus/Stop/City/Taipei", benchParams, nil, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func BenchmarkDecodeRecords(b *testing.B) {
+	for _, n := range []int{10, 1000} {
+		body := benchBody(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := DecodeRecords(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeRecordsEnvelope(b *testing.B) {
+	body := []byte(`{"UpdateTime":"2024-05-01T10:00:00+08:00","UpdateInterval":60,"Stops":` + string(benchBody(1000)) + `}`)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeRecords(body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeAs(b *testing.B) {
+	type stop struct {
+		StopUID      string
+		StopName     Name
+		StopPosition struct{ PositionLat, PositionLon float64 }
+	}
+	body := benchBody(1000)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeAs[stop](body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFlattenNames(b *testing.B) {
+	records, err := DecodeRecords(benchBody(1))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := FlattenNames(records[0], LangEn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestAllocationBudgets fails when a hot path starts allocating noticeably
+// more than it does today. The budgets leave headroom over the measured
+// counts; lower them when an optimization lands.
+func TestAllocationBudgets(t *testing.T) {
+	proxy := benchProxy()
+	proxy.SetCache(NewMemoryCache(), time.Hour)
+	key := proxy.cacheKey("v2/Bus/Stop/City/Taipei", benchParams)
+	proxy.cache.Set(key, &CacheEntry{StatusCode: http.StatusOK, Header: http.Header{}, Body: benchBody(10), StoredAt: time.Now()})
+	ctx := context.Background()
+	body := benchBody(10)
+
+	budgets := []struct {
+		name   string
+		budget float64
+		run    func()
+	}{
+		{"buildFullURL", 24, func() { proxy.buildFullURL("v2/Bus/Route/City/Taipei", benchParams) }},
+		{"buildAuthHeaders", 5, func() { proxy.buildAuthHeaders(ctx, 0) }},
+		{"cacheKey", 30, func() { proxy.cacheKey("v2/Bus/Route/City/Taipei", benchParams) }},
+		{"cachedResponse", 12, func() { proxy.cachedResponse(key, 0) }},
+		{"DecodeRecords", 24, func() { DecodeRecords(body) }},
+	}
+	for _, tc := range budgets {
+		t.Run(tc.name, func(t *testing.T) {
+			if allocs := testing.AllocsPerRun(100, tc.run); allocs > tc.budget {
+				t.Errorf("%s allocates %.0f times per call, budget is %.0f", tc.name, allocs, tc.budget)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package tdxproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// BodyTooLargeError reports a response body exceeding the configured maximum.
+// It is returned by the request when the declared Content-Length is too large,
+// and otherwise by reads of the body once the limit is passed.
+type BodyTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("response body of %s exceeds %d bytes", e.URL, e.Limit)
+}
+
+// SetMaxBodySize caps the size of response bodies at n bytes, protecting
+// small services from accidentally fetching a whole city-wide dataset.
+// n <= 0 removes the limit. MaxBodySize overrides it per request.
+func (proxy *TDXProxy) SetMaxBodySize(n int64) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.maxBodySize = n
+}
+
+// bodyLimit returns the limit for a request, or 0 for none.
+func (proxy *TDXProxy) bodyLimit(options *requestOptions) int64 {
+	limit := proxy.settings().maxBodySize
+	if options.maxBodySize != 0 {
+		limit = options.maxBodySize
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// limitBody enforces limit on resp, closing it and returning an error if its
+// declared length is already too large.
+func limitBody(url string, resp *http.Response, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	if resp.ContentLength > limit {
+		resp.Body.Close()
+		return &BodyTooLargeError{URL: url, Limit: limit}
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: limit, err: &BodyTooLargeError{URL: url, Limit: limit}}
+	return nil
+}
+
+// limitedBody fails reads with err once more than the limit has been read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.err
+	}
+	// Read one byte past the limit to tell a body of exactly the limit from a larger one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), b.err
+	}
+	return n, err
+}
@@ -0,0 +1,300 @@
+package tdxproxy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Direction is the direction of travel of a bus sub-route in TDX data. A
+// route's two directions are separate records, each with its own stop
+// sequence and timetable, so data of one direction must not be matched with
+// the other's.
+type Direction int
+
+const (
+	// DirectionOutbound (去程) runs from the route's departure stop to its destination.
+	DirectionOutbound Direction = 0
+	// DirectionInbound (返程) runs back from the destination.
+	DirectionInbound Direction = 1
+	// DirectionLoop is a circular route, which has a single direction.
+	DirectionLoop Direction = 2
+	// DirectionUnknown is used by TDX when the direction is not known.
+	DirectionUnknown Direction = 255
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionOutbound:
+		return "outbound"
+	case DirectionInbound:
+		return "inbound"
+	case DirectionLoop:
+		return "loop"
+	case DirectionUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// RouteStop is a stop of a StopSequence.
+type RouteStop struct {
+	StopUID  string
+	StopName Name
+	// StationID groups the stops of both directions at the same place, which
+	// have different StopUIDs.
+	StationID string
+	// Sequence is the stop's number along the direction, from 1.
+	Sequence int
+	Lat, Lon float64
+}
+
+// StopSequence is the stops of one direction of a sub-route, in the order
+// buses serve them. A route has one per sub-route and direction: variants
+// such as short turns or detours are sub-routes of their own.
+type StopSequence struct {
+	RouteUID     string
+	RouteName    Name
+	SubRouteUID  string
+	SubRouteName Name
+	Direction    Direction
+	Stops        []RouteStop
+}
+
+// Index returns the position in s.Stops of the stop with the StopUID or
+// StationID id, or -1 if the sequence does not serve it.
+func (s StopSequence) Index(id string) int {
+	return slices.IndexFunc(s.Stops, func(stop RouteStop) bool { return stop.StopUID == id || stop.StationID == id })
+}
+
+// Serves reports whether buses of s call at from and later at to, each given
+// by StopUID or StationID.
+func (s StopSequence) Serves(from, to string) bool {
+	i := s.Index(from)
+	return i >= 0 && slices.ContainsFunc(s.Stops[i+1:], func(stop RouteStop) bool { return stop.StopUID == to || stop.StationID == to })
+}
+
+// SequenceBetween returns the first of sequences whose buses travel from
+// from to to, which tells the direction to use for a trip between two stops.
+func SequenceBetween(sequences []StopSequence, from, to string) (StopSequence, bool) {
+	i := slices.IndexFunc(sequences, func(s StopSequence) bool { return s.Serves(from, to) })
+	if i < 0 {
+		return StopSequence{}, false
+	}
+	return sequences[i], true
+}
+
+// BusStopSequences returns the stop sequences of a city bus route, or of an
+// intercity route when city is "InterCity", one per sub-route and direction,
+// ordered by sub-route and direction. route is a route name matched exactly
+// against the Chinese name, as TDX also returns routes whose names merely
+// start with it, such as 307莒光 for 307. A route TDX has no stops for fails
+// with ErrRouteNotOperated.
+func (proxy *TDXProxy) BusStopSequences(ctx context.Context, city, route string) ([]StopSequence, error) {
+	if err := checkBusCity(city, true); err != nil {
+		return nil, err
+	}
+	type stopOfRoute struct {
+		RouteUID     string
+		RouteName    Name
+		SubRouteUID  string
+		SubRouteName Name
+		Direction    Direction
+		Stops        []struct {
+			StopUID      string
+			StopName     Name
+			StationID    string
+			StopSequence int
+			StopPosition struct {
+				PositionLat float64
+				PositionLon float64
+			}
+		}
+	}
+	records, err := fetchStatic[stopOfRoute](ctx, proxy, busPath("StopOfRoute", city)+"/"+url.PathEscape(route), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var sequences []StopSequence
+	for _, r := range records {
+		if r.RouteName.ZhTw != route {
+			continue
+		}
+		s := StopSequence{
+			RouteUID:     r.RouteUID,
+			RouteName:    r.RouteName,
+			SubRouteUID:  r.SubRouteUID,
+			SubRouteName: r.SubRouteName,
+			Direction:    r.Direction,
+			Stops:        make([]RouteStop, len(r.Stops)),
+		}
+		for i, stop := range r.Stops {
+			s.Stops[i] = RouteStop{
+				StopUID:   stop.StopUID,
+				StopName:  stop.StopName,
+				StationID: stop.StationID,
+				Sequence:  stop.StopSequence,
+				Lat:       stop.StopPosition.PositionLat,
+				Lon:       stop.StopPosition.PositionLon,
+			}
+		}
+		// TDX does not promise the stops are listed in order.
+		slices.SortStableFunc(s.Stops, func(a, b RouteStop) int { return cmp.Compare(a.Sequence, b.Sequence) })
+		sequences = append(sequences, s)
+	}
+	if len(sequences) == 0 {
+		return nil, &ServiceError{Service: "bus", Kind: ErrRouteNotOperated, Value: route}
+	}
+	slices.SortStableFunc(sequences, func(a, b StopSequence) int {
+		return compareSubRoute(a.SubRouteUID, a.Direction, b.SubRouteUID, b.Direction)
+	})
+	return sequences, nil
+}
+
+// BusStopTime is when a trip calls at a stop, as "HH:MM" times of day that
+// may be past 24:00 for trips after midnight.
+type BusStopTime struct {
+	StopUID   string
+	StopName  Name
+	Sequence  int
+	Arrival   string
+	Departure string
+}
+
+// BusTrip is a timetabled trip of a BusTimetable.
+type BusTrip struct {
+	TripID string
+	// Days lists the days of the week the trip runs, or is nil for every day.
+	Days []time.Weekday
+	// StopTimes are in stop sequence order; timetables often list only
+	// the first stop.
+	StopTimes []BusStopTime
+}
+
+// RunsOn reports whether the trip runs on day.
+func (t BusTrip) RunsOn(day time.Weekday) bool {
+	return t.Days == nil || slices.Contains(t.Days, day)
+}
+
+// BusTimetable is the schedule of one direction of a sub-route: timetabled
+// trips, headway periods, or both.
+type BusTimetable struct {
+	RouteUID     string
+	RouteName    Name
+	SubRouteUID  string
+	SubRouteName Name
+	Direction    Direction
+	Trips        []BusTrip
+	Headways     []Headway
+}
+
+// BusTimetables returns the timetables of a city bus route, or of an
+// intercity route when city is "InterCity", one per sub-route and direction,
+// ordered like BusStopSequences so the two can be matched by SubRouteUID and
+// Direction. Trips are ordered by their first departure. route is matched as
+// in BusStopSequences.
+func (proxy *TDXProxy) BusTimetables(ctx context.Context, city, route string) ([]BusTimetable, error) {
+	if err := checkBusCity(city, true); err != nil {
+		return nil, err
+	}
+	type schedule struct {
+		RouteUID     string
+		RouteName    Name
+		SubRouteUID  string
+		SubRouteName Name
+		Direction    Direction
+		Timetables   []struct {
+			TripID     string
+			ServiceDay map[string]int
+			StopTimes  []struct {
+				StopUID       string
+				StopName      Name
+				StopSequence  int
+				ArrivalTime   string
+				DepartureTime string
+			}
+		}
+		Frequencys []struct {
+			StartTime      string
+			EndTime        string
+			MinHeadwayMins int
+			MaxHeadwayMins int
+			ServiceDay     map[string]int
+		}
+	}
+	schedules, err := fetchStatic[schedule](ctx, proxy, busPath("Schedule", city)+"/"+url.PathEscape(route), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var timetables []BusTimetable
+	for _, s := range schedules {
+		if s.RouteName.ZhTw != route {
+			continue
+		}
+		t := BusTimetable{
+			RouteUID:     s.RouteUID,
+			RouteName:    s.RouteName,
+			SubRouteUID:  s.SubRouteUID,
+			SubRouteName: s.SubRouteName,
+			Direction:    s.Direction,
+		}
+		for _, tt := range s.Timetables {
+			trip := BusTrip{TripID: tt.TripID, Days: serviceDays(tt.ServiceDay)}
+			for _, st := range tt.StopTimes {
+				trip.StopTimes = append(trip.StopTimes, BusStopTime{
+					StopUID:   st.StopUID,
+					StopName:  st.StopName,
+					Sequence:  st.StopSequence,
+					Arrival:   st.ArrivalTime,
+					Departure: st.DepartureTime,
+				})
+			}
+			slices.SortStableFunc(trip.StopTimes, func(a, b BusStopTime) int { return cmp.Compare(a.Sequence, b.Sequence) })
+			t.Trips = append(t.Trips, trip)
+		}
+		slices.SortStableFunc(t.Trips, func(a, b BusTrip) int { return cmp.Compare(firstDeparture(a), firstDeparture(b)) })
+		for _, fr := range s.Frequencys {
+			if _, err := clockSpan(fr.StartTime, fr.EndTime); err != nil {
+				return nil, fmt.Errorf("route %s: %w", s.RouteUID, err)
+			}
+			t.Headways = append(t.Headways, Headway{
+				Start:      fr.StartTime,
+				End:        fr.EndTime,
+				MinHeadway: time.Duration(fr.MinHeadwayMins) * time.Minute,
+				MaxHeadway: time.Duration(fr.MaxHeadwayMins) * time.Minute,
+				Days:       serviceDays(fr.ServiceDay),
+			})
+		}
+		timetables = append(timetables, t)
+	}
+	if len(timetables) == 0 {
+		return nil, &ServiceError{Service: "bus", Kind: ErrRouteNotOperated, Value: route}
+	}
+	slices.SortStableFunc(timetables, func(a, b BusTimetable) int {
+		return compareSubRoute(a.SubRouteUID, a.Direction, b.SubRouteUID, b.Direction)
+	})
+	return timetables, nil
+}
+
+// firstDeparture returns the departure of a trip from its first stop, padded
+// to compare as a time of day, or "" if the trip lists no times.
+func firstDeparture(t BusTrip) string {
+	if len(t.StopTimes) == 0 {
+		return ""
+	}
+	hhmm := firstNonEmpty(t.StopTimes[0].Departure, t.StopTimes[0].Arrival)
+	if len(hhmm) == 4 {
+		hhmm = "0" + hhmm
+	}
+	return hhmm
+}
+
+// compareSubRoute orders records of a route by sub-route, then direction.
+func compareSubRoute(subRouteA string, directionA Direction, subRouteB string, directionB Direction) int {
+	return cmp.Or(cmp.Compare(subRouteA, subRouteB), cmp.Compare(directionA, directionB))
+}
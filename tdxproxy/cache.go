@@ -0,0 +1,234 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotCached is returned for OnlyIfCached requests that have no fresh cache entry.
+var ErrNotCached = errors.New("response not in cache")
+
+// defaultPorts maps URL schemes to the port implied when none is given.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// CacheEntry is a stored response.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+	// TTL overrides the proxy's cache TTL for this entry when positive.
+	TTL time.Duration
+}
+
+// response rebuilds an http.Response from the entry. Each call returns a fresh body reader.
+func (entry *CacheEntry) response() *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+	}
+}
+
+// Cache stores responses keyed by their normalized request URL.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// FlushingCache is a Cache that buffers writes, such as one backed by disk or
+// a remote store, and can write them out on demand.
+type FlushingCache interface {
+	Cache
+	Flush() error
+}
+
+// MemoryCache is an in-process Cache backed by a map.
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]*CacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *MemoryCache) Set(key string, entry *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// FlushCache writes out buffered cache entries if the cache is a FlushingCache,
+// e.g. before the process exits.
+func (proxy *TDXProxy) FlushCache() error {
+	if cache, ok := proxy.settings().cache.(FlushingCache); ok {
+		return cache.Flush()
+	}
+	return nil
+}
+
+// SetCache enables response caching with the given time-to-live.
+// Passing a nil cache disables caching.
+func (proxy *TDXProxy) SetCache(cache Cache, ttl time.Duration) {
+	if cache != nil && ttl <= 0 {
+		proxy.logger.Warn("Non-positive cache TTL provided, caching disabled")
+		cache = nil
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.cache = cache
+	proxy.cacheTTL = ttl
+}
+
+// SetNegativeCacheTTL enables negative caching: 404 responses and responses
+// without records are kept in the cache for ttl, independently of the cache
+// TTL, so that repeated lookups of nonexistent IDs don't each reach TDX.
+// A cached 404 is returned as the same *StatusError as a fresh one.
+// It has no effect without a cache; a non-positive ttl disables it.
+func (proxy *TDXProxy) SetNegativeCacheTTL(ttl time.Duration) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.negativeTTL = max(ttl, 0)
+}
+
+// cacheKey returns a normalized key for a request, so that logically identical
+// requests map to the same entry regardless of parameter order, host casing
+// or explicit default ports. Parameters are kept even where they repeat what
+// TDX assumes, such as $format, whose default differs between endpoints.
+func (proxy *TDXProxy) cacheKey(path string, params map[string]string) string {
+	u, err := url.Parse(proxy.resolveURL(path))
+	if err != nil {
+		return proxy.resolveURL(path) + "?" + canonicalQuery(url.Values{}, params)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawQuery = canonicalQuery(u.Query(), params)
+	return u.String()
+}
+
+// canonicalQuery merges params into query and encodes the result with keys
+// and values sorted.
+func canonicalQuery(query url.Values, params map[string]string) string {
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	return query.Encode()
+}
+
+// cachedResponse returns the cached response for key if it is still fresh,
+// with an Age header telling how long ago it was stored.
+// A positive maxAge further restricts how old an acceptable entry may be.
+func (proxy *TDXProxy) cachedResponse(key string, maxAge time.Duration) (*http.Response, bool) {
+	settings := proxy.settings()
+	if settings.cache == nil {
+		return nil, false
+	}
+	entry, ok := settings.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	ttl := settings.cacheTTL
+	if entry.TTL > 0 {
+		ttl = entry.TTL
+	}
+	age := proxy.clock.Now().Sub(entry.StoredAt)
+	if age >= ttl {
+		settings.cache.Delete(key)
+		return nil, false
+	}
+	if maxAge > 0 && age > maxAge {
+		return nil, false
+	}
+	resp := entry.response()
+	resp.Header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	return resp, true
+}
+
+// storeResponse reads the body of resp into the cache and replaces it with a
+// reader over the buffered bytes, so the caller can still consume it.
+func (proxy *TDXProxy) storeResponse(key string, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	settings := proxy.settings()
+	if settings.cache == nil {
+		return nil
+	}
+	entry := &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   proxy.clock.Now(),
+	}
+	if settings.negativeTTL > 0 && isEmptyResult(body) {
+		entry.TTL = settings.negativeTTL
+	}
+	settings.cache.Set(key, entry)
+	return nil
+}
+
+// storeNegative caches a 404 answer for the negative cache TTL, if enabled.
+func (proxy *TDXProxy) storeNegative(key string, statusErr *StatusError) {
+	settings := proxy.settings()
+	if settings.cache == nil || settings.negativeTTL <= 0 || statusErr.StatusCode != http.StatusNotFound || statusErr.Truncated {
+		return
+	}
+	settings.cache.Set(key, &CacheEntry{
+		StatusCode: statusErr.StatusCode,
+		Header:     statusErr.Header.Clone(),
+		Body:       statusErr.Body,
+		StoredAt:   proxy.clock.Now(),
+		TTL:        settings.negativeTTL,
+	})
+}
+
+// isEmptyResult reports whether body is a TDX response without records.
+func isEmptyResult(body []byte) bool {
+	records, err := DecodeRecords(body)
+	return err == nil && len(records) == 0
+}
@@ -0,0 +1,160 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Serializer encodes cache entries for caches that store bytes, such as one
+// backed by Redis. Implementations must be safe for concurrent use.
+type Serializer interface {
+	Marshal(entry *CacheEntry) ([]byte, error)
+	Unmarshal(data []byte) (*CacheEntry, error)
+}
+
+// ByteStore is a key-value store of encoded cache entries, the part of a
+// cache backend left once a Serializer does the encoding.
+type ByteStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// JSONSerializer encodes entries as JSON. It is the most portable encoding,
+// but base64-encodes bodies, a third larger than they are.
+type JSONSerializer struct{}
+
+func (JSONSerializer) Marshal(entry *CacheEntry) ([]byte, error) {
+	return json.Marshal(entry)
+}
+
+func (JSONSerializer) Unmarshal(data []byte) (*CacheEntry, error) {
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GobSerializer encodes entries with encoding/gob, which stores bodies as
+// they are.
+type GobSerializer struct{}
+
+func (GobSerializer) Marshal(entry *CacheEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobSerializer) Unmarshal(data []byte) (*CacheEntry, error) {
+	var entry CacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CompressedSerializer compresses the output of another serializer with
+// DEFLATE. TDX responses are repetitive JSON and typically shrink five- to
+// tenfold, at some CPU cost on every cache read and write.
+type CompressedSerializer struct {
+	Serializer Serializer
+	// Level is a compress/flate level; 0 means flate.DefaultCompression.
+	Level int
+}
+
+func (s CompressedSerializer) Marshal(entry *CacheEntry) ([]byte, error) {
+	data, err := s.Serializer.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	level := s.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s CompressedSerializer) Unmarshal(data []byte) (*CacheEntry, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress cache entry: %w", err)
+	}
+	return s.Serializer.Unmarshal(decompressed)
+}
+
+// SerializedCache is a Cache that stores entries in a ByteStore, encoded by
+// a Serializer. Entries that fail to decode, e.g. ones written with another
+// serializer, are treated as missing and deleted.
+type SerializedCache struct {
+	store      ByteStore
+	serializer Serializer
+	logger     *slog.Logger
+}
+
+// NewSerializedCache creates a cache storing entries in store, encoded by
+// serializer, or by JSONSerializer if serializer is nil.
+func NewSerializedCache(store ByteStore, serializer Serializer, logger *slog.Logger) *SerializedCache {
+	if serializer == nil {
+		serializer = JSONSerializer{}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SerializedCache{store: store, serializer: serializer, logger: logger}
+}
+
+func (c *SerializedCache) Get(key string) (*CacheEntry, bool) {
+	data, ok := c.store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry, err := c.serializer.Unmarshal(data)
+	if err != nil {
+		c.logger.Warn("Dropping undecodable cache entry", slog.String("key", key), slog.String("error", err.Error()))
+		c.store.Delete(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *SerializedCache) Set(key string, entry *CacheEntry) {
+	data, err := c.serializer.Marshal(entry)
+	if err != nil {
+		c.logger.Warn("Failed to encode cache entry", slog.String("key", key), slog.String("error", err.Error()))
+		return
+	}
+	c.store.Set(key, data)
+}
+
+func (c *SerializedCache) Delete(key string) {
+	c.store.Delete(key)
+}
+
+// Flush flushes the store if it buffers writes, see FlushingCache.
+func (c *SerializedCache) Flush() error {
+	if store, ok := c.store.(interface{ Flush() error }); ok {
+		return store.Flush()
+	}
+	return nil
+}
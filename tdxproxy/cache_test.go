@@ -0,0 +1,88 @@
+package tdxproxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheSeparatesAccept(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if strings.Contains(r.Header.Get("Accept"), "xml") {
+			w.Header().Set("Content-Type", "application/xml")
+			io.WriteString(w, "<Routes/>")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "[]")
+	}))
+	defer server.Close()
+
+	proxy := NewTDXProxyNoAuth(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.SetBaseURL(server.URL + "/")
+	proxy.SetCache(NewMemoryCache(), time.Minute)
+
+	fetch := func(opts ...RequestOption) string {
+		t.Helper()
+		resp, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	for range 2 {
+		if body := fetch(); body != "[]" {
+			t.Errorf("JSON request got %q", body)
+		}
+		if body := fetch(Accept("application/xml")); body != "<Routes/>" {
+			t.Errorf("XML request got %q", body)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("made %d requests, want one per representation", n)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	proxy := NewTDXProxyNoAuth(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	const route = "https://tdx.transportdata.tw/api/basic/v2/Bus/Route/City/Taipei"
+	tests := []struct {
+		name     string
+		a, b     string
+		pa, pb   map[string]string
+		wantSame bool
+	}{
+		{"parameter order", route + "?$top=1&$format=JSON", route + "?$format=JSON&$top=1", nil, nil, true},
+		{"query and params", route + "?$top=1", route, nil, map[string]string{"$top": "1"}, true},
+		{"host case", "https://TDX.TransportData.TW/api/basic/v2/Bus/Route/City/Taipei", route, nil, nil, true},
+		{"default port", "https://tdx.transportdata.tw:443/api/basic/v2/Bus/Route/City/Taipei", route, nil, nil, true},
+		{"fragment", route + "#top", route, nil, nil, true},
+		{"relative path", "v2/Bus/Route/City/Taipei", route, nil, nil, true},
+		{"other port", "https://tdx.transportdata.tw:8443/api/basic/v2/Bus/Route/City/Taipei", route, nil, nil, false},
+		{"format", route, route, map[string]string{"$format": "JSON"}, map[string]string{"$format": "XML"}, false},
+		{"format omitted", route, route, map[string]string{"$format": "JSON"}, nil, false},
+		{"parameter value", route, route, map[string]string{"$top": "1"}, map[string]string{"$top": "2"}, false},
+		{"path case", "https://tdx.transportdata.tw/api/basic/v2/Bus/Route/City/taipei", route, nil, nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := proxy.cacheKey(tc.a, tc.pa), proxy.cacheKey(tc.b, tc.pb)
+			if (a == b) != tc.wantSame {
+				t.Errorf("keys %q and %q: same = %v, want %v", a, b, a == b, tc.wantSame)
+			}
+		})
+	}
+}
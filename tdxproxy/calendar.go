@@ -0,0 +1,173 @@
+package tdxproxy
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DayType is the kind of service day a date falls on, which decides whether
+// weekday, weekend or holiday timetables apply.
+type DayType int
+
+const (
+	// ServiceWeekday covers Monday to Friday and make-up workdays (補行上班) on weekends.
+	ServiceWeekday DayType = iota
+	// ServiceWeekend is a Saturday or Sunday that is not a public holiday.
+	ServiceWeekend
+	// ServiceHoliday is a public holiday, including adjusted and compensatory days off.
+	ServiceHoliday
+)
+
+func (t DayType) String() string {
+	switch t {
+	case ServiceWeekend:
+		return "weekend"
+	case ServiceHoliday:
+		return "holiday"
+	}
+	return "weekday"
+}
+
+// taipei is Taiwan time, which has no daylight saving time.
+var taipei = time.FixedZone("Asia/Taipei", 8*60*60)
+
+//go:embed holidays.csv
+var embeddedHolidays string
+
+// HolidayCalendar knows the public holidays and make-up workdays of Taiwan.
+// Dates it does not list follow the regular week: Monday to Friday are
+// weekdays, Saturday and Sunday are weekend days.
+type HolidayCalendar struct {
+	days  map[string]calendarDay
+	first time.Time
+	last  time.Time
+}
+
+type calendarDay struct {
+	holiday bool
+	note    string
+}
+
+// LoadHolidayCalendar reads a calendar in the CSV layout of the government
+// office calendar published on data.gov.tw (政府行政機關辦公日曆表): a header row,
+// then the date as YYYYMMDD, the weekday (optional), the status with 2 for a day
+// off and 0 for a working day, and a note. Files listing only exceptions are
+// accepted as well, with the columns date, status and note.
+func LoadHolidayCalendar(r io.Reader) (*HolidayCalendar, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holiday calendar: %w", err)
+	}
+	if len(rows) < 2 {
+		return nil, errors.New("holiday calendar is empty")
+	}
+
+	calendar := &HolidayCalendar{days: make(map[string]calendarDay)}
+	for i, row := range rows[1:] {
+		if len(row) == 4 {
+			// The official layout has a weekday column before the status.
+			row = []string{row[0], row[2], row[3]}
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("holiday calendar row %d: too few columns", i+2)
+		}
+		date, err := time.ParseInLocation("20060102", strings.TrimSpace(strings.TrimPrefix(row[0], "\ufeff")), taipei)
+		if err != nil {
+			return nil, fmt.Errorf("holiday calendar row %d: %w", i+2, err)
+		}
+		day := calendarDay{holiday: strings.TrimSpace(row[1]) == "2"}
+		if len(row) > 2 {
+			day.note = strings.TrimSpace(row[2])
+		}
+		calendar.days[date.Format("20060102")] = day
+		if calendar.first.IsZero() || date.Before(calendar.first) {
+			calendar.first = date
+		}
+		if date.After(calendar.last) {
+			calendar.last = date
+		}
+	}
+	return calendar, nil
+}
+
+var (
+	defaultCalendarMu sync.RWMutex
+	defaultCalendar   *HolidayCalendar
+)
+
+// DefaultHolidayCalendar returns the calendar used by ServiceDayType. Unless
+// replaced with SetHolidayCalendar, it is the calendar embedded in the package,
+// which covers 2024 to 2026.
+func DefaultHolidayCalendar() *HolidayCalendar {
+	defaultCalendarMu.RLock()
+	calendar := defaultCalendar
+	defaultCalendarMu.RUnlock()
+	if calendar != nil {
+		return calendar
+	}
+
+	defaultCalendarMu.Lock()
+	defer defaultCalendarMu.Unlock()
+	if defaultCalendar == nil {
+		calendar, err := LoadHolidayCalendar(strings.NewReader(embeddedHolidays))
+		if err != nil {
+			panic("tdxproxy: invalid embedded holiday calendar: " + err.Error())
+		}
+		defaultCalendar = calendar
+	}
+	return defaultCalendar
+}
+
+// SetHolidayCalendar replaces the default calendar, e.g. with a newer file
+// downloaded from data.gov.tw or one including typhoon days off.
+func SetHolidayCalendar(calendar *HolidayCalendar) {
+	defaultCalendarMu.Lock()
+	defer defaultCalendarMu.Unlock()
+	defaultCalendar = calendar
+}
+
+// ServiceDayType returns the service day type of date in Taiwan time, using the
+// default calendar.
+func ServiceDayType(date time.Time) DayType {
+	return DefaultHolidayCalendar().ServiceDayType(date)
+}
+
+// ServiceDayType returns the service day type of date in Taiwan time.
+func (c *HolidayCalendar) ServiceDayType(date time.Time) DayType {
+	date = date.In(taipei)
+	if day, ok := c.days[date.Format("20060102")]; ok {
+		if day.holiday {
+			return ServiceHoliday
+		}
+		return ServiceWeekday
+	}
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return ServiceWeekend
+	}
+	return ServiceWeekday
+}
+
+// Holiday returns the note of a listed public holiday, such as "中秋節", and
+// whether date is one.
+func (c *HolidayCalendar) Holiday(date time.Time) (string, bool) {
+	day, ok := c.days[date.In(taipei).Format("20060102")]
+	if !ok || !day.holiday {
+		return "", false
+	}
+	return day.note, true
+}
+
+// Covers reports whether date lies within the years the calendar lists. Outside
+// them, holidays are unknown and only the regular week is applied.
+func (c *HolidayCalendar) Covers(date time.Time) bool {
+	year := date.In(taipei).Year()
+	return year >= c.first.Year() && year <= c.last.Year()
+}
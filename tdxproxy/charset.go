@@ -0,0 +1,194 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CharsetDecoder returns a reader converting r from charset to UTF-8. charset
+// is the lowercased charset parameter of the response's Content-Type. A
+// decoder from golang.org/x/text can be adapted to it:
+//
+//	proxy.SetCharsetDecoder(func(charset string, r io.Reader) (io.Reader, error) {
+//		enc, err := htmlindex.Get(charset)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return enc.NewDecoder().Reader(r), nil
+//	})
+type CharsetDecoder func(charset string, r io.Reader) (io.Reader, error)
+
+// SetAccept sets the Accept header sent with each request that does not set
+// its own, e.g. "application/json". The empty string sends none, leaving the
+// format to the $format parameter. Responses are cached separately for each
+// Accept header, so JSON and XML representations of a URL never mix.
+func (proxy *TDXProxy) SetAccept(accept string) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.accept = accept
+}
+
+// requestAccept returns the Accept header a request is sent with: the one in
+// headers, else the one set by the Accept option or SetAccept.
+func (proxy *TDXProxy) requestAccept(headers map[string]string, options *requestOptions) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "Accept") {
+			return v
+		}
+	}
+	if options.accept != "" {
+		return options.accept
+	}
+	return proxy.settings().accept
+}
+
+// SetForceJSON makes GET requests whose parameters lack $format ask for
+// $format=JSON, as requests without parameters always do, so that the decode
+// helpers never see an endpoint's default XML. A $format passed explicitly is
+// kept; decoding such a response fails with ErrNotJSON.
+func (proxy *TDXProxy) SetForceJSON(force bool) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.forceJSON = force
+}
+
+// SetCharsetDecoder sets the decoder for response charsets the proxy does not
+// convert itself. Responses declaring a charset other than UTF-8 are converted
+// to UTF-8 before they are returned or cached, and their Content-Type is
+// changed to say so. ISO-8859-1, Windows-1252 and UTF-16 are built in; other
+// charsets, such as Big5, need a decoder. Passing nil leaves only the built-in ones.
+func (proxy *TDXProxy) SetCharsetDecoder(decoder CharsetDecoder) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.charsets = decoder
+}
+
+// transcodeBody converts the body of resp to UTF-8 if its Content-Type
+// declares another charset. Bodies in unknown charsets are left unchanged,
+// with a warning.
+func (proxy *TDXProxy) transcodeBody(ctx context.Context, url string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	charset := strings.ToLower(strings.TrimSpace(params["charset"]))
+	if isUTF8Charset(charset) {
+		return nil
+	}
+
+	var body io.Reader
+	if decoder := proxy.settings().charsets; decoder != nil {
+		body, err = decoder(charset, resp.Body)
+	}
+	if decoder := builtinCharsets[charset]; body == nil && decoder != nil {
+		data, readErr := io.ReadAll(resp.Body)
+		if readErr != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to read response body: %w", readErr)
+		}
+		body, err = bytes.NewReader(decoder(data)), nil
+	}
+	if body == nil {
+		attrs := []slog.Attr{slog.String("url", url), slog.String("charset", charset)}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		proxy.log(ctx, slog.LevelWarn, "Unsupported response charset, body left unchanged", attrs...)
+		return nil
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}
+	params["charset"] = "utf-8"
+	resp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+func isUTF8Charset(charset string) bool {
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// builtinCharsets convert whole bodies to UTF-8. ISO-8859-1 is decoded as
+// Windows-1252, its superset, as browsers do, since servers often mislabel one
+// as the other.
+var builtinCharsets = map[string]func([]byte) []byte{
+	"iso-8859-1":   decodeWindows1252,
+	"iso8859-1":    decodeWindows1252,
+	"latin1":       decodeWindows1252,
+	"windows-1252": decodeWindows1252,
+	"cp1252":       decodeWindows1252,
+	"utf-16":       func(b []byte) []byte { return decodeUTF16(b, false) },
+	"utf-16be":     func(b []byte) []byte { return decodeUTF16(b, false) },
+	"utf-16le":     func(b []byte) []byte { return decodeUTF16(b, true) },
+}
+
+// windows1252 maps the bytes 0x80 to 0x9F, where Windows-1252 differs from
+// ISO-8859-1. Unassigned bytes keep their ISO-8859-1 control characters.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func decodeWindows1252(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/4)
+	for _, b := range data {
+		switch {
+		case b < utf8.RuneSelf:
+			out = append(out, b)
+		case b >= 0x80 && b <= 0x9F:
+			out = utf8.AppendRune(out, windows1252[b-0x80])
+		default:
+			out = utf8.AppendRune(out, rune(b))
+		}
+	}
+	return out
+}
+
+// decodeUTF16 decodes UTF-16 in the byte order given by a leading byte order
+// mark, or else little-endian if littleEndian is set and big-endian otherwise.
+// Unpaired surrogates and a trailing odd byte become U+FFFD.
+func decodeUTF16(data []byte, littleEndian bool) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		data, littleEndian = data[2:], false
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		data, littleEndian = data[2:], true
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		hi, lo := data[2*i], data[2*i+1]
+		if littleEndian {
+			hi, lo = lo, hi
+		}
+		units[i] = uint16(hi)<<8 | uint16(lo)
+	}
+	out := make([]byte, 0, len(data))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+	if len(data)%2 != 0 {
+		out = utf8.AppendRune(out, utf8.RuneError)
+	}
+	return out
+}
@@ -0,0 +1,27 @@
+package tdxproxy
+
+// Cities lists the city codes TDX uses in city-scoped paths such as v2/Bus/Route/City/{City}.
+var Cities = []string{
+	"Taipei",
+	"NewTaipei",
+	"Taoyuan",
+	"Taichung",
+	"Tainan",
+	"Kaohsiung",
+	"Keelung",
+	"Hsinchu",
+	"HsinchuCounty",
+	"MiaoliCounty",
+	"ChanghuaCounty",
+	"NantouCounty",
+	"YunlinCounty",
+	"ChiayiCounty",
+	"Chiayi",
+	"PingtungCounty",
+	"YilanCounty",
+	"HualienCounty",
+	"TaitungCounty",
+	"KinmenCounty",
+	"PenghuCounty",
+	"LienchiangCounty",
+}
@@ -0,0 +1,104 @@
+package tdxproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so token expiry, retry sleeps and cache TTLs can be
+// driven deterministically in tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock that only moves when Advance or Set is called.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, manualWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, releasing any After calls that become due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(c.now.Add(d))
+}
+
+// Set moves the clock to t, releasing any After calls that become due.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(t)
+}
+
+func (c *ManualClock) setLocked(t time.Time) {
+	c.now = t
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.deadline.After(t) {
+			w.ch <- t
+			continue
+		}
+		pending = append(pending, w)
+	}
+	c.waiters = pending
+}
+
+// SetClock replaces the clock used for token expiry, retry sleeps, cache TTLs
+// and the quarantine of pooled credentials. Unlike the other setters it must
+// be called before the proxy is in use.
+func (proxy *TDXProxy) SetClock(clock Clock) {
+	if clock == nil {
+		proxy.logger.Warn("Nil clock provided")
+		return
+	}
+	proxy.clock = clock
+	if proxy.credentials != nil {
+		proxy.credentials.setClock(clock)
+	}
+}
+
+// sleep waits for d on the proxy's clock, returning early if ctx is done.
+func (proxy *TDXProxy) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-proxy.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,50 @@
+package tdxproxy
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// SetMaxConcurrency caps the number of simultaneous outbound TDX requests at n.
+// Requests over the limit wait for a free slot or for their context to end.
+// A slot is held until the response body is closed. n <= 0 removes the limit.
+//
+// The limit applies to requests started after the call; requests already
+// holding a slot release it to the semaphore they acquired it from.
+func (proxy *TDXProxy) SetMaxConcurrency(n int) {
+	var sem chan struct{}
+	if n > 0 {
+		sem = make(chan struct{}, n)
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.inflight = sem
+}
+
+// acquireSlot waits for a slot of the semaphore sem, which may be nil for no
+// limit, and returns the function releasing it.
+func acquireSlot(ctx context.Context, sem chan struct{}) (func(), error) {
+	if sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-sem }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releaseOnClose releases an in-flight slot when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,255 @@
+package tdxproxy
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the proxy settings commonly set from configuration files or
+// the environment. The zero value of a field keeps the proxy's default.
+type Config struct {
+	// BaseURL replaces TDX_URL_BASIC, e.g. for a mock server.
+	BaseURL string
+	// Credentials are used directly, or CredentialFile is read if there are
+	// none. Without either the proxy is unauthenticated.
+	Credentials    []Credential
+	CredentialFile string
+	// CacheTTL enables an in-memory cache; NegativeCacheTTL also keeps 404
+	// and empty responses, see SetNegativeCacheTTL.
+	CacheTTL         time.Duration
+	NegativeCacheTTL time.Duration
+	// MaxAttempts and RetryDelay replace the default retry policy of three
+	// attempts a second apart.
+	MaxAttempts int
+	RetryDelay  time.Duration
+	// RateLimit caps outbound requests per second, with bursts of Burst.
+	RateLimit float64
+	Burst     int
+	// MaxConcurrency and MaxBodySize, see SetMaxConcurrency and SetMaxBodySize.
+	MaxConcurrency int
+	MaxBodySize    int64
+}
+
+// maxConfigAttempts is the most attempts Validate accepts; more only delay
+// the error of a request that keeps failing.
+const maxConfigAttempts = 10
+
+// ConfigProblem is one invalid setting found by Config.Validate.
+type ConfigProblem struct {
+	// Field is the Config field, or the environment variable for settings
+	// read by ConfigFromEnv.
+	Field   string
+	Value   string
+	Message string
+}
+
+// ConfigError lists every problem of a configuration, so that they can all
+// be fixed at once.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s=%q: %s", p.Field, p.Value, p.Message)
+	}
+	return b.String()
+}
+
+func (e *ConfigError) add(field, value, message string, args ...any) {
+	e.Problems = append(e.Problems, ConfigProblem{Field: field, Value: value, Message: fmt.Sprintf(message, args...)})
+}
+
+func (e *ConfigError) err() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate checks every setting and returns a *ConfigError listing all the
+// problems found, or nil. The credential file is read to check its format.
+func (c Config) Validate() error {
+	_, err := c.validate()
+	return err
+}
+
+// validate is Validate, returning the credentials to use as well.
+func (c Config) validate() ([]Credential, error) {
+	problems := &ConfigError{}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		switch {
+		case err != nil:
+			problems.add("BaseURL", c.BaseURL, "not a URL: %v", err)
+		case u.Scheme != "http" && u.Scheme != "https" || u.Host == "":
+			problems.add("BaseURL", c.BaseURL, "must be an absolute http or https URL, such as %s", TDX_URL_BASIC)
+		case !strings.HasSuffix(u.Path, "/"):
+			problems.add("BaseURL", c.BaseURL, "must end with a slash, as TDX paths are appended to it")
+		}
+	}
+
+	credentials := c.Credentials
+	if len(credentials) == 0 && c.CredentialFile != "" {
+		var err error
+		if credentials, err = LoadCredentials(c.CredentialFile); err != nil {
+			problems.add("CredentialFile", c.CredentialFile, "cannot be read: %v", err)
+		}
+	}
+	for i, credential := range credentials {
+		if credential.AppID == "" || credential.AppKey == "" {
+			problems.add("Credentials", credential.AppID, "credential %d needs both app_id and app_key", i+1)
+		}
+	}
+
+	durations := []struct {
+		field string
+		value time.Duration
+	}{
+		{"CacheTTL", c.CacheTTL},
+		{"NegativeCacheTTL", c.NegativeCacheTTL},
+		{"RetryDelay", c.RetryDelay},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			problems.add(d.field, d.value.String(), "must not be negative; use 0 for the default")
+		}
+	}
+	if c.NegativeCacheTTL > 0 && c.CacheTTL <= 0 {
+		problems.add("NegativeCacheTTL", c.NegativeCacheTTL.String(), "has no effect without CacheTTL")
+	}
+	if c.MaxAttempts < 0 || c.MaxAttempts > maxConfigAttempts {
+		problems.add("MaxAttempts", strconv.Itoa(c.MaxAttempts), "must be between 1 and %d, or 0 for the default", maxConfigAttempts)
+	}
+	if c.RetryDelay > 0 && c.MaxAttempts == 1 {
+		problems.add("RetryDelay", c.RetryDelay.String(), "has no effect with MaxAttempts 1")
+	}
+	if c.RateLimit < 0 {
+		problems.add("RateLimit", strconv.FormatFloat(c.RateLimit, 'f', -1, 64), "must not be negative; use 0 for no limit")
+	}
+	if c.Burst < 0 {
+		problems.add("Burst", strconv.Itoa(c.Burst), "must not be negative")
+	}
+	if c.MaxConcurrency < 0 {
+		problems.add("MaxConcurrency", strconv.Itoa(c.MaxConcurrency), "must not be negative; use 0 for no limit")
+	}
+	if c.MaxBodySize < 0 {
+		problems.add("MaxBodySize", strconv.FormatInt(c.MaxBodySize, 10), "must not be negative; use 0 for no limit")
+	}
+	return credentials, problems.err()
+}
+
+// configEnv maps the environment variables read by ConfigFromEnv to the
+// Config fields they set.
+var configEnv = []struct {
+	name, field string
+}{
+	{"TDX_BASE_URL", "BaseURL"},
+	{"TDX_CREDENTIALS_FILE", "CredentialFile"},
+	{"TDX_CACHE_TTL", "CacheTTL"},
+	{"TDX_NEGATIVE_CACHE_TTL", "NegativeCacheTTL"},
+	{"TDX_MAX_ATTEMPTS", "MaxAttempts"},
+	{"TDX_RETRY_DELAY", "RetryDelay"},
+	{"TDX_RATE_LIMIT", "RateLimit"},
+	{"TDX_BURST", "Burst"},
+	{"TDX_MAX_CONCURRENCY", "MaxConcurrency"},
+	{"TDX_MAX_BODY_SIZE", "MaxBodySize"},
+}
+
+// ConfigFromEnv reads a Config from the environment variables TDX_BASE_URL,
+// TDX_CREDENTIALS_FILE, TDX_CACHE_TTL, TDX_NEGATIVE_CACHE_TTL,
+// TDX_MAX_ATTEMPTS, TDX_RETRY_DELAY, TDX_RATE_LIMIT, TDX_BURST,
+// TDX_MAX_CONCURRENCY and TDX_MAX_BODY_SIZE, and validates it. Durations are
+// written like "30s" or "5m". The error, a *ConfigError, names the
+// variables of every problem.
+func ConfigFromEnv() (Config, error) {
+	var config Config
+	problems := &ConfigError{}
+	for _, env := range configEnv {
+		value := os.Getenv(env.name)
+		if value == "" {
+			continue
+		}
+		var err error
+		switch env.field {
+		case "BaseURL":
+			config.BaseURL = value
+		case "CredentialFile":
+			config.CredentialFile = value
+		case "CacheTTL":
+			config.CacheTTL, err = time.ParseDuration(value)
+		case "NegativeCacheTTL":
+			config.NegativeCacheTTL, err = time.ParseDuration(value)
+		case "RetryDelay":
+			config.RetryDelay, err = time.ParseDuration(value)
+		case "MaxAttempts":
+			config.MaxAttempts, err = strconv.Atoi(value)
+		case "RateLimit":
+			config.RateLimit, err = strconv.ParseFloat(value, 64)
+		case "Burst":
+			config.Burst, err = strconv.Atoi(value)
+		case "MaxConcurrency":
+			config.MaxConcurrency, err = strconv.Atoi(value)
+		case "MaxBodySize":
+			config.MaxBodySize, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			problems.add(env.name, value, "cannot be parsed: %v", err)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		for _, p := range err.(*ConfigError).Problems {
+			for _, env := range configEnv {
+				if env.field == p.Field {
+					p.Field = env.name
+				}
+			}
+			problems.Problems = append(problems.Problems, p)
+		}
+	}
+	return config, problems.err()
+}
+
+// NewTDXProxyFromConfig validates config and creates a proxy from it. An
+// invalid config returns a *ConfigError listing every problem, rather than a
+// proxy with the invalid settings ignored.
+func NewTDXProxyFromConfig(config Config, logger *slog.Logger) (*TDXProxy, error) {
+	credentials, err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := NewTDXProxyNoAuth(logger)
+	proxy.SetCredentials(credentials...)
+	if config.BaseURL != "" {
+		proxy.SetBaseURL(config.BaseURL)
+	}
+	if config.CacheTTL > 0 {
+		proxy.SetCache(NewMemoryCache(), config.CacheTTL)
+		proxy.SetNegativeCacheTTL(config.NegativeCacheTTL)
+	}
+	if config.MaxAttempts > 0 || config.RetryDelay > 0 {
+		policy := defaultRetryPolicy().(*StatusRetryPolicy)
+		if config.MaxAttempts > 0 {
+			policy.MaxAttempts = config.MaxAttempts
+		}
+		if config.RetryDelay > 0 {
+			policy.Backoff = ConstantBackoff{Delay: config.RetryDelay}
+		}
+		proxy.SetRetryPolicy(policy)
+	}
+	if config.RateLimit > 0 {
+		proxy.SetRateLimiter(NewTokenBucket(config.RateLimit, config.Burst))
+	}
+	proxy.SetMaxConcurrency(config.MaxConcurrency)
+	proxy.SetMaxBodySize(config.MaxBodySize)
+	return proxy, nil
+}
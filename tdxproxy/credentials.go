@@ -0,0 +1,252 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Credential is one TDX client ID and secret.
+type Credential struct {
+	AppID  string `json:"app_id"`
+	AppKey string `json:"app_key"`
+}
+
+// CredentialHealth reports how a pooled credential has been doing.
+type CredentialHealth struct {
+	AppID string
+	// Requests counts attempts sent with the credential, Errors the ones that
+	// failed and Unauthorized the ones TDX answered with 401 or 403.
+	Requests     int64
+	Errors       int64
+	Unauthorized int64
+	// AuthFailures counts token requests TDX rejected.
+	AuthFailures int64
+	// ErrorRate is a moving average, between 0 and 1, of recent failures
+	// owed to the credential: 401, 403 and 429 responses.
+	ErrorRate float64
+	// TokenExpiry is when the credential's token is replaced, zero if it has none.
+	TokenExpiry      time.Time
+	Quarantined      bool
+	QuarantinedUntil time.Time
+}
+
+type pooledCredential struct {
+	Credential
+	token   string
+	expires int64
+
+	requests, errors, unauthorized, authFailures int64
+	errorRate                                    float64
+	// strikes counts consecutive credential failures: 401s, 403s and
+	// rejected token requests.
+	strikes          int
+	quarantinedUntil time.Time
+}
+
+// CredentialPool spreads requests over several credentials in turn and
+// quarantines credentials that keep failing, e.g. because a key was revoked,
+// until quarantine runs out.
+//
+// A credential is quarantined after three consecutive 401, 403 or rejected
+// token responses, or once at least ten requests were made with it and its
+// rate of 401, 403 and 429 responses exceeds 80%. Network errors, 5xx and
+// other statuses, of data and token requests alike, are not counted, so an
+// outage of TDX does not quarantine every credential.
+// If every credential is quarantined, the one whose quarantine ends first is
+// still used, so requests degrade instead of stopping.
+type CredentialPool struct {
+	mu         sync.Mutex
+	entries    []*pooledCredential
+	next       int
+	quarantine time.Duration
+	clock      Clock
+	logger     *slog.Logger
+}
+
+func NewCredentialPool(credentials []Credential, logger *slog.Logger) *CredentialPool {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	pool := &CredentialPool{
+		quarantine: 5 * time.Minute,
+		clock:      systemClock{},
+		logger:     logger,
+	}
+	for _, c := range credentials {
+		pool.entries = append(pool.entries, &pooledCredential{Credential: c})
+	}
+	return pool
+}
+
+// setClock makes the pool use the clock of the proxy it is attached to.
+func (pool *CredentialPool) setClock(clock Clock) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.clock = clock
+}
+
+// SetQuarantine sets how long a failing credential is left out. The default is 5 minutes.
+func (pool *CredentialPool) SetQuarantine(d time.Duration) {
+	if d <= 0 {
+		pool.logger.Warn("Non-positive quarantine provided", slog.Duration("quarantine", d))
+		return
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.quarantine = d
+}
+
+// Health returns the state of every credential in pool order.
+func (pool *CredentialPool) Health() []CredentialHealth {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := pool.clock.Now()
+	health := make([]CredentialHealth, len(pool.entries))
+	for i, c := range pool.entries {
+		health[i] = CredentialHealth{
+			AppID:            c.AppID,
+			Requests:         c.requests,
+			Errors:           c.errors,
+			Unauthorized:     c.unauthorized,
+			AuthFailures:     c.authFailures,
+			ErrorRate:        c.errorRate,
+			TokenExpiry:      tokenExpiry(c),
+			Quarantined:      now.Before(c.quarantinedUntil),
+			QuarantinedUntil: c.quarantinedUntil,
+		}
+	}
+	return health
+}
+
+func tokenExpiry(c *pooledCredential) time.Time {
+	if c.token == "" {
+		return time.Time{}
+	}
+	return time.Unix(c.expires, 0)
+}
+
+func (pool *CredentialPool) size() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return len(pool.entries)
+}
+
+// acquire picks the next healthy credential in turn.
+func (pool *CredentialPool) acquire() *pooledCredential {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.entries) == 0 {
+		return nil
+	}
+	now := pool.clock.Now()
+	var fallback *pooledCredential
+	for range pool.entries {
+		c := pool.entries[pool.next]
+		pool.next = (pool.next + 1) % len(pool.entries)
+		if !now.Before(c.quarantinedUntil) {
+			return c
+		}
+		if fallback == nil || c.quarantinedUntil.Before(fallback.quarantinedUntil) {
+			fallback = c
+		}
+	}
+	return fallback
+}
+
+// token returns a valid token of c, fetching a new one with proxy if needed.
+func (pool *CredentialPool) token(ctx context.Context, proxy *TDXProxy, c *pooledCredential, timeout time.Duration) (string, error) {
+	pool.mu.Lock()
+	token, expires := c.token, c.expires
+	pool.mu.Unlock()
+	if token != "" && pool.clock.Now().Unix() <= expires {
+		return token, nil
+	}
+
+	token, expires, err := proxy.fetchToken(ctx, c.AppID, c.AppKey, timeout)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			c.authFailures++
+			pool.strike(c)
+		}
+		return "", err
+	}
+	c.token, c.expires = token, expires
+	return token, nil
+}
+
+// invalidate drops c's token so the next use fetches a new one.
+func (pool *CredentialPool) invalidate(c *pooledCredential) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	c.token = ""
+}
+
+// invalidateAll drops every cached token.
+func (pool *CredentialPool) invalidateAll() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	for _, c := range pool.entries {
+		c.token = ""
+	}
+}
+
+// report records the outcome of an attempt made with c: its response, nil if
+// it failed without one, and whether it succeeded. Only successes and
+// failures owed to the credential move its error rate.
+func (pool *CredentialPool) report(c *pooledCredential, resp *http.Response, success bool) {
+	if c == nil {
+		return
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	c.requests++
+	if !success {
+		c.errors++
+	}
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	rejected := status == http.StatusUnauthorized || status == http.StatusForbidden
+	blamed := rejected || status == http.StatusTooManyRequests
+	switch {
+	case success:
+		c.errorRate *= 0.8
+		c.strikes = 0
+	case blamed:
+		c.errorRate = 0.8*c.errorRate + 0.2
+	}
+
+	switch {
+	case rejected:
+		c.unauthorized++
+		pool.strike(c)
+	case blamed && c.requests >= 10 && c.errorRate > 0.8:
+		pool.quarantineLocked(c, "error rate")
+	}
+}
+
+// strike counts a credential failure against c. pool.mu must be held.
+func (pool *CredentialPool) strike(c *pooledCredential) {
+	c.strikes++
+	if c.strikes >= 3 {
+		pool.quarantineLocked(c, "repeated auth failures")
+	}
+}
+
+func (pool *CredentialPool) quarantineLocked(c *pooledCredential, reason string) {
+	now := pool.clock.Now()
+	if now.Before(c.quarantinedUntil) {
+		return
+	}
+	c.quarantinedUntil = now.Add(pool.quarantine)
+	c.strikes = 0
+	c.token = ""
+	pool.logger.Warn("Credential quarantined", slog.String("app_id", c.AppID), slog.String("reason", reason), slog.Time("until", c.quarantinedUntil))
+}
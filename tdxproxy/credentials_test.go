@@ -0,0 +1,148 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPool(t *testing.T, n int) (*CredentialPool, *ManualClock) {
+	t.Helper()
+	var credentials []Credential
+	for i := range n {
+		credentials = append(credentials, Credential{AppID: string(rune('a' + i)), AppKey: "key"})
+	}
+	pool := NewCredentialPool(credentials, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clock := NewManualClock(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	pool.setClock(clock)
+	return pool, clock
+}
+
+func statusResponse(status int) *http.Response {
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody}
+}
+
+// acquired returns the IDs of the next n credentials the pool hands out.
+func acquired(pool *CredentialPool, n int) string {
+	var ids []string
+	for range n {
+		ids = append(ids, pool.acquire().AppID)
+	}
+	return strings.Join(ids, "")
+}
+
+func TestCredentialPoolQuarantine(t *testing.T) {
+	pool, clock := testPool(t, 2)
+	a := pool.entries[0]
+
+	for range 3 {
+		pool.report(a, statusResponse(http.StatusUnauthorized), false)
+	}
+	if got := acquired(pool, 4); got != "bbbb" {
+		t.Errorf("with a quarantined: acquired %q, want only b", got)
+	}
+	health := pool.Health()
+	if !health[0].Quarantined || health[0].Unauthorized != 3 || health[1].Quarantined {
+		t.Errorf("health after three 401s: %+v", health)
+	}
+
+	clock.Advance(5*time.Minute + time.Second)
+	if got := acquired(pool, 4); got != "abab" && got != "baba" {
+		t.Errorf("after quarantine: acquired %q, want both in turn", got)
+	}
+	if pool.Health()[0].Quarantined {
+		t.Error("a still quarantined after the quarantine ran out")
+	}
+}
+
+func TestCredentialPoolStrikesReset(t *testing.T) {
+	pool, _ := testPool(t, 1)
+	a := pool.entries[0]
+	for range 5 {
+		pool.report(a, statusResponse(http.StatusUnauthorized), false)
+		pool.report(a, statusResponse(http.StatusUnauthorized), false)
+		pool.report(a, statusResponse(http.StatusOK), true)
+	}
+	if pool.Health()[0].Quarantined {
+		t.Error("quarantined although no three 401s were consecutive")
+	}
+}
+
+func TestCredentialPoolFallback(t *testing.T) {
+	pool, clock := testPool(t, 3)
+	// b is quarantined first, so its quarantine ends first.
+	for _, i := range []int{1, 0, 2} {
+		for range 3 {
+			pool.report(pool.entries[i], statusResponse(http.StatusForbidden), false)
+		}
+		clock.Advance(time.Second)
+	}
+	if got := acquired(pool, 3); got != "bbb" {
+		t.Errorf("with every credential quarantined: acquired %q, want the one released first", got)
+	}
+}
+
+func TestCredentialPoolErrorRate(t *testing.T) {
+	pool, _ := testPool(t, 1)
+	a := pool.entries[0]
+	for range 20 {
+		pool.report(a, statusResponse(http.StatusTooManyRequests), false)
+	}
+	if health := pool.Health()[0]; !health.Quarantined || health.ErrorRate <= 0.8 {
+		t.Errorf("after twenty 429s: %+v", health)
+	}
+}
+
+func TestCredentialPoolOutage(t *testing.T) {
+	pool, _ := testPool(t, 2)
+	for range 50 {
+		for _, c := range pool.entries {
+			pool.report(c, statusResponse(http.StatusServiceUnavailable), false)
+			pool.report(c, nil, false)
+		}
+	}
+	for _, health := range pool.Health() {
+		if health.Quarantined || health.ErrorRate != 0 || health.Errors != 100 {
+			t.Errorf("after an outage: %+v", health)
+		}
+	}
+}
+
+// outageTDX issues tokens but answers API requests with 503.
+type outageTDX struct{ fakeTDX }
+
+func (o *outageTDX) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.String() == authURL {
+		return o.fakeTDX.RoundTrip(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader("<html>maintenance</html>")),
+		Request:    req,
+	}, nil
+}
+
+func TestCredentialPoolProxyOutage(t *testing.T) {
+	pool, _ := testPool(t, 2)
+	proxy := NewTDXProxyWithCredentialPool(pool, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.SetTransport(&outageTDX{})
+	proxy.SetRetryPolicy(NeverRetry)
+
+	for range 30 {
+		_, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0)
+		if !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("got %v, want ErrUnavailable", err)
+		}
+	}
+	for _, health := range pool.Health() {
+		if health.Quarantined || health.Requests != 15 {
+			t.Errorf("after an outage: %+v", health)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package tdxproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A dataset store file holds the records of a dataset and an index sorted by
+// key, so that records are found by binary search over the mapped file:
+//
+//	header   magic "TDXSTOR1", record count and index offset, uint64 each
+//	records  the JSON records, back to back
+//	index    per record, sorted by key: key offset, record offset (uint64),
+//	         key length and record length (uint32)
+//	keys     the keys, back to back
+//
+// Integers are little-endian.
+const (
+	datasetMagic      = "TDXSTOR1"
+	datasetHeaderSize = 24
+	datasetEntrySize  = 24
+)
+
+// DatasetStore is a read-only, indexed dataset memory-mapped from a file
+// written by BuildDatasetStore. Only the pages of the records looked up are
+// read into memory, and they stay in the page cache rather than the Go heap,
+// which suits large static datasets, such as every stop or shape nationwide,
+// on devices with little memory. On systems without mmap the file is read
+// into memory instead.
+//
+// A DatasetStore is safe for concurrent use until it is closed.
+type DatasetStore struct {
+	data  []byte
+	count int
+	index []byte
+	unmap func() error
+}
+
+type datasetIndexEntry struct {
+	key    string
+	offset uint64
+	length uint32
+}
+
+// BuildDatasetStore writes records to a dataset store file at path, indexed
+// by the top-level field keyField, such as "StopUID". Several records may
+// share a key, e.g. the directions of a route keyed by RouteUID. Records
+// without the field fail the build. The file is replaced atomically.
+func BuildDatasetStore(path string, records []json.RawMessage, keyField string) error {
+	entries := make([]datasetIndexEntry, len(records))
+	offset := uint64(datasetHeaderSize)
+	for i, record := range records {
+		key := recordKey(record, keyField)
+		if key == nil {
+			return fmt.Errorf("record %d has no %s field", i, keyField)
+		}
+		entries[i] = datasetIndexEntry{key: string(key), offset: offset, length: uint32(len(record))}
+		offset += uint64(len(record))
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dataset-*")
+	if err != nil {
+		return fmt.Errorf("failed to create dataset store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+
+	header := make([]byte, datasetHeaderSize)
+	copy(header, datasetMagic)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(records)))
+	binary.LittleEndian.PutUint64(header[16:], offset)
+	w.Write(header)
+	for _, record := range records {
+		w.Write(record)
+	}
+	keyOffset := offset + uint64(len(entries)*datasetEntrySize)
+	entry := make([]byte, datasetEntrySize)
+	for _, e := range entries {
+		binary.LittleEndian.PutUint64(entry[0:], keyOffset)
+		binary.LittleEndian.PutUint64(entry[8:], e.offset)
+		binary.LittleEndian.PutUint32(entry[16:], uint32(len(e.key)))
+		binary.LittleEndian.PutUint32(entry[20:], e.length)
+		w.Write(entry)
+		keyOffset += uint64(len(e.key))
+	}
+	for _, e := range entries {
+		w.WriteString(e.key)
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dataset store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dataset store: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// OpenDatasetStore maps a dataset store file written by BuildDatasetStore.
+func OpenDatasetStore(path string) (*DatasetStore, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset store: %w", err)
+	}
+	store, err := parseDatasetStore(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	store.unmap = unmap
+	return store, nil
+}
+
+func parseDatasetStore(data []byte) (*DatasetStore, error) {
+	if len(data) < datasetHeaderSize || string(data[:8]) != datasetMagic {
+		return nil, errors.New("not a dataset store")
+	}
+	count := binary.LittleEndian.Uint64(data[8:])
+	indexOffset := binary.LittleEndian.Uint64(data[16:])
+	if indexOffset > uint64(len(data)) || count > (uint64(len(data))-indexOffset)/datasetEntrySize {
+		return nil, errors.New("dataset store is truncated")
+	}
+	store := &DatasetStore{
+		data:  data,
+		count: int(count),
+		index: data[indexOffset : indexOffset+count*datasetEntrySize],
+	}
+	// Lookups slice the file by the offsets of the index, so a corrupt entry
+	// is reported here rather than panicking later.
+	size := uint64(len(data))
+	for i := range store.count {
+		e := store.entry(i)
+		keyOffset, keyLength := binary.LittleEndian.Uint64(e[0:]), uint64(binary.LittleEndian.Uint32(e[16:]))
+		recordOffset, recordLength := binary.LittleEndian.Uint64(e[8:]), uint64(binary.LittleEndian.Uint32(e[20:]))
+		if keyOffset > size || keyLength > size-keyOffset || recordOffset > size || recordLength > size-recordOffset {
+			return nil, fmt.Errorf("dataset store index entry %d is out of range", i)
+		}
+	}
+	return store, nil
+}
+
+// Len returns the number of records in the store.
+func (s *DatasetStore) Len() int {
+	return s.count
+}
+
+// Close unmaps the file. Records returned earlier remain valid.
+func (s *DatasetStore) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.unmap, s.data, s.index = nil, nil, nil
+	return err
+}
+
+// Lookup returns the records whose key is key, copied out of the file.
+func (s *DatasetStore) Lookup(key string) []json.RawMessage {
+	var records []json.RawMessage
+	for i := s.search(key); i < s.count && string(s.key(i)) == key; i++ {
+		records = append(records, bytes.Clone(s.record(i)))
+	}
+	return records
+}
+
+// Prefix calls fn for every record whose key starts with prefix, in key
+// order, until fn returns false. The record passed to fn points into the
+// mapped file and is only valid during the call; fn must copy what it keeps.
+func (s *DatasetStore) Prefix(prefix string, fn func(key string, record json.RawMessage) bool) {
+	for i := s.search(prefix); i < s.count; i++ {
+		key := s.key(i)
+		if !bytes.HasPrefix(key, []byte(prefix)) || !fn(string(key), s.record(i)) {
+			return
+		}
+	}
+}
+
+// LookupAs decodes the records of store whose key is key into T.
+func LookupAs[T any](store *DatasetStore, key string) ([]T, error) {
+	records := store.Lookup(key)
+	out := make([]T, len(records))
+	for i, record := range records {
+		if err := decodeRecord(i, record, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// search returns the index of the first entry whose key is not less than key.
+func (s *DatasetStore) search(key string) int {
+	return sort.Search(s.count, func(i int) bool { return string(s.key(i)) >= key })
+}
+
+func (s *DatasetStore) entry(i int) []byte {
+	return s.index[i*datasetEntrySize : (i+1)*datasetEntrySize]
+}
+
+// key returns the key of entry i, pointing into the mapped file.
+func (s *DatasetStore) key(i int) []byte {
+	e := s.entry(i)
+	offset := binary.LittleEndian.Uint64(e[0:])
+	return s.data[offset : offset+uint64(binary.LittleEndian.Uint32(e[16:]))]
+}
+
+func (s *DatasetStore) record(i int) json.RawMessage {
+	e := s.entry(i)
+	offset := binary.LittleEndian.Uint64(e[8:])
+	return s.data[offset : offset+uint64(binary.LittleEndian.Uint32(e[20:]))]
+}
@@ -0,0 +1,196 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultDebugBodyLimit caps the response body kept per recorded exchange
+// when SetDebugBuffer is given no limit.
+const defaultDebugBodyLimit = 64 << 10
+
+// RecordedExchange is a request the proxy sent and the response it got, as
+// kept by a DebugBuffer. Credentials, tokens and cookies are redacted.
+type RecordedExchange struct {
+	Time           time.Time   `json:"time"`
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"request_header"`
+	RequestBody    string      `json:"request_body,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	Body           string      `json:"body,omitempty"`
+	// BodySize is the size of the whole response body; Body holds at most
+	// the buffer's body limit of it.
+	BodySize  int64         `json:"body_size"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// DebugBuffer keeps the last requests a proxy sent with their responses, to
+// investigate intermittent bad responses after the fact. Every attempt is
+// kept, including retries and token requests. A response is recorded once
+// its body is closed, or at once if the request failed.
+type DebugBuffer struct {
+	clock     Clock
+	bodyLimit int
+
+	mu      sync.Mutex
+	entries []RecordedExchange
+	next    int
+	full    bool
+}
+
+// SetDebugBuffer keeps the last n exchanges in a ring buffer, readable with
+// Debug().Recent(), and the first bodyLimit bytes of each response body;
+// bodyLimit <= 0 keeps 64 KiB. n <= 0 turns the buffer off.
+func (proxy *TDXProxy) SetDebugBuffer(n, bodyLimit int) {
+	var buffer *DebugBuffer
+	if n > 0 {
+		if bodyLimit <= 0 {
+			bodyLimit = defaultDebugBodyLimit
+		}
+		buffer = &DebugBuffer{clock: proxy.clock, bodyLimit: bodyLimit, entries: make([]RecordedExchange, n)}
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.debug = buffer
+}
+
+// Debug returns the proxy's debug buffer, or nil if SetDebugBuffer was not
+// called. A nil buffer records nothing.
+func (proxy *TDXProxy) Debug() *DebugBuffer {
+	return proxy.settings().debug
+}
+
+// Recent returns the recorded exchanges, oldest first.
+func (b *DebugBuffer) Recent() []RecordedExchange {
+	if b == nil {
+		return []RecordedExchange{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]RecordedExchange{}, b.entries[:b.next]...)
+	}
+	return append(append([]RecordedExchange{}, b.entries[b.next:]...), b.entries[:b.next]...)
+}
+
+func (b *DebugBuffer) add(entry RecordedExchange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = entry
+	b.next++
+	if b.next == len(b.entries) {
+		b.next, b.full = 0, true
+	}
+}
+
+// transport wraps base so that the exchanges it carries are recorded in b,
+// or returns base if b is nil.
+func (b *DebugBuffer) transport(base http.RoundTripper) http.RoundTripper {
+	if b == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &debugTransport{buffer: b, base: base}
+}
+
+type debugTransport struct {
+	buffer *DebugBuffer
+	base   http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := RecordedExchange{
+		Time:          t.buffer.clock.Now(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: redactHeader(req.Header),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		entry.RequestBody = string(body[:min(len(body), t.buffer.bodyLimit)])
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			entry.RequestBody = redactForm(entry.RequestBody)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Latency = t.buffer.clock.Now().Sub(entry.Time)
+		entry.Error = err.Error()
+		t.buffer.add(entry)
+		return nil, err
+	}
+	entry.Status = resp.StatusCode
+	entry.ResponseHeader = redactHeader(resp.Header)
+	resp.Body = &debugBody{ReadCloser: resp.Body, buffer: t.buffer, entry: entry}
+	return resp, nil
+}
+
+// debugBody keeps the start of the response body as the caller reads it and
+// records the exchange when the body is closed.
+type debugBody struct {
+	io.ReadCloser
+	buffer *DebugBuffer
+	entry  RecordedExchange
+	buf    bytes.Buffer
+	size   int64
+	once   sync.Once
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := b.buffer.bodyLimit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		body := b.buf.Bytes()
+		b.entry.Latency = b.buffer.clock.Now().Sub(b.entry.Time)
+		b.entry.BodySize = b.size
+		b.entry.Truncated = b.size > int64(len(body))
+		switch {
+		case !utf8.Valid(body) && !b.entry.Truncated:
+			b.entry.Body = fmt.Sprintf("(%d bytes of binary data)", len(body))
+		case strings.Contains(b.entry.ResponseHeader.Get("Content-Type"), "json"):
+			b.entry.Body = redactJSON(body)
+		default:
+			b.entry.Body = strings.ToValidUTF8(string(body), "�")
+		}
+		b.buffer.add(b.entry)
+	})
+	return err
+}
+
+// redactHeader returns a copy of header with the values of sensitive
+// headers redacted.
+func redactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if harSensitiveHeaders[name] {
+			redacted[name] = []string{harRedacted}
+		}
+	}
+	return redacted
+}
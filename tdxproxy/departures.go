@@ -0,0 +1,185 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StopStatus is the state of a route at a stop, as in TDX ETA records.
+type StopStatus int
+
+const (
+	StopNormal       StopStatus = 0
+	StopNotDeparted  StopStatus = 1
+	StopSkipped      StopStatus = 2
+	StopLastPassed   StopStatus = 3
+	StopNotOperating StopStatus = 4
+)
+
+func (s StopStatus) String() string {
+	switch s {
+	case StopNormal:
+		return "normal"
+	case StopNotDeparted:
+		return "not departed"
+	case StopSkipped:
+		return "skipped"
+	case StopLastPassed:
+		return "last bus passed"
+	case StopNotOperating:
+		return "not operating"
+	}
+	return fmt.Sprintf("StopStatus(%d)", int(s))
+}
+
+// Departure is an upcoming departure of a route at a stop.
+type Departure struct {
+	RouteUID    string
+	RouteName   Name
+	SubRouteUID string
+	Direction   int
+	// Destination is the terminal stop in the direction of travel.
+	Destination Name
+	// PlateNumb is the approaching bus, if the estimate identifies one.
+	PlateNumb string
+	Status    StopStatus
+	// Expected is when the bus is due, zero if unknown. Scheduled tells whether
+	// it comes from the timetable rather than a live estimate.
+	Expected  time.Time
+	Scheduled bool
+	IsLastBus bool
+}
+
+// DepartureBoard returns the upcoming departures at a city bus stop: the live
+// estimates of every route serving it, joined with the routes' names and
+// terminals. Routes without a live estimate fall back to the next scheduled
+// departure TDX reports for them. Departures with a known time come first,
+// soonest first; the rest follow ordered by route name.
+func (proxy *TDXProxy) DepartureBoard(ctx context.Context, city, stopUID string) ([]Departure, error) {
+	if err := checkBusCity(city, false); err != nil {
+		return nil, err
+	}
+	etaBody, err := proxy.fetchBody(ctx, "v2/Bus/EstimatedTimeOfArrival/City/"+city, map[string]string{
+		"$format": "JSON",
+		"$filter": EscapeParam(fmt.Sprintf("StopUID eq %s", odataString(stopUID))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch estimates: %w", err)
+	}
+	type estimate struct {
+		PlateNumb    string
+		RouteUID     string
+		RouteName    Name
+		SubRouteUID  string
+		Direction    int
+		EstimateTime *int
+		StopStatus   StopStatus
+		NextBusTime  string
+		IsLastBus    bool
+		UpdateTime   string
+	}
+	estimates, err := DecodeAs[estimate](etaBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode estimates: %w", err)
+	}
+	if len(estimates) == 0 {
+		return nil, nil
+	}
+
+	routeUIDs := make([]string, len(estimates))
+	for i, e := range estimates {
+		routeUIDs[i] = e.RouteUID
+	}
+	terminals, err := proxy.routeTerminals(ctx, city, routeUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := proxy.clock.Now()
+	departures := make([]Departure, 0, len(estimates))
+	for _, e := range estimates {
+		d := Departure{
+			RouteUID:    e.RouteUID,
+			RouteName:   e.RouteName,
+			SubRouteUID: e.SubRouteUID,
+			Direction:   e.Direction,
+			PlateNumb:   e.PlateNumb,
+			Status:      e.StopStatus,
+			IsLastBus:   e.IsLastBus,
+		}
+		if t, ok := terminals[e.RouteUID]; ok {
+			d.Destination = t[0]
+			if e.Direction == 1 {
+				d.Destination = t[1]
+			}
+		}
+		switch {
+		case e.EstimateTime != nil:
+			base := now
+			if t, err := time.Parse(time.RFC3339, e.UpdateTime); err == nil {
+				base = t
+			}
+			d.Expected = base.Add(time.Duration(*e.EstimateTime) * time.Second)
+		case e.NextBusTime != "":
+			if t, err := time.Parse(time.RFC3339, e.NextBusTime); err == nil {
+				d.Expected, d.Scheduled = t, true
+			}
+		}
+		departures = append(departures, d)
+	}
+
+	sort.SliceStable(departures, func(i, j int) bool {
+		a, b := departures[i], departures[j]
+		if a.Expected.IsZero() != b.Expected.IsZero() {
+			return !a.Expected.IsZero()
+		}
+		if !a.Expected.Equal(b.Expected) {
+			return a.Expected.Before(b.Expected)
+		}
+		return a.RouteName.ZhTw < b.RouteName.ZhTw
+	})
+	return departures, nil
+}
+
+// routeTerminals fetches the terminals of city bus routes, returning for each
+// RouteUID the destination of direction 0 and of direction 1.
+func (proxy *TDXProxy) routeTerminals(ctx context.Context, city string, routeUIDs []string) (map[string][2]Name, error) {
+	seen := map[string]bool{}
+	var conditions []string
+	for _, uid := range routeUIDs {
+		if uid != "" && !seen[uid] {
+			seen[uid] = true
+			conditions = append(conditions, fmt.Sprintf("RouteUID eq %s", odataString(uid)))
+		}
+	}
+	terminals := make(map[string][2]Name, len(conditions))
+	if len(conditions) == 0 {
+		return terminals, nil
+	}
+
+	type route struct {
+		RouteUID              string
+		DepartureStopNameZh   string
+		DepartureStopNameEn   string
+		DestinationStopNameZh string
+		DestinationStopNameEn string
+	}
+	routes, err := fetchStatic[route](ctx, proxy, "v2/Bus/Route/City/"+city, map[string]string{
+		"$format": "JSON",
+		"$filter": EscapeParam(strings.Join(conditions, " or ")),
+		"$select": "RouteUID,DepartureStopNameZh,DepartureStopNameEn,DestinationStopNameZh,DestinationStopNameEn",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch routes: %w", err)
+	}
+	for _, r := range routes {
+		terminals[r.RouteUID] = [2]Name{
+			{ZhTw: r.DestinationStopNameZh, En: r.DestinationStopNameEn},
+			{ZhTw: r.DepartureStopNameZh, En: r.DepartureStopNameEn},
+		}
+	}
+	return terminals, nil
+}
@@ -0,0 +1,76 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Do sends a caller-built request through the proxy, injecting the bearer token
+// and applying the retry policy. It is meant for requests the Get helpers can't
+// express, such as other methods, bodies or unusual headers.
+//
+// A request URL without a host is treated as a TDX path relative to the base URL,
+// e.g. "v2/Bus/Route/City/Taipei". Headers already set on the request take
+// precedence over the proxy's defaults. The request is bounded by its context.
+func (proxy *TDXProxy) Do(req *http.Request) (*http.Response, error) {
+	return proxy.do(req, &requestOptions{})
+}
+
+func (proxy *TDXProxy) do(req *http.Request, options *requestOptions) (*http.Response, error) {
+	target := req.URL
+	legacy := false
+	settings := proxy.settings()
+	if settings.ptxCompat {
+		if rewritten, ok := RewritePTXPath(target.String()); ok {
+			parsed, err := url.Parse(rewritten)
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewrite PTX URL: %w", err)
+			}
+			target, legacy = parsed, true
+		}
+	}
+	if !target.IsAbs() {
+		resolved, err := url.Parse(settings.baseURL + strings.TrimPrefix(target.String(), "/"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve request URL: %w", err)
+		}
+		target = resolved
+	}
+
+	getBody := req.GetBody
+	if req.Body != nil && req.Body != http.NoBody && getBody == nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	ctx := req.Context()
+	newRequest := func() (*http.Request, error) {
+		attempt := req.Clone(ctx)
+		attempt.URL = target
+		attempt.Host = ""
+		attempt.RequestURI = ""
+		if legacy {
+			stripPTXAuth(attempt.Header)
+		}
+		if getBody != nil {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt.Body = body
+			attempt.GetBody = getBody
+		}
+		return attempt, nil
+	}
+	return proxy.roundTrip(ctx, target.Path, newRequest, 0, options)
+}
@@ -0,0 +1,85 @@
+package tdxproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrDryRun is returned by requests made in dry-run mode, after the request
+// was printed instead of sent.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// SetDryRun makes the proxy print every request to w instead of sending it:
+// the method, the resolved URL, its query parameters and the headers, with
+// the auth token redacted. Requests then fail with ErrDryRun without touching
+// the cache, the rate limiter or the token endpoint. Passing nil turns dry-run
+// mode off. The DryRun option does the same for a single request.
+func (proxy *TDXProxy) SetDryRun(w io.Writer) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.dryRun = w
+}
+
+func (proxy *TDXProxy) dryRunWriter(options *requestOptions) io.Writer {
+	if options.dryRun != nil {
+		return options.dryRun
+	}
+	return proxy.settings().dryRun
+}
+
+// printDryRun prints the request built by newRequest as it would be sent,
+// and returns ErrDryRun.
+func (proxy *TDXProxy) printDryRun(w io.Writer, newRequest func() (*http.Request, error)) error {
+	req, err := newRequest()
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if req.Header.Get("Authorization") != "" || proxy.hasCredentials() {
+		req.Header.Set("Authorization", "Bearer <redacted>")
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL)
+	if req.URL.RawQuery != "" {
+		params := strings.Split(req.URL.RawQuery, "&")
+		sort.Strings(params)
+		b.WriteString("Query:\n")
+		for _, param := range params {
+			name, value, _ := strings.Cut(param, "=")
+			fmt.Fprintf(&b, "  %s: %s\n", name, value)
+		}
+	}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("Headers:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s: %s\n", name, strings.Join(req.Header[name], ", "))
+	}
+	if req.ContentLength > 0 {
+		fmt.Fprintf(&b, "Body: %d bytes\n", req.ContentLength)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	return ErrDryRun
+}
+
+// hasCredentials reports whether requests are authenticated.
+func (proxy *TDXProxy) hasCredentials() bool {
+	if settings := proxy.settings(); settings.credentials != nil || settings.auth != nil {
+		return true
+	}
+	proxy.tokenMu.Lock()
+	defer proxy.tokenMu.Unlock()
+	return proxy.appID != "" && proxy.appKey != ""
+}
@@ -0,0 +1,92 @@
+package tdxproxy
+
+import "strings"
+
+// Endpoint is an entry of the endpoint catalog. Path may contain
+// placeholders in braces, such as {City} or {RouteName}.
+type Endpoint struct {
+	Path        string
+	Description string
+}
+
+// Endpoints is a catalog of commonly used TDX endpoints, for discovery and
+// completion. It is not exhaustive: any path TDX serves can be requested.
+var Endpoints = []Endpoint{
+	{"v2/Bus/Route/City/{City}", "bus routes of a city"},
+	{"v2/Bus/Route/City/{City}/{RouteName}", "a bus route of a city"},
+	{"v2/Bus/Stop/City/{City}", "bus stops of a city"},
+	{"v2/Bus/Station/City/{City}", "bus stations of a city"},
+	{"v2/Bus/StopOfRoute/City/{City}", "stop sequences of the bus routes of a city"},
+	{"v2/Bus/StopOfRoute/City/{City}/{RouteName}", "stop sequence of a bus route"},
+	{"v2/Bus/Schedule/City/{City}", "bus timetables of a city"},
+	{"v2/Bus/Schedule/City/{City}/{RouteName}", "timetable of a bus route"},
+	{"v2/Bus/Shape/City/{City}", "bus route shapes of a city"},
+	{"v2/Bus/Shape/City/{City}/{RouteName}", "shape of a bus route"},
+	{"v2/Bus/Operator/City/{City}", "bus operators of a city"},
+	{"v2/Bus/Network/City/{City}", "bus route networks of a city"},
+	{"v2/Bus/EstimatedTimeOfArrival/City/{City}", "bus arrival estimates of a city"},
+	{"v2/Bus/EstimatedTimeOfArrival/City/{City}/{RouteName}", "arrival estimates of a bus route"},
+	{"v2/Bus/RealTimeByFrequency/City/{City}", "bus positions of a city"},
+	{"v2/Bus/RealTimeNearStop/City/{City}", "bus arrivals and departures at stops of a city"},
+	{"v2/Bus/Alert/City/{City}", "bus service alerts of a city"},
+	{"v2/Bus/Route/InterCity", "intercity bus routes"},
+	{"v2/Bus/Stop/InterCity", "intercity bus stops"},
+	{"v2/Bus/Schedule/InterCity/{RouteName}", "timetable of an intercity bus route"},
+	{"v2/Bus/EstimatedTimeOfArrival/InterCity", "intercity bus arrival estimates"},
+	{"v3/Rail/TRA/Station", "TRA stations"},
+	{"v3/Rail/TRA/DailyTrainTimetable/Today", "today's TRA timetable"},
+	{"v3/Rail/TRA/TrainLiveBoard", "TRA train positions"},
+	{"v3/Rail/TRA/Alert", "TRA service alerts"},
+	{"v2/Rail/THSR/Station", "THSR stations"},
+	{"v2/Rail/THSR/DailyTimetable/Today", "today's THSR timetable"},
+	{"v2/Rail/THSR/AlertInfo", "THSR service alerts"},
+	{"v2/Rail/Metro/Station/{Operator}", "metro stations of an operator, e.g. TRTC"},
+	{"v2/Rail/Metro/Line/{Operator}", "metro lines of an operator, with their colors"},
+	{"v2/Rail/Metro/LiveBoard/{Operator}", "metro arrival board of an operator"},
+	{"v2/Rail/Metro/CarCrowding/{Operator}", "metro car crowding of an operator"},
+	{"v2/Rail/Metro/Alert/{Operator}", "metro service alerts of an operator"},
+	{"v2/Bike/Station/City/{City}", "bike sharing stations of a city"},
+	{"v2/Bike/Availability/City/{City}", "bike sharing availability of a city"},
+	{"v2/Tourism/ScenicSpot/{City}", "scenic spots of a city"},
+	{"v2/Tourism/Restaurant/{City}", "restaurants of a city"},
+	{"v2/Tourism/Hotel/{City}", "hotels of a city"},
+	{"v2/Air/FIDS/Airport/Departure/{IATA}", "flight departures of an airport, e.g. TPE"},
+}
+
+// PlaceholderValues lists the known values of the catalog placeholders that
+// take one of a fixed set, such as {City}.
+var PlaceholderValues = map[string][]string{
+	"City":     Cities,
+	"Operator": {"TRTC", "KRTC", "TYMC", "TMRT", "NTDLRT", "KLRT"},
+}
+
+// Placeholders returns the names of the placeholders in the endpoint path,
+// in order, e.g. ["City", "RouteName"].
+func (e Endpoint) Placeholders() []string {
+	var names []string
+	rest := e.Path
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return names
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return names
+		}
+		names = append(names, rest[start+1:start+end])
+		rest = rest[start+end+1:]
+	}
+}
+
+// Expand returns the endpoint path with its placeholders replaced by values.
+// Placeholders without a value are left in place.
+func (e Endpoint) Expand(values map[string]string) string {
+	path := e.Path
+	for _, name := range e.Placeholders() {
+		if value, ok := values[name]; ok {
+			path = strings.Replace(path, "{"+name+"}", value, 1)
+		}
+	}
+	return path
+}
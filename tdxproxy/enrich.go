@@ -0,0 +1,95 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Enricher attaches external data, such as weather, to transit stops and
+// stations by location. Implementations return one value per stop UID they
+// have data for and are expected to cache upstream data themselves.
+type Enricher interface {
+	// Name is the key the enricher's data is stored under in EnrichedStop.Data.
+	Name() string
+	Enrich(ctx context.Context, stops []Stop) (map[string]any, error)
+}
+
+// EnrichedStop is a stop with the data of every enricher that had some.
+type EnrichedStop struct {
+	Stop
+	Data map[string]any
+}
+
+// EnrichStops runs the enrichers over stops. A failing enricher does not stop
+// the others; its error is returned joined with any others alongside the
+// data that could be gathered.
+func EnrichStops(ctx context.Context, stops []Stop, enrichers ...Enricher) ([]EnrichedStop, error) {
+	enriched := make([]EnrichedStop, len(stops))
+	for i, stop := range stops {
+		enriched[i] = EnrichedStop{Stop: stop, Data: map[string]any{}}
+	}
+	var errs []error
+	for _, enricher := range enrichers {
+		values, err := enricher.Enrich(ctx, stops)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", enricher.Name(), err))
+			continue
+		}
+		for i := range enriched {
+			if v, ok := values[enriched[i].UID]; ok {
+				enriched[i].Data[enricher.Name()] = v
+			}
+		}
+	}
+	return enriched, errors.Join(errs...)
+}
+
+// stationCache keeps the stations of an enricher's data source in a StopIndex
+// and refetches them when they are older than ttl.
+type stationCache struct {
+	ttl   time.Duration
+	clock Clock
+	fetch func(ctx context.Context) ([]Stop, error)
+
+	mu      sync.Mutex
+	index   *StopIndex
+	fetched time.Time
+}
+
+// nearest returns, for each stop, the nearest station within maxDistance meters.
+func (c *stationCache) nearest(ctx context.Context, stops []Stop, maxDistance float64) (map[string]NearbyStop, error) {
+	index, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]NearbyStop, len(stops))
+	for _, stop := range stops {
+		found := index.NearestStops(stop.Lat, stop.Lon, 1)
+		if len(found) == 1 && (maxDistance <= 0 || found[0].Distance <= maxDistance) {
+			result[stop.UID] = found[0]
+		}
+	}
+	return result, nil
+}
+
+func (c *stationCache) load(ctx context.Context) (*StopIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index != nil && c.clock.Now().Sub(c.fetched) < c.ttl {
+		return c.index, nil
+	}
+	stations, err := c.fetch(ctx)
+	if err != nil {
+		if c.index != nil {
+			// Serve stale data rather than nothing while the source is down.
+			return c.index, nil
+		}
+		return nil, err
+	}
+	c.index = NewStopIndex(stations)
+	c.fetched = c.clock.Now()
+	return c.index, nil
+}
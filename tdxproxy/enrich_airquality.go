@@ -0,0 +1,167 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// moenvAQIURL is the Ministry of Environment (formerly EPA) open data dataset
+// of hourly air quality index readings per monitoring station.
+const moenvAQIURL = "https://data.moenv.gov.tw/api/v2/aqx_p_432"
+
+// AirQuality is the latest reading of the air quality monitoring station
+// nearest to a stop. Pollutant values the station did not report are nil.
+type AirQuality struct {
+	SiteID      string    `json:"site_id"`
+	SiteName    string    `json:"site_name"`
+	Distance    float64   `json:"distance"`
+	PublishedAt time.Time `json:"published_at"`
+	AQI         *float64  `json:"aqi,omitempty"`
+	// Status is the AQI category, e.g. "良好" or "對敏感族群不健康".
+	Status    string   `json:"status,omitempty"`
+	Pollutant string   `json:"pollutant,omitempty"`
+	PM25      *float64 `json:"pm2_5,omitempty"`
+	PM10      *float64 `json:"pm10,omitempty"`
+	O3        *float64 `json:"o3,omitempty"`
+}
+
+// AirQualityEnricher adds the reading of the nearest Ministry of Environment
+// air quality station to stops. Readings are published hourly and cached for
+// 20 minutes.
+type AirQualityEnricher struct {
+	apiKey      string
+	client      *http.Client
+	maxDistance float64
+	stations    *stationCache
+}
+
+func NewAirQualityEnricher(apiKey string) *AirQualityEnricher {
+	e := &AirQualityEnricher{
+		apiKey:      apiKey,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		maxDistance: 15000,
+	}
+	e.stations = &stationCache{ttl: 20 * time.Minute, clock: systemClock{}, fetch: e.fetchStations}
+	return e
+}
+
+// SetTransport sets the transport used for open data requests.
+func (e *AirQualityEnricher) SetTransport(transport http.RoundTripper) {
+	e.client.Transport = transport
+}
+
+// SetMaxDistance sets how far in meters the nearest station may be; the
+// default is 15 km.
+func (e *AirQualityEnricher) SetMaxDistance(meters float64) {
+	e.maxDistance = meters
+}
+
+func (e *AirQualityEnricher) Name() string {
+	return "air_quality"
+}
+
+func (e *AirQualityEnricher) Enrich(ctx context.Context, stops []Stop) (map[string]any, error) {
+	nearest, err := e.stations.nearest(ctx, stops, e.maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(nearest))
+	for uid, station := range nearest {
+		var reading AirQuality
+		if err := json.Unmarshal(station.Record, &reading); err != nil {
+			continue
+		}
+		reading.Distance = station.Distance
+		values[uid] = reading
+	}
+	return values, nil
+}
+
+type aqiRecord struct {
+	SiteID      string `json:"siteid"`
+	SiteName    string `json:"sitename"`
+	AQI         string `json:"aqi"`
+	Status      string `json:"status"`
+	Pollutant   string `json:"pollutant"`
+	PM25        string `json:"pm2.5"`
+	PM10        string `json:"pm10"`
+	O3          string `json:"o3"`
+	PublishTime string `json:"publishtime"`
+	Latitude    string `json:"latitude"`
+	Longitude   string `json:"longitude"`
+}
+
+func (e *AirQualityEnricher) fetchStations(ctx context.Context) ([]Stop, error) {
+	query := "?format=json&limit=1000&api_key=" + url.QueryEscape(e.apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, moenvAQIURL+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("air quality request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("air quality request returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read air quality response: %w", err)
+	}
+
+	// The dataset is served either as a bare array or wrapped in "records".
+	var records []aqiRecord
+	if err := json.Unmarshal(body, &records); err != nil {
+		var wrapped struct {
+			Records []aqiRecord `json:"records"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, fmt.Errorf("failed to parse air quality response: %w", err)
+		}
+		records = wrapped.Records
+	}
+
+	stations := make([]Stop, 0, len(records))
+	for _, r := range records {
+		lat, latErr := strconv.ParseFloat(r.Latitude, 64)
+		lon, lonErr := strconv.ParseFloat(r.Longitude, 64)
+		if latErr != nil || lonErr != nil {
+			continue
+		}
+		reading := AirQuality{
+			SiteID:    r.SiteID,
+			SiteName:  r.SiteName,
+			AQI:       aqiValue(r.AQI),
+			Status:    r.Status,
+			Pollutant: r.Pollutant,
+			PM25:      aqiValue(r.PM25),
+			PM10:      aqiValue(r.PM10),
+			O3:        aqiValue(r.O3),
+		}
+		if t, err := time.ParseInLocation("2006/01/02 15:04:05", r.PublishTime, taipei); err == nil {
+			reading.PublishedAt = t
+		}
+		record, err := json.Marshal(reading)
+		if err != nil {
+			return nil, err
+		}
+		stations = append(stations, Stop{UID: r.SiteID, Name: Name{ZhTw: r.SiteName}, Lat: lat, Lon: lon, Record: record})
+	}
+	return stations, nil
+}
+
+// aqiValue parses a reading; stations report missing values as "", "-" or "ND".
+func aqiValue(s string) *float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,179 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// cwaObservationURL is the CWA open data dataset of current automatic weather
+// station observations.
+const cwaObservationURL = "https://opendata.cwa.gov.tw/api/v1/rest/datastore/O-A0003-001"
+
+// Weather is the current observation of the weather station nearest to a stop.
+// Values the station did not report are nil.
+type Weather struct {
+	StationID   string    `json:"station_id"`
+	StationName string    `json:"station_name"`
+	Distance    float64   `json:"distance"`
+	ObservedAt  time.Time `json:"observed_at"`
+	Weather     string    `json:"weather,omitempty"`
+	// Temperature is in °C, Humidity in percent, WindSpeed in m/s and
+	// Precipitation the rainfall in mm since midnight.
+	Temperature   *float64 `json:"temperature,omitempty"`
+	Humidity      *float64 `json:"humidity,omitempty"`
+	WindSpeed     *float64 `json:"wind_speed,omitempty"`
+	Precipitation *float64 `json:"precipitation,omitempty"`
+}
+
+// WeatherEnricher adds the current weather observed by the nearest Central
+// Weather Administration (CWA) station to stops. It needs a CWA open data API
+// key. Observations are cached for ten minutes, the interval CWA updates them.
+type WeatherEnricher struct {
+	apiKey      string
+	client      *http.Client
+	maxDistance float64
+	stations    *stationCache
+}
+
+func NewWeatherEnricher(apiKey string) *WeatherEnricher {
+	e := &WeatherEnricher{
+		apiKey:      apiKey,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		maxDistance: 20000,
+	}
+	e.stations = &stationCache{ttl: 10 * time.Minute, clock: systemClock{}, fetch: e.fetchStations}
+	return e
+}
+
+// SetTransport sets the transport used for CWA requests.
+func (e *WeatherEnricher) SetTransport(transport http.RoundTripper) {
+	e.client.Transport = transport
+}
+
+// SetMaxDistance sets how far in meters the nearest station may be; stops
+// farther from any station get no weather. The default is 20 km.
+func (e *WeatherEnricher) SetMaxDistance(meters float64) {
+	e.maxDistance = meters
+}
+
+func (e *WeatherEnricher) Name() string {
+	return "weather"
+}
+
+func (e *WeatherEnricher) Enrich(ctx context.Context, stops []Stop) (map[string]any, error) {
+	nearest, err := e.stations.nearest(ctx, stops, e.maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any, len(nearest))
+	for uid, station := range nearest {
+		var weather Weather
+		if err := json.Unmarshal(station.Record, &weather); err != nil {
+			continue
+		}
+		weather.Distance = station.Distance
+		values[uid] = weather
+	}
+	return values, nil
+}
+
+// fetchStations downloads the observations, stored as each station's Record.
+func (e *WeatherEnricher) fetchStations(ctx context.Context) ([]Stop, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cwaObservationURL+"?Authorization="+url.QueryEscape(e.apiKey), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("CWA request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CWA request returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CWA response: %w", err)
+	}
+
+	var data struct {
+		Records struct {
+			Station []struct {
+				StationName string
+				StationID   string `json:"StationId"`
+				ObsTime     struct {
+					DateTime time.Time
+				}
+				GeoInfo struct {
+					Coordinates []struct {
+						CoordinateName   string
+						StationLatitude  json.Number
+						StationLongitude json.Number
+					}
+				}
+				WeatherElement struct {
+					Weather          string
+					AirTemperature   json.Number
+					RelativeHumidity json.Number
+					WindSpeed        json.Number
+					Now              struct {
+						Precipitation json.Number
+					}
+				}
+			}
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse CWA response: %w", err)
+	}
+
+	stations := make([]Stop, 0, len(data.Records.Station))
+	for _, s := range data.Records.Station {
+		var lat, lon float64
+		found := false
+		for _, c := range s.GeoInfo.Coordinates {
+			if c.CoordinateName == "WGS84" {
+				lat, _ = c.StationLatitude.Float64()
+				lon, _ = c.StationLongitude.Float64()
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		weather := Weather{
+			StationID:     s.StationID,
+			StationName:   s.StationName,
+			ObservedAt:    s.ObsTime.DateTime,
+			Temperature:   cwaValue(s.WeatherElement.AirTemperature),
+			Humidity:      cwaValue(s.WeatherElement.RelativeHumidity),
+			WindSpeed:     cwaValue(s.WeatherElement.WindSpeed),
+			Precipitation: cwaValue(s.WeatherElement.Now.Precipitation),
+		}
+		if s.WeatherElement.Weather != "-99" {
+			weather.Weather = s.WeatherElement.Weather
+		}
+		record, err := json.Marshal(weather)
+		if err != nil {
+			return nil, err
+		}
+		stations = append(stations, Stop{UID: s.StationID, Name: Name{ZhTw: s.StationName}, Lat: lat, Lon: lon, Record: record})
+	}
+	return stations, nil
+}
+
+// cwaValue converts a CWA reading, where negative sentinels such as -99 and
+// -999 mark missing values.
+func cwaValue(n json.Number) *float64 {
+	v, err := strconv.ParseFloat(n.String(), 64)
+	if err != nil || v <= -98 {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,234 @@
+package tdxproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors a StatusError matches with errors.Is, by the kind of failure TDX reported.
+var (
+	// ErrInvalidQuery is a request TDX rejected as malformed, such as a bad $filter.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrNotFound is a path TDX has no API for.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is a missing, expired or rejected token or credential.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrQuotaExceeded is a rate limit or quota reached on the TDX side.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrUnavailable is TDX down or under maintenance, often answered with an HTML page.
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// Errors typed clients return for conditions of a service rather than of a
+// request, wrapped in a *ServiceError naming the service and the value.
+var (
+	// ErrUnknownCity is a city the service publishes no data for.
+	ErrUnknownCity = errors.New("unknown city")
+	// ErrUnknownOperator is an operator the service publishes no data for.
+	ErrUnknownOperator = errors.New("unknown operator")
+	// ErrRouteNotOperated is a route the service has no data for, or whose
+	// timetable runs no trips on the requested date.
+	ErrRouteNotOperated = errors.New("route not operated")
+	// ErrOutOfTimetableRange is a date outside the period a timetable is valid for.
+	ErrOutOfTimetableRange = errors.New("date outside timetable range")
+)
+
+// ServiceError is a typed client's error for a value the service can't
+// answer for. It matches its Kind with errors.Is:
+//
+//	if errors.Is(err, tdxproxy.ErrUnknownCity) { ... }
+type ServiceError struct {
+	// Service is the TDX service, such as "bus", "intercity" or "metro".
+	Service string
+	// Kind is one of ErrUnknownCity, ErrUnknownOperator, ErrRouteNotOperated
+	// and ErrOutOfTimetableRange.
+	Kind error
+	// Value is the city, operator, route or date concerned.
+	Value string
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Service, e.Kind, e.Value)
+}
+
+func (e *ServiceError) Unwrap() error {
+	return e.Kind
+}
+
+// checkBusCity returns an ErrUnknownCity error unless city is one of Cities,
+// or "InterCity" where interCity allows it.
+func checkBusCity(city string, interCity bool) error {
+	if slices.Contains(Cities, city) || interCity && city == "InterCity" {
+		return nil
+	}
+	return &ServiceError{Service: "bus", Kind: ErrUnknownCity, Value: city}
+}
+
+// errorBodyLimit caps how much of an unsuccessful response body is kept in a StatusError.
+const errorBodyLimit = 4 << 10
+
+// errorHeaders are the response headers kept in a StatusError.
+var errorHeaders = []string{
+	"Content-Type",
+	"Date",
+	"Retry-After",
+	"WWW-Authenticate",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+}
+
+// StatusError is returned when TDX answers with a status the proxy does not treat as success.
+// It keeps the start of the response body and selected headers for debugging.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Truncated reports whether Body was cut at the size limit.
+	Truncated bool
+	// RetryAfter is the wait TDX asked for in the Retry-After header, zero
+	// if it sent none. It is mostly set on ErrQuotaExceeded errors.
+	RetryAfter time.Duration
+	// Attempts holds every attempt of the request, in order, the last one
+	// being the response of this error. It is nil for token requests.
+	Attempts []Attempt
+}
+
+// Attempt is one try of a request, as kept in a StatusError for callers
+// deciding whether and when to retry themselves.
+type Attempt struct {
+	Time time.Time
+	// StatusCode is 0 if the attempt failed without a response.
+	StatusCode int
+	// RetryAfter is the wait the response asked for, zero if none.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	if len(e.Body) == 0 {
+		return msg
+	}
+	body := strings.Join(strings.Fields(string(e.Body)), " ")
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return msg + ": " + body
+}
+
+// Is reports whether e is of the kind target, one of ErrInvalidQuery,
+// ErrNotFound, ErrUnauthorized, ErrQuotaExceeded and ErrUnavailable.
+func (e *StatusError) Is(target error) bool {
+	return e.kind() == target
+}
+
+func (e *StatusError) kind() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrQuotaExceeded
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusBadRequest:
+		// The token endpoint answers a bad client ID or secret with 400.
+		if code := e.oauthError(); code == "invalid_client" || code == "unauthorized_client" || code == "invalid_grant" {
+			return ErrUnauthorized
+		}
+		return ErrInvalidQuery
+	case e.StatusCode >= 500 || e.isHTML():
+		// Maintenance pages are served as HTML, not always with a 5xx status.
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Message returns the error message TDX included in a JSON body, or the
+// empty string. TDX APIs answer {"Message": ...} or {"message": ...}; the
+// token endpoint answers {"error": ..., "error_description": ...}.
+func (e *StatusError) Message() string {
+	var body struct {
+		Message          string `json:"message"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if json.Unmarshal(e.Body, &body) != nil {
+		return ""
+	}
+	switch {
+	case body.Message != "":
+		return body.Message
+	case body.ErrorDescription != "":
+		return body.ErrorDescription
+	}
+	return body.Error
+}
+
+func (e *StatusError) oauthError() string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(e.Body, &body)
+	return body.Error
+}
+
+func (e *StatusError) isHTML() bool {
+	mediaType, _, _ := mime.ParseMediaType(e.Header.Get("Content-Type"))
+	return mediaType == "text/html"
+}
+
+// newStatusError reads up to errorBodyLimit bytes of resp's body and closes it.
+// now is the time Retry-After dates are taken relative to.
+func newStatusError(url string, resp *http.Response, now time.Time) *StatusError {
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit+1))
+	truncated := len(body) > errorBodyLimit
+	if truncated {
+		body = body[:errorBodyLimit]
+	}
+	header := http.Header{}
+	for _, name := range errorHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return &StatusError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Header:     header,
+		Body:       body,
+		Truncated:  truncated,
+		RetryAfter: retryAfter(resp.Header, now),
+	}
+}
+
+// retryAfter parses the Retry-After header, either seconds or an HTTP date.
+// A date is taken relative to the Date header if there is one, else to now.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		now = date
+	}
+	return max(at.Sub(now), 0)
+}
@@ -0,0 +1,128 @@
+package tdxproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testdata/errors holds sanitized TDX error responses as raw HTTP/1.1
+// messages. Add a file and a case below when TDX answers with a new shape.
+
+// fixtureTransport answers API or token requests with a recorded response.
+type fixtureTransport struct {
+	path string
+	auth bool
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if isAuth := req.URL.String() == authURL; isAuth != f.auth {
+		if isAuth {
+			return (&fakeTDX{}).RoundTrip(req)
+		}
+		return nil, errors.New("unexpected API request after failed authentication")
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(file), req)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{resp.Body, file}
+	return resp, nil
+}
+
+func TestErrorFixtures(t *testing.T) {
+	tests := []struct {
+		file    string
+		auth    bool // served by the token endpoint
+		status  int
+		kind    error
+		message string
+	}{
+		{"bad_filter.http", false, 400, ErrInvalidQuery, "Could not find a property named 'RouteNam'"},
+		{"bad_syntax.http", false, 400, ErrInvalidQuery, "Syntax error at position 18"},
+		{"not_found.http", false, 404, ErrNotFound, "No HTTP resource was found"},
+		{"rate_limited.http", false, 429, ErrQuotaExceeded, "API rate limit exceeded"},
+		{"quota_exceeded.http", false, 429, ErrQuotaExceeded, "API rate limit exceeded"},
+		{"token_expired.http", false, 401, ErrUnauthorized, "Unauthorized"},
+		{"forbidden.http", false, 403, ErrUnauthorized, "You cannot consume this service"},
+		{"auth_invalid_client.http", true, 401, ErrUnauthorized, "Invalid client or Invalid client credentials"},
+		{"auth_bad_request.http", true, 400, ErrUnauthorized, "Invalid client credentials"},
+		{"server_error.http", false, 500, ErrUnavailable, "An error has occurred."},
+		{"maintenance.http", false, 503, ErrUnavailable, ""},
+		{"bad_gateway.http", false, 502, ErrUnavailable, ""},
+		{"maintenance_not_allowed.http", false, 405, ErrUnavailable, ""},
+	}
+	kinds := []error{ErrInvalidQuery, ErrNotFound, ErrUnauthorized, ErrQuotaExceeded, ErrUnavailable}
+
+	covered := map[string]bool{}
+	for _, tc := range tests {
+		covered[tc.file] = true
+		t.Run(strings.TrimSuffix(tc.file, ".http"), func(t *testing.T) {
+			proxy := NewTDXProxy("id", "key", slog.New(slog.NewTextHandler(io.Discard, nil)))
+			proxy.SetTransport(fixtureTransport{path: filepath.Join("testdata", "errors", tc.file), auth: tc.auth})
+			proxy.SetRetryPolicy(NeverRetry)
+
+			_, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0)
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("got error %v, want a *StatusError", err)
+			}
+			if statusErr.StatusCode != tc.status {
+				t.Errorf("StatusCode = %d, want %d", statusErr.StatusCode, tc.status)
+			}
+			for _, kind := range kinds {
+				if got := errors.Is(err, kind); got != (kind == tc.kind) {
+					t.Errorf("errors.Is(err, %v) = %v", kind, got)
+				}
+			}
+			if got := statusErr.Message(); !strings.Contains(got, tc.message) || tc.message == "" && got != "" {
+				t.Errorf("Message() = %q, want it to contain %q", got, tc.message)
+			}
+			if strings.Contains(err.Error(), "\n") {
+				t.Errorf("error text spans several lines: %q", err.Error())
+			}
+		})
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "errors", "*.http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if !covered[filepath.Base(file)] {
+			t.Errorf("fixture %s has no test case", file)
+		}
+	}
+}
+
+func TestStatusErrorKeepsRetryAfter(t *testing.T) {
+	for _, file := range []string{"rate_limited.http", "maintenance.http"} {
+		proxy := NewTDXProxyNoAuth(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		proxy.SetTransport(fixtureTransport{path: filepath.Join("testdata", "errors", file)})
+		proxy.SetRetryPolicy(NeverRetry)
+
+		_, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("%s: got error %v, want a *StatusError", file, err)
+		}
+		if statusErr.Header.Get("Retry-After") == "" {
+			t.Errorf("%s: Retry-After header not kept", file)
+		}
+	}
+}
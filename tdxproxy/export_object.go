@@ -0,0 +1,235 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// minPartSize is the smallest part size S3 accepts for all but the last part.
+const minPartSize = 5 << 20
+
+// ObjectStore uploads whole objects, e.g. to S3 or GCS. Implementations wrap
+// the provider's SDK client.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+}
+
+// CompletedPart identifies an uploaded part of a multipart upload.
+type CompletedPart struct {
+	Number int
+	ETag   string
+}
+
+// MultipartObjectStore is an ObjectStore that also supports multipart uploads,
+// which ObjectExporter uses for objects larger than its part size.
+type MultipartObjectStore interface {
+	ObjectStore
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, number int, body io.Reader, size int64) (etag string, err error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// ObjectExporter writes snapshots and downloads to object storage under keys
+// built from a template. The template may use:
+//
+//	{date}     export date, 2006-01-02
+//	{time}     export time, 150405
+//	{endpoint} TDX path of the data
+//	{city}     city code from the path's City/<code> segment, if any
+//	{name}     snapshot or file name
+//	{version}  snapshot version
+//
+// Uploads are streamed: data larger than the part size is sent as a multipart
+// upload when the store supports it, so nothing is staged on local disk.
+type ObjectExporter struct {
+	store       ObjectStore
+	keyTemplate string
+	partSize    int64
+	clock       Clock
+	logger      *slog.Logger
+}
+
+func NewObjectExporter(store ObjectStore, keyTemplate string, logger *slog.Logger) *ObjectExporter {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ObjectExporter{
+		store:       store,
+		keyTemplate: keyTemplate,
+		partSize:    16 << 20,
+		clock:       systemClock{},
+		logger:      logger,
+	}
+}
+
+// SetPartSize sets the multipart part size, which is also the threshold above
+// which multipart upload is used. It cannot go below the 5 MiB S3 minimum.
+func (e *ObjectExporter) SetPartSize(size int64) {
+	if size < minPartSize {
+		e.logger.Warn("Part size below minimum provided", slog.Int64("size", size))
+		size = minPartSize
+	}
+	e.partSize = size
+}
+
+// Key expands the key template.
+func (e *ObjectExporter) Key(endpoint, name string, version int) string {
+	now := e.clock.Now()
+	return strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{endpoint}", strings.Trim(endpoint, "/"),
+		"{city}", cityFromPath(endpoint),
+		"{name}", name,
+		"{version}", strconv.Itoa(version),
+	).Replace(e.keyTemplate)
+}
+
+// ExportSnapshot uploads a snapshot as JSON and returns its key.
+// The snapshot's Source is used as the endpoint.
+func (e *ObjectExporter) ExportSnapshot(ctx context.Context, snapshot *Snapshot) (string, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	key := e.Key(snapshot.Source, snapshot.Name, snapshot.Version)
+	return key, e.Upload(ctx, key, bytes.NewReader(data), "application/json")
+}
+
+// ExportDownload streams every file of a historical download to object storage,
+// with the file name as {name}, and returns the keys written.
+func (e *ObjectExporter) ExportDownload(ctx context.Context, proxy *TDXProxy, url string, params map[string]string) ([]string, error) {
+	var keys []string
+	err := proxy.Download(ctx, url, params, func(name string, r io.Reader) error {
+		key := e.Key(url, path.Base(name), 0)
+		if err := e.Upload(ctx, key, r, contentTypeOf(name)); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	})
+	return keys, err
+}
+
+// Write uploads a batch as a JSON array; it implements Sink. The last segment
+// of the endpoint path with ".json" appended is used as {name}.
+func (e *ObjectExporter) Write(ctx context.Context, batch Batch) error {
+	records := batch.Records
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+	name, _, _ := strings.Cut(path.Base(strings.Trim(batch.Endpoint, "/")), "?")
+	key := e.Key(batch.Endpoint, name+".json", 0)
+	return e.Upload(ctx, key, bytes.NewReader(data), "application/json")
+}
+
+// Flush implements Sink. Objects are uploaded by Write, so there is nothing to flush.
+func (e *ObjectExporter) Flush(ctx context.Context) error { return nil }
+
+// Close implements Sink. It does not close the store.
+func (e *ObjectExporter) Close() error { return nil }
+
+// Upload writes r to key, switching to a multipart upload once more than one
+// part of data has been read.
+func (e *ObjectExporter) Upload(ctx context.Context, key string, r io.Reader, contentType string) error {
+	first := make([]byte, e.partSize)
+	n, err := io.ReadFull(r, first)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return e.put(ctx, key, first[:n], contentType)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read export data: %w", err)
+	}
+
+	multipart, ok := e.store.(MultipartObjectStore)
+	if !ok {
+		rest, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read export data: %w", err)
+		}
+		return e.put(ctx, key, append(first, rest...), contentType)
+	}
+	return e.uploadMultipart(ctx, multipart, key, first, r, contentType)
+}
+
+func (e *ObjectExporter) put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := e.store.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (e *ObjectExporter) uploadMultipart(ctx context.Context, store MultipartObjectStore, key string, first []byte, r io.Reader, contentType string) error {
+	uploadID, err := store.CreateMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload of %s: %w", key, err)
+	}
+
+	var parts []CompletedPart
+	part := first
+	for number := 1; len(part) > 0; number++ {
+		etag, err := store.UploadPart(ctx, key, uploadID, number, bytes.NewReader(part), int64(len(part)))
+		if err != nil {
+			e.abort(ctx, store, key, uploadID)
+			return fmt.Errorf("failed to upload part %d of %s: %w", number, key, err)
+		}
+		parts = append(parts, CompletedPart{Number: number, ETag: etag})
+
+		part = make([]byte, e.partSize)
+		n, err := io.ReadFull(r, part)
+		part = part[:n]
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			e.abort(ctx, store, key, uploadID)
+			return fmt.Errorf("failed to read export data: %w", err)
+		}
+	}
+
+	if err := store.CompleteMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		e.abort(ctx, store, key, uploadID)
+		return fmt.Errorf("failed to complete multipart upload of %s: %w", key, err)
+	}
+	return nil
+}
+
+func (e *ObjectExporter) abort(ctx context.Context, store MultipartObjectStore, key, uploadID string) {
+	if err := store.AbortMultipartUpload(ctx, key, uploadID); err != nil {
+		e.logger.Warn("Failed to abort multipart upload", slog.String("key", key), slog.String("error", err.Error()))
+	}
+}
+
+// cityFromPath returns the segment following "City" in a TDX path.
+func cityFromPath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if segments[i] == "City" {
+			city, _, _ := strings.Cut(segments[i+1], "?")
+			return city
+		}
+	}
+	return ""
+}
+
+func contentTypeOf(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return "application/json"
+	case ".csv":
+		return "text/csv"
+	case ".xml":
+		return "application/xml"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,155 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault describes what FaultTransport does to a single request.
+// The zero Fault lets the request through untouched.
+type Fault struct {
+	// Latency delays the request before anything else happens.
+	Latency time.Duration
+	// Reset fails the request with a connection reset error.
+	Reset bool
+	// Status answers with this status code without contacting the server.
+	Status int
+	// MalformedJSON truncates the response body so it no longer parses.
+	MalformedJSON bool
+}
+
+type faultRule struct {
+	path   string
+	faults []Fault
+	repeat bool
+}
+
+// FaultTransport is an http.RoundTripper for resilience testing. It injects
+// latency, connection resets, malformed bodies and status sequences into
+// requests whose URL path contains a configured substring.
+//
+//	transport := tdxproxy.NewFaultTransport(nil).
+//		On("Bus/EstimatedTimeOfArrival", tdxproxy.Fault{Status: 429}, tdxproxy.Fault{Status: 429}).
+//		Always("Bus/Route", tdxproxy.Fault{Latency: 2 * time.Second})
+//	proxy.SetTransport(transport)
+type FaultTransport struct {
+	base  http.RoundTripper
+	mu    sync.Mutex
+	rules []*faultRule
+}
+
+// NewFaultTransport wraps base, or http.DefaultTransport if base is nil.
+func NewFaultTransport(base http.RoundTripper) *FaultTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &FaultTransport{base: base}
+}
+
+// On queues faults for matching requests, one per request in order.
+// Once the sequence is used up, matching requests pass through.
+func (t *FaultTransport) On(path string, faults ...Fault) *FaultTransport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = append(t.rules, &faultRule{path: path, faults: faults})
+	return t
+}
+
+// Always applies fault to every matching request.
+func (t *FaultTransport) Always(path string, fault Fault) *FaultTransport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = append(t.rules, &faultRule{path: path, faults: []Fault{fault}, repeat: true})
+	return t
+}
+
+// Reset removes all rules.
+func (t *FaultTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = nil
+}
+
+// next returns the fault for the request and consumes it from its sequence.
+func (t *FaultTransport) next(req *http.Request) Fault {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, rule := range t.rules {
+		if len(rule.faults) == 0 || !strings.Contains(req.URL.Path, rule.path) {
+			continue
+		}
+		fault := rule.faults[0]
+		if !rule.repeat {
+			rule.faults = rule.faults[1:]
+		}
+		return fault
+	}
+	return Fault{}
+}
+
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := t.next(req)
+
+	if fault.Latency > 0 {
+		timer := time.NewTimer(fault.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+	if fault.Reset {
+		closeRequestBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+
+	var resp *http.Response
+	if fault.Status != 0 {
+		closeRequestBody(req)
+		resp = &http.Response{
+			Status:     http.StatusText(fault.Status),
+			StatusCode: fault.Status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"Message":"injected fault"}`)),
+			Request:    req,
+		}
+	} else {
+		var err error
+		resp, err = t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if fault.MalformedJSON {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = append(body[:len(body)/2], `{"`...)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Del("Content-Length")
+	}
+	return resp, nil
+}
+
+// closeRequestBody closes the body of a request that is not passed on to the
+// base transport, as a RoundTripper must.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,102 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// CityResult is the outcome of one city's request in ForEachCity.
+type CityResult struct {
+	City string
+	Body []byte
+	Err  error
+}
+
+// CityRecord is a single record tagged with the city it was fetched for.
+type CityRecord struct {
+	City   string          `json:"City"`
+	Record json.RawMessage `json:"Record"`
+}
+
+// ForEachCity requests pathTemplate once per city, substituting "{city}" with the city code,
+// and runs at most concurrency requests at a time. If no cities are given, all Cities are used.
+// Results are returned in the order of the cities; the error joins every failed city's error.
+// Each request is tagged with its city, see CityRateBudget.
+func (proxy *TDXProxy) ForEachCity(ctx context.Context, pathTemplate string, q map[string]string, concurrency int, cities ...string) ([]CityResult, error) {
+	if !strings.Contains(pathTemplate, "{city}") {
+		return nil, fmt.Errorf("path template %q has no {city} placeholder", pathTemplate)
+	}
+	if len(cities) == 0 {
+		cities = Cities
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]CityResult, len(cities))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, city := range cities {
+		results[i].City = city
+		wg.Add(1)
+		go func(result *CityResult) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				result.Err = ctx.Err()
+				return
+			}
+			result.Body, result.Err = proxy.fetchBody(WithCity(ctx, result.City), strings.ReplaceAll(pathTemplate, "{city}", result.City), q)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.City, result.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// MergeCityResults flattens successful results into a single list of city-tagged records.
+// Failed cities are skipped.
+func MergeCityResults(results []CityResult) ([]CityRecord, error) {
+	var merged []CityRecord
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		records, err := DecodeRecords(result.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", result.City, err)
+		}
+		for _, record := range records {
+			merged = append(merged, CityRecord{City: result.City, Record: record})
+		}
+	}
+	return merged, nil
+}
+
+// fetchBody performs a GET bounded by ctx and returns the whole body.
+func (proxy *TDXProxy) fetchBody(ctx context.Context, url string, params map[string]string) ([]byte, error) {
+	resp, err := proxy.GetContext(ctx, url, params, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,136 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Fuzz targets for the code that handles caller-supplied input in gateway
+// mode. The seeds run with go test; explore further with e.g.
+//
+//	go test -run '^$' -fuzz FuzzGatewayQuery ./tdxproxy
+
+// FuzzGatewayQuery checks that any downstream query the gateway accepts is
+// forwarded to TDX with the same parameters, so a crafted value cannot add
+// or override parameters.
+func FuzzGatewayQuery(f *testing.F) {
+	f.Add("$filter=RouteName/Zh_tw eq '307'&$top=10")
+	f.Add("$select=StopUID,StopName&api_key=k&ts=1&sig=x")
+	f.Add("$filter=a%26%24top%3D1")
+	f.Add("a=%23b&c=d+e&f=%00")
+	f.Add("$format=JSON&$format=XML")
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+		params, err := gatewayQuery(query)
+		if err != nil {
+			return
+		}
+		proxy := NewTDXProxyNoAuth(nil)
+		u, err := url.Parse(proxy.buildFullURL("v2/Bus/Route/City/Taipei", params))
+		if err != nil {
+			t.Fatalf("built URL does not parse: %v", err)
+		}
+		if u.Fragment != "" {
+			t.Fatalf("built URL has fragment %q", u.Fragment)
+		}
+		forwarded := u.Query()
+		for k := range query {
+			if gatewayParams[k] {
+				if forwarded.Has(k) {
+					t.Fatalf("gateway parameter %q forwarded", k)
+				}
+				continue
+			}
+			if got := forwarded[k]; len(got) != 1 || got[0] != query.Get(k) {
+				t.Fatalf("parameter %q forwarded as %q, want %q", k, got, query.Get(k))
+			}
+		}
+		for k := range forwarded {
+			if !query.Has(k) {
+				t.Fatalf("unexpected parameter %q forwarded", k)
+			}
+		}
+	})
+}
+
+func FuzzValidateFilter(f *testing.F) {
+	f.Add("RouteName/Zh_tw eq '307'")
+	f.Add("(UpdateTime gt 2024-05-01T10:00:00+08:00) and contains(StopName/Zh_tw, 'O''Brien')")
+	f.Add("((a eq 1)")
+	f.Add("a eq ')'")
+	f.Add("a eq 'x\x00'")
+	f.Add("\xff")
+	f.Fuzz(func(t *testing.T, filter string) {
+		if err := ValidateFilter(filter); err != nil {
+			return
+		}
+		// An accepted filter is combined with others by wrapping it in
+		// parentheses, which must keep it valid.
+		if err := ValidateFilter("(" + filter + ") and x eq 1"); err != nil {
+			t.Fatalf("valid filter %q invalid once combined: %v", filter, err)
+		}
+	})
+}
+
+// FuzzBoundingBoxFilter checks that the filters built by the spatial helpers
+// pass ValidateFilter for any valid box.
+func FuzzBoundingBoxFilter(f *testing.F) {
+	f.Add(25.0, 121.5, 25.1, 121.6)
+	f.Add(-10.0, 179.0, 10.0, -179.0)
+	f.Add(-90.0, -180.0, 90.0, 180.0)
+	f.Fuzz(func(t *testing.T, south, west, north, east float64) {
+		box, err := NewBoundingBox(south, west, north, east)
+		if err != nil {
+			return
+		}
+		filter, err := url.QueryUnescape(box.Filter("StopPosition"))
+		if err != nil {
+			t.Fatalf("filter is not query-escaped: %v", err)
+		}
+		if err := ValidateFilter(filter); err != nil {
+			t.Fatalf("filter %q rejected: %v", filter, err)
+		}
+		combined, err := url.QueryUnescape(updateFilter("UpdateTime", time.Unix(0, 0), box.Filter("StopPosition")))
+		if err != nil {
+			t.Fatalf("combined filter is not query-escaped: %v", err)
+		}
+		if err := ValidateFilter(combined); err != nil {
+			t.Fatalf("combined filter %q rejected: %v", combined, err)
+		}
+	})
+}
+
+// FuzzDecodeRecords checks that the envelope parser never panics and that
+// every record it returns is valid JSON.
+func FuzzDecodeRecords(f *testing.F) {
+	f.Add([]byte(`[{"StopUID":"TPE1"},{"StopUID":"TPE2"}]`))
+	f.Add([]byte(`{"UpdateTime":"2024-05-01T10:00:00+08:00","Stops":[{"StopUID":"TPE1"}]}`))
+	f.Add([]byte(`{"A":[],"B":[]}`))
+	f.Add([]byte(`{"Count":1}`))
+	f.Add([]byte(` [1, "two", null] `))
+	f.Add([]byte(`[{"a":`))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, body []byte) {
+		records, err := DecodeRecords(body)
+		if err != nil {
+			return
+		}
+		for i, record := range records {
+			if !json.Valid(record) {
+				t.Fatalf("record %d is not valid JSON: %q", i, record)
+			}
+		}
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			var all []any
+			if err := json.Unmarshal(trimmed, &all); err != nil || len(all) != len(records) {
+				t.Fatalf("decoded %d records, want %d (%v)", len(records), len(all), err)
+			}
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conditionalHeaders are forwarded from downstream clients to TDX unless a HeaderPolicy says otherwise.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+// gatewayParams are query parameters consumed by the gateway itself, which are
+// not forwarded to TDX.
+var gatewayParams = map[string]bool{"api_key": true, "ts": true, "sig": true}
+
+// validatorHeaders are copied onto 304 responses so downstream caches can refresh their entries.
+var validatorHeaders = []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Vary"}
+
+// Gateway serves TDX APIs over HTTP through a TDXProxy, so other services
+// can share one set of credentials and one cache.
+// The request path is used as the TDX path, e.g. GET /v2/Bus/Route/City/Taipei?$top=10.
+// /widget/departures serves ready-made departure boards, see serveWidget.
+type Gateway struct {
+	proxy   *TDXProxy
+	timeout time.Duration
+	watcher *Watcher
+
+	signingSecret []byte
+	maxSkew       time.Duration
+	keys          *KeyStore
+	adminToken    string
+	cors          *CORSConfig
+
+	// routesMu guards the settings that can change while serving.
+	routesMu    sync.RWMutex
+	transforms  []TransformRule
+	cachedPaths []string
+	headers     *headerFilter
+	reload      func(ctx context.Context) error
+
+	accessLog        *slog.Logger
+	accessSampleRate float64
+
+	errorsMu     sync.Mutex
+	recentErrors []GatewayError
+
+	draining  chan struct{}
+	drainOnce sync.Once
+}
+
+func NewGateway(proxy *TDXProxy, timeout time.Duration) *Gateway {
+	return &Gateway{
+		proxy:    proxy,
+		timeout:  timeout,
+		draining: make(chan struct{}),
+	}
+}
+
+// Drain ends open event streams and WebSocket connections. http.Server.Shutdown
+// neither closes these long-lived connections nor, for WebSockets, waits for
+// them, so register Drain with http.Server.RegisterOnShutdown.
+func (g *Gateway) Drain() {
+	g.drainOnce.Do(func() { close(g.draining) })
+}
+
+// SetWatcher enables the push routes for the watcher's change events:
+// /stream/<endpoint> sends a watched endpoint's events as server-sent events,
+// and /ws accepts WebSocket clients subscribing to any set of watched endpoints.
+func (g *Gateway) SetWatcher(watcher *Watcher) {
+	g.watcher = watcher
+}
+
+// SetTransforms sets the rules reshaping JSON responses per TDX path; the
+// first matching rule applies. Passing nil serves responses unchanged.
+// It may be called while the gateway is serving.
+func (g *Gateway) SetTransforms(rules []TransformRule) {
+	g.routesMu.Lock()
+	defer g.routesMu.Unlock()
+	g.transforms = rules
+}
+
+// SetCachedPaths limits caching to TDX paths matching one of the path.Match
+// patterns; other requests bypass the proxy's cache. Passing nil caches every
+// path. It may be called while the gateway is serving.
+func (g *Gateway) SetCachedPaths(patterns []string) {
+	g.routesMu.Lock()
+	defer g.routesMu.Unlock()
+	g.cachedPaths = patterns
+}
+
+// routeSettings returns the transform and request options for a TDX path.
+func (g *Gateway) routeSettings(tdxPath string) (Transform, bool, []RequestOption) {
+	g.routesMu.RLock()
+	defer g.routesMu.RUnlock()
+	transform, ok := matchTransform(g.transforms, tdxPath)
+	if len(g.cachedPaths) == 0 {
+		return transform, ok, nil
+	}
+	for _, pattern := range g.cachedPaths {
+		if matched, _ := pathpkg.Match(pattern, tdxPath); matched {
+			return transform, ok, nil
+		}
+	}
+	return transform, ok, []RequestOption{NoCache(), NoStore()}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.accessLog != nil {
+		g.serveLogged(w, r)
+		return
+	}
+	g.serve(w, r)
+}
+
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) {
+	// Preflight requests carry no credentials, so they are answered first.
+	if g.handleCORS(w, r) {
+		return
+	}
+	// The admin routes have their own token, and the dashboard a browser
+	// loads cannot sign its requests.
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		g.serveAdmin(w, r)
+		return
+	}
+	if g.signingSecret != nil && !g.verifySignature(r) {
+		g.proxy.log(r.Context(), slog.LevelWarn, "Rejected unsigned gateway request", slog.String("path", r.URL.Path), slog.String("remote", r.RemoteAddr))
+		http.Error(w, "invalid or missing request signature", http.StatusUnauthorized)
+		return
+	}
+	if g.keys != nil && !g.checkAPIKey(w, r) {
+		return
+	}
+	if r.URL.Path == "/ws" {
+		g.serveWebSocket(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/stream/") {
+		g.serveStream(w, r, strings.TrimPrefix(r.URL.Path, "/stream/"))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/widget/") {
+		g.serveWidget(w, r, strings.TrimPrefix(r.URL.Path, "/widget/"))
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	params, err := gatewayQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers := g.forwardHeaders(r)
+
+	transform, transformed, opts := g.routeSettings(path)
+	resp, err := g.proxy.GetContext(r.Context(), path, params, headers, g.timeout, opts...)
+	if err != nil {
+		g.proxy.log(r.Context(), slog.LevelError, "Gateway request failed", slog.String("path", path), slog.String("error", err.Error()))
+		var statusErr *StatusError
+		status := http.StatusBadGateway
+		if errors.As(err, &statusErr) {
+			status = statusErr.StatusCode
+		}
+		g.recordError(path, status, err)
+		if statusErr != nil {
+			g.copyResponseHeaders(w, statusErr.Header)
+			w.WriteHeader(statusErr.StatusCode)
+			w.Write(statusErr.Body)
+			return
+		}
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified || notModified(r, resp.Header) {
+		for _, name := range validatorHeaders {
+			if v := resp.Header.Get(name); v != "" {
+				w.Header().Set(name, v)
+			}
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body io.Reader = resp.Body
+	if transformed && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		transformed, err := g.transform(transform, resp)
+		if err != nil {
+			g.proxy.log(r.Context(), slog.LevelError, "Failed to transform gateway response", slog.String("path", path), slog.String("error", err.Error()))
+			g.recordError(path, http.StatusBadGateway, err)
+			http.Error(w, "failed to transform response", http.StatusBadGateway)
+			return
+		}
+		body = bytes.NewReader(transformed)
+	}
+
+	g.copyResponseHeaders(w, resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		g.proxy.log(r.Context(), slog.LevelWarn, "Failed to write gateway response", slog.String("path", path), slog.String("error", err.Error()))
+	}
+}
+
+// notModified reports whether the downstream request's validators match the
+// response, in which case a 304 can be returned without a body.
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		return !modified.After(since)
+	}
+	return false
+}
+
+// transform applies t to the response body and adjusts resp's headers to the
+// new representation. The ETag is made weak, as the body no longer matches
+// TDX's byte for byte.
+func (g *Gateway) transform(t Transform, resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	data, contentType, err := t.Apply(data)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set("Content-Type", contentType)
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+	return data, nil
+}
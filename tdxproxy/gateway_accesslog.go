@@ -0,0 +1,82 @@
+package tdxproxy
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+)
+
+// SetAccessLog makes the gateway write one log line per request to logger,
+// with the method, path, status, latency, whether the response came from the
+// cache and the name of the consumer's API key. Only a sampleRate fraction,
+// between 0 and 1, of successful requests is logged; failed ones (status 400
+// and above) always are. Passing a nil logger turns access logging off.
+func (g *Gateway) SetAccessLog(logger *slog.Logger, sampleRate float64) {
+	if sampleRate < 0 || sampleRate > 1 {
+		g.proxy.logger.Warn("Access log sample rate out of range provided", slog.Float64("rate", sampleRate))
+		sampleRate = min(max(sampleRate, 0), 1)
+	}
+	g.accessLog = logger
+	g.accessSampleRate = sampleRate
+}
+
+// statusRecorder captures the status of a response for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// event streams and WebSocket upgrades need.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (g *Gateway) serveLogged(w http.ResponseWriter, r *http.Request) {
+	start := g.proxy.clock.Now()
+	info := &RequestInfo{}
+	recorder := &statusRecorder{ResponseWriter: w}
+	g.serve(recorder, r.WithContext(CaptureRequestInfo(r.Context(), info)))
+
+	status := recorder.status
+	if status == 0 {
+		// Hijacked connections, such as WebSocket upgrades, write no status.
+		status = http.StatusSwitchingProtocols
+	}
+	if status < http.StatusBadRequest && rand.Float64() >= g.accessSampleRate {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+		slog.Duration("latency", g.proxy.clock.Now().Sub(start)),
+		slog.Int64("bytes", recorder.bytes),
+		slog.Bool("cache_hit", info.FromCache),
+		slog.String("remote", r.RemoteAddr),
+	}
+	if g.keys != nil {
+		attrs = append(attrs, slog.String("consumer", g.keys.name(requestAPIKey(r))))
+	}
+	if info.Attempts > 1 {
+		attrs = append(attrs, slog.Int("attempts", info.Attempts))
+	}
+	g.accessLog.LogAttrs(r.Context(), slog.LevelInfo, "Gateway request", attrs...)
+}
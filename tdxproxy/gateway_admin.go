@@ -0,0 +1,192 @@
+package tdxproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIKeyHeader carries a client's gateway API key; the api_key query
+// parameter is accepted as well.
+const APIKeyHeader = "X-API-Key"
+
+// SetKeyStore makes the gateway require an API key issued by store on every
+// request other than the admin routes, and enforce the key's quotas.
+func (g *Gateway) SetKeyStore(store *KeyStore) {
+	g.keys = store
+}
+
+// SetAdminToken enables the admin routes, which require the token as a
+// bearer token, and a dashboard page at /admin/ that displays them:
+//
+//	GET    /admin/keys        list API keys with their usage
+//	POST   /admin/keys        issue a key from {"name", "daily_quota", "rate", "burst"}
+//	DELETE /admin/keys/<key>  revoke a key
+//	GET    /admin/stats       proxy request counters and credential health
+//	GET    /admin/errors      recent failed requests
+//	GET    /admin/recent      recent upstream exchanges, see TDXProxy.SetDebugBuffer
+//	POST   /admin/reload      reload configuration, see SetReloadFunc
+func (g *Gateway) SetAdminToken(token string) {
+	if token == "" {
+		g.proxy.logger.Warn("Empty admin token provided")
+		return
+	}
+	g.adminToken = token
+}
+
+// SetReloadFunc sets the function POST /admin/reload runs to reapply the
+// gateway's configuration.
+func (g *Gateway) SetReloadFunc(reload func(ctx context.Context) error) {
+	g.routesMu.Lock()
+	defer g.routesMu.Unlock()
+	g.reload = reload
+}
+
+// checkAPIKey counts the request against its key and writes an error
+// response if it is refused.
+func (g *Gateway) checkAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	err := g.keys.Allow(requestAPIKey(r))
+	if err == nil {
+		return true
+	}
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+		http.Error(w, quotaErr.Reason, http.StatusTooManyRequests)
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+	return false
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+func (g *Gateway) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if g.adminToken == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == "/admin/" {
+		g.serveDashboard(w, r)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(g.adminToken)) != 1 {
+		http.Error(w, "invalid admin token", http.StatusUnauthorized)
+		return
+	}
+
+	route := strings.TrimPrefix(r.URL.Path, "/admin/")
+	switch {
+	case route == "stats" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, g.proxy.Stats())
+	case route == "errors" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, g.RecentErrors())
+	case route == "recent" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, g.proxy.Debug().Recent())
+	case route == "reload" && r.Method == http.MethodPost:
+		g.serveReload(w, r)
+	case route == "keys" && r.Method == http.MethodGet:
+		g.listKeys(w)
+	case route == "keys" && r.Method == http.MethodPost:
+		g.issueKey(w, r)
+	case strings.HasPrefix(route, "keys/") && r.Method == http.MethodDelete:
+		g.revokeKey(w, r, strings.TrimPrefix(route, "keys/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (g *Gateway) serveReload(w http.ResponseWriter, r *http.Request) {
+	g.routesMu.RLock()
+	reload := g.reload
+	g.routesMu.RUnlock()
+	if reload == nil {
+		http.Error(w, "reloading is not configured", http.StatusNotImplemented)
+		return
+	}
+	if err := reload(r.Context()); err != nil {
+		g.proxy.log(r.Context(), slog.LevelError, "Failed to reload configuration", slog.String("error", err.Error()))
+		http.Error(w, "reload failed: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) listKeys(w http.ResponseWriter) {
+	type keyInfo struct {
+		APIKey
+		Usage KeyUsage `json:"usage"`
+	}
+	if g.keys == nil {
+		writeJSON(w, http.StatusOK, []keyInfo{})
+		return
+	}
+	usage := g.keys.Usage()
+	keys := g.keys.Keys()
+	infos := make([]keyInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = keyInfo{APIKey: key, Usage: usage[key.Key]}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (g *Gateway) issueKey(w http.ResponseWriter, r *http.Request) {
+	if g.keys == nil {
+		http.Error(w, "API keys are not enabled", http.StatusConflict)
+		return
+	}
+	var req struct {
+		Name       string  `json:"name"`
+		DailyQuota int64   `json:"daily_quota"`
+		Rate       float64 `json:"rate"`
+		Burst      int     `json:"burst"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+		http.Error(w, "expected a JSON body with a name", http.StatusBadRequest)
+		return
+	}
+	key, err := g.keys.Issue(req.Name, req.DailyQuota, req.Rate, req.Burst)
+	if err != nil {
+		g.proxy.log(r.Context(), slog.LevelError, "Failed to issue API key", slog.String("error", err.Error()))
+		http.Error(w, "failed to issue key", http.StatusInternalServerError)
+		return
+	}
+	g.proxy.log(r.Context(), slog.LevelInfo, "Issued API key", slog.String("name", key.Name))
+	writeJSON(w, http.StatusCreated, key)
+}
+
+func (g *Gateway) revokeKey(w http.ResponseWriter, r *http.Request, key string) {
+	if g.keys == nil {
+		http.NotFound(w, r)
+		return
+	}
+	found, err := g.keys.Revoke(key)
+	if err != nil {
+		g.proxy.log(r.Context(), slog.LevelError, "Failed to revoke API key", slog.String("error", err.Error()))
+		http.Error(w, "failed to revoke key", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,102 @@
+package tdxproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGatewaySignature(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	const target = "/v2/Bus/Route/City/Taipei?$top=1"
+
+	// query signs target with the ts and sig parameters instead of headers.
+	query := func(secret []byte, at time.Time) string {
+		ts := strconv.FormatInt(at.Unix(), 10)
+		u, _ := url.Parse(target)
+		q := u.Query()
+		sig := requestSignature(secret, ts, u.EscapedPath()+"?"+q.Encode())
+		q.Set("ts", ts)
+		q.Set("sig", sig)
+		return u.Path + "?" + q.Encode()
+	}
+	tests := []struct {
+		name string
+		req  func() *http.Request
+		want int
+	}{
+		{"valid", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now)
+			return r
+		}, http.StatusOK},
+		{"valid query", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, query(secret, now), nil)
+		}, http.StatusOK},
+		{"within skew", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now.Add(-4*time.Minute))
+			return r
+		}, http.StatusOK},
+		{"unsigned", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, target, nil)
+		}, http.StatusUnauthorized},
+		{"wrong secret", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, []byte("other"), now)
+			return r
+		}, http.StatusUnauthorized},
+		{"wrong secret query", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, query([]byte("other"), now), nil)
+		}, http.StatusUnauthorized},
+		{"other URI", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now)
+			r.URL.RawQuery = "$top=1000"
+			return r
+		}, http.StatusUnauthorized},
+		{"expired", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now.Add(-6*time.Minute))
+			return r
+		}, http.StatusUnauthorized},
+		{"expired query", func() *http.Request {
+			return httptest.NewRequest(http.MethodGet, query(secret, now.Add(-6*time.Minute)), nil)
+		}, http.StatusUnauthorized},
+		{"future", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now.Add(6*time.Minute))
+			return r
+		}, http.StatusUnauthorized},
+		{"bad timestamp", func() *http.Request {
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			SignRequest(r, secret, now)
+			r.Header.Set(SignatureTimestampHeader, "yesterday")
+			return r
+		}, http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, calls := retryServer(t, func(_ int64, w http.ResponseWriter) {
+				io.WriteString(w, "[]")
+			})
+			proxy.SetClock(NewManualClock(now))
+			gateway := NewGateway(proxy, time.Second)
+			gateway.RequireSignature(secret, 5*time.Minute)
+
+			w := httptest.NewRecorder()
+			gateway.ServeHTTP(w, tc.req())
+			if w.Code != tc.want {
+				t.Errorf("got %d %q, want %d", w.Code, w.Body, tc.want)
+			}
+			if forwarded := calls.Load() > 0; forwarded != (tc.want == http.StatusOK) {
+				t.Errorf("forwarded = %v with status %d", forwarded, w.Code)
+			}
+		})
+	}
+}
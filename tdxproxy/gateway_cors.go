@@ -0,0 +1,77 @@
+package tdxproxy
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig controls which browser origins may call the gateway.
+type CORSConfig struct {
+	// AllowedOrigins lists origins such as "https://app.example.com".
+	// "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedHeaders are the request headers browsers may send, in addition
+	// to the CORS-safelisted ones. Empty allows the headers the gateway reads:
+	// the conditional, API key and signature headers.
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// exposedHeaders are response headers browser code may read.
+var exposedHeaders = []string{"ETag", "Last-Modified", "Age", "Retry-After"}
+
+// SetCORS enables CORS handling, answering preflight requests and adding the
+// Access-Control headers for allowed origins. Passing nil disables it.
+func (g *Gateway) SetCORS(config *CORSConfig) {
+	if config != nil && len(config.AllowedHeaders) == 0 {
+		c := *config
+		c.AllowedHeaders = append(append([]string{}, conditionalHeaders...), APIKeyHeader, SignatureTimestampHeader, SignatureHeader, "Authorization")
+		config = &c
+	}
+	g.cors = config
+}
+
+// handleCORS adds CORS headers to the response and reports whether the
+// request was a preflight, which has then been answered.
+func (g *Gateway) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if g.cors == nil || origin == "" {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	if !g.originAllowed(origin) {
+		return false
+	}
+	if slices.Contains(g.cors.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		return false
+	}
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(g.cors.AllowedHeaders, ", "))
+	if g.cors.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(g.cors.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (g *Gateway) originAllowed(origin string) bool {
+	for _, allowed := range g.cors.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
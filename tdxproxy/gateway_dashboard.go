@@ -0,0 +1,51 @@
+package tdxproxy
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+// recentErrorLimit is how many failed gateway requests are kept for the dashboard.
+const recentErrorLimit = 50
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// GatewayError is a failed gateway request, as listed by /admin/errors.
+type GatewayError struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error"`
+}
+
+// RecentErrors returns the most recent failed requests, oldest first.
+func (g *Gateway) RecentErrors() []GatewayError {
+	g.errorsMu.Lock()
+	defer g.errorsMu.Unlock()
+	return append([]GatewayError{}, g.recentErrors...)
+}
+
+func (g *Gateway) recordError(path string, status int, err error) {
+	g.errorsMu.Lock()
+	defer g.errorsMu.Unlock()
+	if len(g.recentErrors) == recentErrorLimit {
+		g.recentErrors = append(g.recentErrors[:0], g.recentErrors[1:]...)
+	}
+	g.recentErrors = append(g.recentErrors, GatewayError{Time: g.proxy.clock.Now(), Path: path, Status: status, Error: err.Error()})
+}
+
+// serveDashboard serves the dashboard page. The page itself holds no data and
+// is served without the admin token; its script asks for the token and sends
+// it with the requests for the admin routes it displays.
+func (g *Gateway) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Write(dashboardHTML)
+}
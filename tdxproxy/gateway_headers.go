@@ -0,0 +1,147 @@
+package tdxproxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders apply to a single connection and are never forwarded in
+// either direction, along with any header named in Connection.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// credentialHeaders carry the downstream client's credentials, which are
+// meant for the gateway, and are never forwarded to TDX whatever the policy.
+var credentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+	APIKeyHeader,
+	SignatureHeader,
+	SignatureTimestampHeader,
+}
+
+// transportHeaders are set by the proxy's HTTP client, which also decodes
+// compressed responses only when it asked for them itself.
+var transportHeaders = []string{
+	"Accept-Encoding",
+	"Content-Length",
+	"Host",
+}
+
+// HeaderPolicy selects the downstream request headers the gateway forwards
+// to TDX. Header names are case-insensitive. Forwarded headers are not part
+// of the cache key, so headers that change the response should only be
+// allowed for paths that are not cached.
+type HeaderPolicy struct {
+	// Allow lists the headers to forward, or "*" for all. An empty policy
+	// forwards only the conditional headers If-None-Match and If-Modified-Since.
+	Allow []string `json:"allow" yaml:"allow"`
+	// Deny lists headers never to forward, taking precedence over Allow.
+	Deny []string `json:"deny" yaml:"deny"`
+}
+
+// headerFilter is a HeaderPolicy prepared for lookups by canonical name.
+type headerFilter struct {
+	allowAll bool
+	allow    map[string]bool
+	deny     map[string]bool
+}
+
+func newHeaderFilter(policy HeaderPolicy) *headerFilter {
+	f := &headerFilter{allow: map[string]bool{}, deny: map[string]bool{}}
+	allow := policy.Allow
+	if len(allow) == 0 {
+		allow = conditionalHeaders
+	}
+	for _, name := range allow {
+		if name == "*" {
+			f.allowAll = true
+			continue
+		}
+		f.allow[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, names := range [][]string{policy.Deny, hopByHopHeaders, credentialHeaders, transportHeaders} {
+		for _, name := range names {
+			f.deny[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	return f
+}
+
+// SetHeaderPolicy replaces the policy selecting the request headers forwarded to TDX.
+func (g *Gateway) SetHeaderPolicy(policy HeaderPolicy) {
+	filter := newHeaderFilter(policy)
+	g.routesMu.Lock()
+	defer g.routesMu.Unlock()
+	g.headers = filter
+}
+
+// forwardHeaders returns the headers of r to send to TDX.
+func (g *Gateway) forwardHeaders(r *http.Request) map[string]string {
+	g.routesMu.RLock()
+	filter := g.headers
+	g.routesMu.RUnlock()
+	if filter == nil {
+		filter = defaultHeaderFilter
+	}
+
+	connection := connectionTokens(r.Header)
+	headers := map[string]string{}
+	for name, values := range r.Header {
+		name = http.CanonicalHeaderKey(name)
+		if filter.deny[name] || connection[name] || !filter.allowAll && !filter.allow[name] {
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+var defaultHeaderFilter = newHeaderFilter(HeaderPolicy{})
+
+// copyResponseHeaders copies upstream response headers to w, leaving out
+// hop-by-hop headers and, when the gateway answers CORS itself, upstream
+// Access-Control headers.
+func (g *Gateway) copyResponseHeaders(w http.ResponseWriter, header http.Header) {
+	connection := connectionTokens(header)
+	for k, values := range header {
+		if connection[k] || isHopByHop(k) || g.cors != nil && strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+}
+
+func isHopByHop(name string) bool {
+	for _, h := range hopByHopHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionTokens returns the canonical names of the headers listed in the
+// Connection header, which are hop-by-hop for this message.
+func connectionTokens(header http.Header) map[string]bool {
+	tokens := map[string]bool{}
+	for _, v := range header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens[http.CanonicalHeaderKey(token)] = true
+			}
+		}
+	}
+	return tokens
+}
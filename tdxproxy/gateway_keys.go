@@ -0,0 +1,246 @@
+package tdxproxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// APIKey is a gateway client key and its quotas. Zero quotas mean unlimited.
+type APIKey struct {
+	Key     string    `json:"key"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// DailyQuota caps requests per day, counted in Taiwan time.
+	DailyQuota int64 `json:"daily_quota,omitempty"`
+	// Rate caps requests per second, allowing bursts of up to Burst requests.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// KeyUsage is the request accounting of an API key.
+type KeyUsage struct {
+	Name string `json:"name"`
+	// Day is the date Today counts requests for, 2006-01-02.
+	Day      string `json:"day"`
+	Today    int64  `json:"today"`
+	Total    int64  `json:"total"`
+	Rejected int64  `json:"rejected"`
+}
+
+// QuotaError explains why a request was refused by a KeyStore.
+type QuotaError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return e.Reason
+}
+
+// ErrUnknownKey is returned for requests with a missing or unknown API key.
+var ErrUnknownKey = errors.New("unknown API key")
+
+type keyState struct {
+	APIKey
+	Usage KeyUsage `json:"usage"`
+
+	tokens float64
+	last   time.Time
+}
+
+// KeyStore issues gateway API keys and enforces their quotas. Keys and usage
+// are kept in a JSON file, written whenever keys change and on Save.
+type KeyStore struct {
+	path  string
+	clock Clock
+
+	mu   sync.Mutex
+	keys map[string]*keyState
+}
+
+// OpenKeyStore loads the key store at path, starting empty if the file does
+// not exist. An empty path keeps keys in memory only.
+func OpenKeyStore(path string) (*KeyStore, error) {
+	store := &KeyStore{path: path, clock: systemClock{}, keys: make(map[string]*keyState)}
+	if path == "" {
+		return store, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+	var keys []*keyState
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse key store: %w", err)
+	}
+	for _, k := range keys {
+		store.keys[k.Key] = k
+	}
+	return store, nil
+}
+
+// Issue creates a key with a random value and saves the store.
+func (s *KeyStore) Issue(name string, dailyQuota int64, rate float64, burst int) (APIKey, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	if rate > 0 && burst < 1 {
+		burst = max(1, int(rate))
+	}
+	key := APIKey{
+		Key:        hex.EncodeToString(secret),
+		Name:       name,
+		Created:    s.clock.Now(),
+		DailyQuota: dailyQuota,
+		Rate:       rate,
+		Burst:      burst,
+	}
+
+	s.mu.Lock()
+	s.keys[key.Key] = &keyState{APIKey: key, Usage: KeyUsage{Name: name}, tokens: float64(burst)}
+	err := s.saveLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// Revoke deletes a key and saves the store. It reports whether the key existed.
+func (s *KeyStore) Revoke(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; !ok {
+		return false, nil
+	}
+	delete(s.keys, key)
+	return true, s.saveLocked()
+}
+
+// Keys lists the issued keys sorted by key.
+func (s *KeyStore) Keys() []APIKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range sortedKeys(s.keys) {
+		keys = append(keys, s.keys[k].APIKey)
+	}
+	return keys
+}
+
+// Usage returns the accounting of every key, by key.
+func (s *KeyStore) Usage() map[string]KeyUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := s.day()
+	usage := make(map[string]KeyUsage, len(s.keys))
+	for k, state := range s.keys {
+		u := state.Usage
+		if u.Day != day {
+			u.Day, u.Today = day, 0
+		}
+		usage[k] = u
+	}
+	return usage
+}
+
+// name returns the name of key, or "" if it is unknown.
+func (s *KeyStore) name(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.keys[key]; ok {
+		return state.Name
+	}
+	return ""
+}
+
+// Allow counts a request against key. It returns ErrUnknownKey or a
+// *QuotaError if the request must be refused.
+func (s *KeyStore) Allow(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.keys[key]
+	if !ok {
+		return ErrUnknownKey
+	}
+	now := s.clock.Now()
+	if day := s.day(); state.Usage.Day != day {
+		state.Usage.Day, state.Usage.Today = day, 0
+	}
+
+	if state.DailyQuota > 0 && state.Usage.Today >= state.DailyQuota {
+		state.Usage.Rejected++
+		t := now.In(taipei)
+		midnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, taipei)
+		return &QuotaError{Reason: "daily quota exceeded", RetryAfter: midnight.Sub(now)}
+	}
+	if state.Rate > 0 {
+		if state.last.IsZero() {
+			state.tokens = float64(state.Burst)
+		} else {
+			state.tokens = min(float64(state.Burst), state.tokens+now.Sub(state.last).Seconds()*state.Rate)
+		}
+		state.last = now
+		if state.tokens < 1 {
+			state.Usage.Rejected++
+			wait := time.Duration((1 - state.tokens) / state.Rate * float64(time.Second))
+			return &QuotaError{Reason: "rate limit exceeded", RetryAfter: wait}
+		}
+		state.tokens--
+	}
+	state.Usage.Today++
+	state.Usage.Total++
+	return nil
+}
+
+// Save writes keys and usage to the store's file.
+func (s *KeyStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *KeyStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	keys := make([]*keyState, 0, len(s.keys))
+	for _, k := range sortedKeys(s.keys) {
+		keys = append(keys, s.keys[k])
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode key store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".keys-*")
+	if err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	return nil
+}
+
+func (s *KeyStore) day() string {
+	return s.clock.Now().In(taipei).Format("2006-01-02")
+}
@@ -0,0 +1,106 @@
+package tdxproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// keyGateway serves "[]" through a gateway requiring keys from a store on
+// a manual clock.
+func keyGateway(t *testing.T, now time.Time) (*Gateway, *KeyStore, *ManualClock) {
+	t.Helper()
+	proxy, _ := retryServer(t, func(_ int64, w http.ResponseWriter) {
+		io.WriteString(w, "[]")
+	})
+	clock := NewManualClock(now)
+	proxy.SetClock(clock)
+	store, err := OpenKeyStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.clock = clock
+	gateway := NewGateway(proxy, time.Second)
+	gateway.SetKeyStore(store)
+	return gateway, store, clock
+}
+
+func keyRequest(gateway *Gateway, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/v2/Bus/Route/City/Taipei", nil)
+	r.Header.Set(APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, r)
+	return w
+}
+
+func TestKeyStoreDailyQuota(t *testing.T) {
+	// 23:00 in Taipei, an hour before the quota resets.
+	gateway, store, clock := keyGateway(t, time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC))
+	key, err := store.Issue("client", 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 3 {
+		if w := keyRequest(gateway, key.Key); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d %q", i+1, w.Code, w.Body)
+		}
+	}
+	w := keyRequest(gateway, key.Key)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over quota: got %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3600" {
+		t.Errorf("Retry-After %q, want the seconds until midnight in Taipei", got)
+	}
+	usage := store.Usage()[key.Key]
+	if usage.Today != 3 || usage.Total != 3 || usage.Rejected != 1 || usage.Day != "2024-05-01" {
+		t.Errorf("usage over quota: %+v", usage)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if w := keyRequest(gateway, key.Key); w.Code != http.StatusTooManyRequests {
+		t.Errorf("before midnight: got %d, want 429", w.Code)
+	}
+	clock.Advance(time.Minute)
+	if w := keyRequest(gateway, key.Key); w.Code != http.StatusOK {
+		t.Errorf("after midnight: got %d %q", w.Code, w.Body)
+	}
+	usage = store.Usage()[key.Key]
+	if usage.Today != 1 || usage.Total != 4 || usage.Day != "2024-05-02" {
+		t.Errorf("usage after the reset: %+v", usage)
+	}
+}
+
+func TestKeyStoreRate(t *testing.T) {
+	gateway, store, clock := keyGateway(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	key, err := store.Issue("client", 0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 2 {
+		if w := keyRequest(gateway, key.Key); w.Code != http.StatusOK {
+			t.Fatalf("burst request %d: got %d %q", i+1, w.Code, w.Body)
+		}
+	}
+	w := keyRequest(gateway, key.Key)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("after the burst: got %d with Retry-After %q, want 429 and 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	clock.Advance(time.Second)
+	if w := keyRequest(gateway, key.Key); w.Code != http.StatusOK {
+		t.Errorf("after a second: got %d %q", w.Code, w.Body)
+	}
+}
+
+func TestKeyStoreUnknownKey(t *testing.T) {
+	gateway, _, _ := keyGateway(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	for _, key := range []string{"", "nonexistent"} {
+		if w := keyRequest(gateway, key); w.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: got %d, want 401", key, w.Code)
+		}
+	}
+}
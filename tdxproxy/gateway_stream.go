@@ -0,0 +1,84 @@
+package tdxproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat is how often an idle event stream sends a comment line, which
+// keeps intermediaries from closing the connection.
+const streamHeartbeat = 15 * time.Second
+
+// serveStream pushes change events of a watched endpoint as server-sent events.
+// The latest known content is sent first, so clients render without waiting for a change.
+func (g *Gateway) serveStream(w http.ResponseWriter, r *http.Request, endpoint string) {
+	if g.watcher == nil || !g.watcher.IsWatched(endpoint) {
+		http.Error(w, "endpoint is not watched", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	events, unsubscribe := g.watcher.Subscribe(16)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event ChangeEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: change\ndata: %s\n\n", event.Hash, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if latest, ok := g.watcher.Latest(endpoint); ok {
+		if err := send(latest); err != nil {
+			return
+		}
+	} else if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-g.draining:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Endpoint != endpoint {
+				continue
+			}
+			if err := send(event); err != nil {
+				g.proxy.log(r.Context(), slog.LevelWarn, "Failed to write stream event", slog.String("url", endpoint), slog.String("error", err.Error()))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// widgetMaxAge is how long clients may reuse a departure board. TDX updates
+// estimates about every 20 seconds, so polling faster shows nothing new.
+const widgetMaxAge = 15 * time.Second
+
+// widgetLimit is the number of departures shown when the request sets no limit.
+const widgetLimit = 10
+
+// widgetDeparture is a departure as served by /widget/departures.
+type widgetDeparture struct {
+	Route       string     `json:"route"`
+	Destination string     `json:"destination,omitempty"`
+	Minutes     *int       `json:"minutes,omitempty"`
+	Expected    *time.Time `json:"expected,omitempty"`
+	Scheduled   bool       `json:"scheduled,omitempty"`
+	LastBus     bool       `json:"last_bus,omitempty"`
+	Status      string     `json:"status"`
+	Plate       string     `json:"plate,omitempty"`
+	// Text is the time or status as shown on the HTML board.
+	Text string `json:"text"`
+}
+
+type widgetBoard struct {
+	City       string            `json:"city"`
+	Stop       string            `json:"stop"`
+	Updated    time.Time         `json:"updated"`
+	Departures []widgetDeparture `json:"departures"`
+}
+
+// stopStatusZh are the Chinese labels of stop statuses on the HTML board.
+var stopStatusZh = map[StopStatus]string{
+	StopNotDeparted:  "尚未發車",
+	StopSkipped:      "交管不停靠",
+	StopLastPassed:   "末班車已過",
+	StopNotOperating: "今日未營運",
+}
+
+var widgetTemplate = template.Must(template.New("departures").Parse(`<table class="tdx-departures" data-city="{{.City}}" data-stop="{{.Stop}}">
+{{- range .Departures}}
+<tr class="tdx-departure{{if .LastBus}} tdx-last-bus{{end}}"><td class="tdx-route">{{.Route}}</td><td class="tdx-destination">{{.Destination}}</td><td class="tdx-time">{{.Text}}</td></tr>
+{{- end}}
+</table>
+`))
+
+// serveWidget serves /widget/departures?city=Taichung&stop=<StopUID>, the
+// DepartureBoard of a stop as compact JSON, or as an HTML table fragment with
+// format=html or when the client accepts text/html, for kiosks and signage.
+// lang=en selects English names and labels, and limit the number of
+// departures. Boards come from the proxy's cache like other requests.
+func (g *Gateway) serveWidget(w http.ResponseWriter, r *http.Request, name string) {
+	if name != "departures" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	city, stop, lang := query.Get("city"), query.Get("stop"), query.Get("lang")
+	if city == "" || stop == "" {
+		http.Error(w, "city and stop are required", http.StatusBadRequest)
+		return
+	}
+	if !validStopUID(stop) {
+		http.Error(w, "invalid stop", http.StatusBadRequest)
+		return
+	}
+	limit := widgetLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	departures, err := g.proxy.DepartureBoard(ctx, city, stop)
+	if err != nil {
+		if errors.Is(err, ErrUnknownCity) || errors.Is(err, ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		g.proxy.log(r.Context(), slog.LevelError, "Departure widget request failed", slog.String("city", city), slog.String("stop", stop), slog.String("error", err.Error()))
+		g.recordError(r.URL.Path, http.StatusBadGateway, err)
+		http.Error(w, "upstream request failed", http.StatusBadGateway)
+		return
+	}
+
+	now := g.proxy.clock.Now()
+	board := widgetBoard{City: city, Stop: stop, Updated: now, Departures: []widgetDeparture{}}
+	for _, d := range departures[:min(limit, len(departures))] {
+		board.Departures = append(board.Departures, widgetEntry(d, now, lang))
+	}
+
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(widgetMaxAge.Seconds())))
+	w.Header().Set("Vary", "Accept")
+	if query.Get("format") == "html" || query.Get("format") == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := widgetTemplate.Execute(w, board); err != nil {
+			g.proxy.log(r.Context(), slog.LevelWarn, "Failed to write departure widget", slog.String("error", err.Error()))
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, board)
+}
+
+// validStopUID reports whether stop looks like a StopUID, such as
+// "TXG12345". It keeps clients from passing arbitrary OData on to TDX.
+func validStopUID(stop string) bool {
+	for _, r := range stop {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return stop != ""
+}
+
+// widgetEntry converts a departure for the board, with its time as minutes
+// from now, or its status when it has no time.
+func widgetEntry(d Departure, now time.Time, lang string) widgetDeparture {
+	english := isEnglish(lang)
+	entry := widgetDeparture{
+		Route:       d.RouteName.In(lang),
+		Destination: d.Destination.In(lang),
+		Scheduled:   d.Scheduled,
+		LastBus:     d.IsLastBus,
+		Status:      d.Status.String(),
+		Plate:       d.PlateNumb,
+	}
+	switch {
+	case !d.Expected.IsZero():
+		expected := d.Expected
+		minutes := max(0, int(math.Ceil(expected.Sub(now).Minutes())))
+		entry.Expected, entry.Minutes = &expected, &minutes
+		switch {
+		case minutes <= 1 && !d.Scheduled && english:
+			entry.Text = "Arriving"
+		case minutes <= 1 && !d.Scheduled:
+			entry.Text = "進站中"
+		case d.Scheduled:
+			entry.Text = expected.In(taipei).Format("15:04")
+		case english:
+			entry.Text = strconv.Itoa(minutes) + " min"
+		default:
+			entry.Text = strconv.Itoa(minutes) + " 分"
+		}
+	case d.Status == StopNormal:
+		entry.Text = "--"
+	case english:
+		entry.Text = d.Status.String()
+	default:
+		entry.Text = stopStatusZh[d.Status]
+	}
+	return entry
+}
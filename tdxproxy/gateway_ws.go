@@ -0,0 +1,295 @@
+package tdxproxy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	// wsMaxMessage caps client messages; they only carry subscription commands.
+	wsMaxMessage = 64 << 10
+)
+
+// wsCommand is a message from a WebSocket client changing its subscriptions.
+type wsCommand struct {
+	Action   string `json:"action"`
+	Endpoint string `json:"endpoint"`
+}
+
+// wsConn is a minimal server side RFC 6455 connection: text messages out,
+// commands in, and control frames in both directions.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	mu   sync.Mutex
+}
+
+// serveWebSocket upgrades the request and pushes watcher change events for the
+// endpoints the client subscribed to, either with ?endpoint= query parameters
+// or with {"action":"subscribe"|"unsubscribe","endpoint":"<path>"} messages.
+// A ping is sent whenever the connection is idle for streamHeartbeat.
+func (g *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if g.watcher == nil {
+		http.Error(w, "no endpoints are watched", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+	ws := &wsConn{conn: conn, rw: rw}
+
+	filter := make(map[string]bool)
+	for _, endpoint := range r.URL.Query()["endpoint"] {
+		filter[strings.TrimPrefix(endpoint, "/")] = true
+	}
+
+	events, unsubscribe := g.watcher.Subscribe(16)
+	defer unsubscribe()
+
+	commands := make(chan wsCommand)
+	done := make(chan struct{})
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		defer close(done)
+		for {
+			msg, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+			var cmd wsCommand
+			if err := json.Unmarshal(msg, &cmd); err != nil {
+				ws.writeFrame(wsOpText, []byte(`{"error":"invalid command"}`))
+				continue
+			}
+			select {
+			case commands <- cmd:
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	for endpoint := range filter {
+		if latest, ok := g.watcher.Latest(endpoint); ok {
+			if err := ws.writeJSON(latest); err != nil {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-g.draining:
+			// 1001 "going away": the server is shutting down.
+			ws.writeFrame(wsOpClose, []byte{0x03, 0xE9})
+			return
+		case <-heartbeat.C:
+			if err := ws.writeFrame(wsOpPing, nil); err != nil {
+				return
+			}
+		case cmd := <-commands:
+			endpoint := strings.TrimPrefix(cmd.Endpoint, "/")
+			switch cmd.Action {
+			case "subscribe":
+				if !g.watcher.IsWatched(endpoint) {
+					ws.writeJSON(map[string]string{"error": "endpoint is not watched", "endpoint": endpoint})
+					continue
+				}
+				filter[endpoint] = true
+				if latest, ok := g.watcher.Latest(endpoint); ok {
+					ws.writeJSON(latest)
+				}
+			case "unsubscribe":
+				delete(filter, endpoint)
+			default:
+				ws.writeJSON(map[string]string{"error": "unknown action", "action": cmd.Action})
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !filter[event.Endpoint] {
+				continue
+			}
+			if err := ws.writeJSON(event); err != nil {
+				g.proxy.log(r.Context(), slog.LevelWarn, "Failed to write websocket event", slog.String("url", event.Endpoint), slog.String("error", err.Error()))
+				return
+			}
+		}
+	}
+}
+
+func (ws *wsConn) writeJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(wsOpText, data)
+}
+
+// writeFrame writes a single unmasked, unfragmented frame.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// readMessage returns the next text or binary message, answering pings and
+// close frames along the way.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			ws.writeFrame(wsOpClose, payload)
+			return nil, io.EOF
+		}
+		if opcode != wsOpContinuation {
+			message = message[:0]
+		}
+		message = append(message, payload...)
+		if len(message) > wsMaxMessage {
+			return nil, errors.New("websocket message too large")
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(ws.rw, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(ws.rw, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(ws.rw, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked {
+		err = errors.New("websocket client frame is not masked")
+		return
+	}
+	if length > wsMaxMessage {
+		err = errors.New("websocket frame too large")
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.rw, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.rw, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// headerContainsToken reports whether a comma-separated header contains token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,352 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// harBodyLimit caps the request and response body text kept per HAR entry.
+const harBodyLimit = 1 << 20
+
+// harRedacted replaces sensitive values in captures.
+const harRedacted = "REDACTED"
+
+// harSensitiveHeaders are removed from captured requests and responses.
+var harSensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"X-Date":        true,
+}
+
+// harSensitiveFields are redacted in form bodies and JSON responses, which
+// covers the secrets sent to and the tokens returned by the auth server,
+// including those of the grant types a TokenRequest can select.
+var harSensitiveFields = []string{
+	"client_secret", "access_token", "refresh_token", "id_token",
+	"password", "assertion", "client_assertion", "subject_token", "actor_token",
+}
+
+// harTokenFormFields are the fields of a token request, a form with a
+// grant_type, that are kept. Every other field may carry a credential of a
+// custom grant and is redacted.
+var harTokenFormFields = map[string]bool{"grant_type": true, "client_id": true, "scope": true, "audience": true}
+
+// HARRecorder captures the requests a proxy sends in HTTP Archive (HAR 1.2)
+// form, for attaching reproducible captures to bug reports. Credentials,
+// tokens and cookies are redacted, and bodies are kept up to 1 MiB each.
+type HARRecorder struct {
+	proxy *TDXProxy
+	base  http.RoundTripper
+	path  string
+	clock Clock
+
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// CaptureHAR starts recording every request the proxy sends, including auth
+// requests, until the returned recorder is closed, which writes the HAR file
+// to path and restores the previous transport.
+func (proxy *TDXProxy) CaptureHAR(path string) *HARRecorder {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	recorder := &HARRecorder{proxy: proxy, base: proxy.transport, path: path, clock: proxy.clock}
+	proxy.transport = recorder
+	return recorder
+}
+
+// Close stops recording and writes the capture to its file.
+func (r *HARRecorder) Close() error {
+	r.proxy.mu.Lock()
+	if r.proxy.transport == http.RoundTripper(r) {
+		r.proxy.transport = r.base
+	}
+	r.proxy.mu.Unlock()
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to create HAR file: %w", err)
+	}
+	if _, err := r.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// WriteTo writes the entries captured so far as a HAR document.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	entries := append([]harEntry(nil), r.entries...)
+	r.mu.Unlock()
+	if entries == nil {
+		entries = []harEntry{}
+	}
+
+	doc := map[string]any{
+		"log": map[string]any{
+			"version": "1.2",
+			"creator": map[string]string{"name": "tdxproxy", "version": "1"},
+			"entries": entries,
+		},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode HAR: %w", err)
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+func (r *HARRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := r.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var requestBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		requestBody = body
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	start := r.clock.Now()
+	resp, err := base.RoundTrip(req)
+	wait := float64(r.clock.Now().Sub(start)) / float64(time.Millisecond)
+
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            wait,
+		Request:         newHARRequest(req, requestBody),
+		Cache:           struct{}{},
+		Timings:         harTimings{Wait: wait},
+	}
+	if err != nil {
+		entry.Response = harResponse{Status: 0, StatusText: err.Error(), HTTPVersion: "HTTP/1.1", Headers: []harPair{}, Cookies: []harPair{}, HeadersSize: -1, BodySize: -1}
+		r.add(entry)
+		return nil, err
+	}
+	resp.Body = &harBody{ReadCloser: resp.Body, recorder: r, entry: entry, resp: resp}
+	return resp, nil
+}
+
+func (r *HARRecorder) add(entry harEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// harBody copies the response body as the caller reads it and adds the entry
+// when the body is closed.
+type harBody struct {
+	io.ReadCloser
+	recorder *HARRecorder
+	entry    harEntry
+	resp     *http.Response
+	buf      bytes.Buffer
+	size     int64
+	once     sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := harBodyLimit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.entry.Response = newHARResponse(b.resp, b.buf.Bytes(), b.size)
+		b.recorder.add(b.entry)
+	})
+	return err
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Headers     []harPair    `json:"headers"`
+	QueryString []harPair    `json:"queryString"`
+	Cookies     []harPair    `json:"cookies"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int          `json:"bodySize"`
+	PostData    *harPostData `json:"postData,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Headers     []harPair  `json:"headers"`
+	Cookies     []harPair  `json:"cookies"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int64      `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHARRequest(req *http.Request, body []byte) harRequest {
+	captured := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     harHeaders(req.Header),
+		QueryString: []harPair{},
+		Cookies:     []harPair{},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			captured.QueryString = append(captured.QueryString, harPair{Name: name, Value: value})
+		}
+	}
+	if body != nil {
+		mimeType := req.Header.Get("Content-Type")
+		text := string(body[:min(len(body), harBodyLimit)])
+		if strings.HasPrefix(mimeType, "application/x-www-form-urlencoded") {
+			text = redactForm(text)
+		}
+		captured.PostData = &harPostData{MimeType: mimeType, Text: text}
+	}
+	return captured
+}
+
+func newHARResponse(resp *http.Response, body []byte, size int64) harResponse {
+	mimeType := resp.Header.Get("Content-Type")
+	content := harContent{Size: size, MimeType: mimeType}
+	switch {
+	case strings.Contains(mimeType, "json"):
+		content.Text = redactJSON(body)
+	case utf8.Valid(body):
+		content.Text = string(body)
+	default:
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	if size > int64(len(body)) {
+		content.Comment = fmt.Sprintf("body truncated to %d bytes", harBodyLimit)
+	}
+	return harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Headers:     harHeaders(resp.Header),
+		Cookies:     []harPair{},
+		Content:     content,
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    size,
+	}
+}
+
+func harHeaders(header http.Header) []harPair {
+	pairs := []harPair{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			if harSensitiveHeaders[name] {
+				value = harRedacted
+			}
+			pairs = append(pairs, harPair{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// redactForm redacts sensitive fields of a URL-encoded form, and of a token
+// request every field not in harTokenFormFields.
+func redactForm(text string) string {
+	values, err := url.ParseQuery(text)
+	if err != nil {
+		return harRedacted
+	}
+	if values.Has("grant_type") {
+		for field := range values {
+			if !harTokenFormFields[field] {
+				values.Set(field, harRedacted)
+			}
+		}
+		return values.Encode()
+	}
+	for _, field := range harSensitiveFields {
+		if values.Has(field) {
+			values.Set(field, harRedacted)
+		}
+	}
+	return values.Encode()
+}
+
+// redactJSON redacts sensitive top-level fields of a JSON object. Other
+// bodies, including truncated ones, are returned unchanged.
+func redactJSON(body []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(body)
+	}
+	redacted := false
+	for _, field := range harSensitiveFields {
+		if _, ok := fields[field]; ok {
+			fields[field] = json.RawMessage(`"` + harRedacted + `"`)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return string(body)
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
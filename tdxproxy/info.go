@@ -0,0 +1,66 @@
+package tdxproxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestInfo describes a completed request.
+type RequestInfo struct {
+	URL  string
+	Time time.Time
+	// StatusCode of the last response, or 0 if none was received.
+	StatusCode int
+	// Latency covers all attempts, including retry waits.
+	Latency time.Duration
+	// Attempts is the number of requests sent; 0 for cache hits.
+	Attempts  int
+	FromCache bool
+	// RateLimit holds the Retry-After and X-RateLimit-* headers of the last response.
+	RateLimit http.Header
+	Err       error
+}
+
+// LastRequestInfo returns metadata about the most recent request made through the proxy,
+// or nil if there has been none. With concurrent callers, "most recent" means the one
+// that finished last.
+func (proxy *TDXProxy) LastRequestInfo() *RequestInfo {
+	proxy.infoMu.Lock()
+	defer proxy.infoMu.Unlock()
+	if proxy.lastInfo == nil {
+		return nil
+	}
+	info := *proxy.lastInfo
+	return &info
+}
+
+type requestInfoKey struct{}
+
+// CaptureRequestInfo returns a copy of ctx in which a request stores its
+// RequestInfo into info when it completes. Unlike LastRequestInfo, this is
+// not affected by concurrent callers.
+func CaptureRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func (proxy *TDXProxy) setLastRequestInfo(ctx context.Context, info *RequestInfo) {
+	if capture, ok := ctx.Value(requestInfoKey{}).(*RequestInfo); ok {
+		*capture = *info
+	}
+	proxy.infoMu.Lock()
+	defer proxy.infoMu.Unlock()
+	proxy.lastInfo = info
+}
+
+// rateLimitHeaders extracts the rate-limit related headers from header.
+func rateLimitHeaders(header http.Header) http.Header {
+	limits := http.Header{}
+	for name, values := range header {
+		if name == "Retry-After" || strings.HasPrefix(name, "X-Ratelimit-") {
+			limits[name] = values
+		}
+	}
+	return limits
+}
@@ -0,0 +1,229 @@
+//go:build integration
+
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+// The tests in this file run against the live TDX service, to catch schema
+// drift and API changes before users do. They are excluded from normal runs;
+// run them, e.g. nightly, with credentials in TDX_APP_ID and TDX_APP_KEY or in
+// the file named by TDX_CREDENTIALS_FILE:
+//
+//	go test -tags integration -run Integration ./tdxproxy
+//
+// They make a few dozen requests, rate limited to stay within the free tier.
+
+// integrationTimeout bounds each test, including waits for the rate limiter.
+const integrationTimeout = 2 * time.Minute
+
+// integrationProxy returns a proxy authenticated with the credentials from
+// the environment, skipping the test if there are none.
+func integrationProxy(t *testing.T) *TDXProxy {
+	t.Helper()
+	credentials := []Credential{{AppID: os.Getenv("TDX_APP_ID"), AppKey: os.Getenv("TDX_APP_KEY")}}
+	if credentials[0].AppID == "" || credentials[0].AppKey == "" {
+		file := os.Getenv("TDX_CREDENTIALS_FILE")
+		if file == "" {
+			t.Skip("no TDX credentials: set TDX_APP_ID and TDX_APP_KEY, or TDX_CREDENTIALS_FILE")
+		}
+		var err error
+		if credentials, err = LoadCredentials(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proxy := NewTDXProxyNoAuth(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.SetCredentials(credentials...)
+	proxy.SetRateLimiter(NewTokenBucket(2, 1))
+	return proxy
+}
+
+func integrationContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestIntegrationAuth(t *testing.T) {
+	proxy := integrationProxy(t)
+	ctx := integrationContext(t)
+	if err := proxy.WarmUp(ctx); err != nil {
+		t.Fatalf("WarmUp: %v", err)
+	}
+
+	_, err := NewTDXProxyContext(ctx, "tdxproxy-integration", "invalid-key", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("invalid credentials: got %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestIntegrationPagination(t *testing.T) {
+	proxy := integrationProxy(t)
+	ctx := integrationContext(t)
+	const pageSize = 20
+	paginator := proxy.NewPaginator("v2/Bus/Route/City/Taipei", map[string]string{"$orderby": "RouteUID", "$select": "RouteUID,UpdateTime"}, pageSize)
+
+	seen := map[string]bool{}
+	for page := 0; page < 3; page++ {
+		records, err := paginator.Next(ctx)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if len(records) != pageSize {
+			t.Fatalf("page %d has %d records, want %d", page, len(records), pageSize)
+		}
+		for _, record := range records {
+			uid := string(recordKey(record, "RouteUID"))
+			if uid == "" {
+				t.Fatalf("page %d: record without RouteUID: %s", page, record)
+			}
+			if seen[uid] {
+				t.Fatalf("page %d repeats %s", page, uid)
+			}
+			seen[uid] = true
+		}
+	}
+	if cursor := paginator.Cursor(); cursor.Skip != 3*pageSize || cursor.LastUpdateTime.IsZero() {
+		t.Errorf("cursor after three pages: %+v", cursor)
+	}
+}
+
+func TestIntegrationConditionalRequest(t *testing.T) {
+	proxy := integrationProxy(t)
+	ctx := integrationContext(t)
+	const path = "v2/Basic/Operator"
+
+	resp, err := proxy.GetContext(ctx, path, nil, nil, 30*time.Second, NoCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	headers := map[string]string{}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		headers["If-None-Match"] = etag
+	} else if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		headers["If-Modified-Since"] = modified
+	} else {
+		t.Skip("TDX sent no ETag or Last-Modified for " + path)
+	}
+
+	resp, err = proxy.GetContext(ctx, path, nil, headers, 30*time.Second, NoCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional request with %v: status %d, want 304", headers, resp.StatusCode)
+	}
+}
+
+// TestIntegrationTypedModels checks that the typed clients still find the
+// fields they read. A renamed TDX field decodes as a zero value rather than
+// failing, so the checks are on fields every record has.
+func TestIntegrationTypedModels(t *testing.T) {
+	proxy := integrationProxy(t)
+	ctx := integrationContext(t)
+	const city, route = "Taipei", "307"
+
+	var firstStop string
+	t.Run("BusStopSequences", func(t *testing.T) {
+		sequences, err := proxy.BusStopSequences(ctx, city, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sequences) == 0 {
+			t.Fatal("no stop sequences")
+		}
+		for _, s := range sequences {
+			if s.RouteUID == "" || s.SubRouteUID == "" || len(s.Stops) < 2 {
+				t.Fatalf("incomplete sequence: %+v", s)
+			}
+			for _, stop := range s.Stops {
+				if stop.StopUID == "" || stop.StopName.ZhTw == "" || stop.Sequence == 0 || stop.Lat == 0 || stop.Lon == 0 {
+					t.Fatalf("incomplete stop of %s: %+v", s.SubRouteUID, stop)
+				}
+			}
+		}
+		firstStop = sequences[0].Stops[0].StopUID
+	})
+
+	t.Run("BusTimetables", func(t *testing.T) {
+		timetables, err := proxy.BusTimetables(ctx, city, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range timetables {
+			if len(tt.Trips) == 0 && len(tt.Headways) == 0 {
+				t.Errorf("%s direction %s has neither trips nor headways", tt.SubRouteUID, tt.Direction)
+			}
+			if len(tt.Trips) > 0 && firstDeparture(tt.Trips[0]) == "" {
+				t.Errorf("%s direction %s: trip without times: %+v", tt.SubRouteUID, tt.Direction, tt.Trips[0])
+			}
+		}
+	})
+
+	t.Run("BusRouteShapes", func(t *testing.T) {
+		shapes, err := proxy.BusRouteShapes(ctx, city, route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shapes) == 0 {
+			t.Fatal("no shapes")
+		}
+		for _, s := range shapes {
+			if s.RouteUID == "" || s.Length() < 1000 {
+				t.Errorf("implausible shape %s: %.0f m", s.RouteUID, s.Length())
+			}
+		}
+	})
+
+	t.Run("DepartureBoard", func(t *testing.T) {
+		if firstStop == "" {
+			t.Skip("no stop from BusStopSequences")
+		}
+		departures, err := proxy.DepartureBoard(ctx, city, firstStop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range departures {
+			if d.RouteUID == "" || d.RouteName.ZhTw == "" {
+				t.Errorf("incomplete departure: %+v", d)
+			}
+		}
+	})
+
+	t.Run("MetroBoards", func(t *testing.T) {
+		boards, err := proxy.MetroBoards(ctx, "TRTC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(boards) == 0 {
+			t.Fatal("no stations")
+		}
+		for _, b := range boards {
+			if b.StationID == "" || b.StationName.ZhTw == "" {
+				t.Errorf("incomplete station: %+v", b)
+			}
+		}
+	})
+
+	t.Run("UpdateReferenceData", func(t *testing.T) {
+		data, err := proxy.UpdateReferenceData(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, ok := data.MetroLine("TRTC", "R")
+		if !ok || line.LineName.ZhTw == "" || len(line.LineColor) != len("#E3002C") {
+			t.Errorf("TRTC line R: %+v", line)
+		}
+	})
+}
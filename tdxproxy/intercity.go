@@ -0,0 +1,144 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// InterCityTrip is a scheduled intercity coach trip between two stops.
+type InterCityTrip struct {
+	RouteUID  string
+	RouteName Name
+	Direction int
+	TripID    string
+	From      Name
+	To        Name
+	Departure time.Time
+	Arrival   time.Time
+}
+
+// InterCityTrips returns the trips of an intercity route that serve from and
+// then to on date, ordered by departure. Stops are matched by StopUID or by
+// Chinese or English name. TDX publishes intercity timetables but no booking
+// or seat availability data, so only scheduled trips are covered.
+//
+// A route without a timetable, or whose timetable runs no trips on date,
+// fails with ErrRouteNotOperated, and a date outside the period the timetable
+// is valid for with ErrOutOfTimetableRange.
+func (proxy *TDXProxy) InterCityTrips(ctx context.Context, route string, date time.Time, from, to string) ([]InterCityTrip, error) {
+	type stopTime struct {
+		StopUID       string
+		StopName      Name
+		ArrivalTime   string
+		DepartureTime string
+	}
+	type schedule struct {
+		RouteUID  string
+		RouteName Name
+		Direction int
+		// EffectiveDate and ExpireDate bound the timetable, "YYYY-MM-DD";
+		// TDX leaves them out for timetables valid until further notice.
+		EffectiveDate string
+		ExpireDate    string
+		Timetables    []struct {
+			TripID     string
+			ServiceDay map[string]int
+			StopTimes  []stopTime
+		}
+	}
+	schedules, err := fetchStatic[schedule](ctx, proxy, "v2/Bus/Schedule/InterCity/"+url.PathEscape(route), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schedules) == 0 {
+		return nil, &ServiceError{Service: "intercity", Kind: ErrRouteNotOperated, Value: route}
+	}
+
+	day := date.In(taipei)
+	weekday := day.Weekday().String()
+	dayString := day.Format(time.DateOnly)
+	valid, running := false, false
+	matches := func(s stopTime, want string) bool {
+		return s.StopUID == want || s.StopName.ZhTw == want || s.StopName.En == want
+	}
+	var trips []InterCityTrip
+	for _, s := range schedules {
+		// The dates compare as strings since both are YYYY-MM-DD.
+		if s.EffectiveDate != "" && dayString < s.EffectiveDate[:min(len(s.EffectiveDate), 10)] ||
+			s.ExpireDate != "" && dayString > s.ExpireDate[:min(len(s.ExpireDate), 10)] {
+			continue
+		}
+		valid = true
+		for _, tt := range s.Timetables {
+			if tt.ServiceDay != nil && tt.ServiceDay[weekday] != 1 {
+				continue
+			}
+			running = true
+			origin := -1
+			for i, st := range tt.StopTimes {
+				if origin < 0 && matches(st, from) {
+					origin = i
+					continue
+				}
+				if origin < 0 || !matches(st, to) {
+					continue
+				}
+				o := tt.StopTimes[origin]
+				departure, err := clockOn(day, firstNonEmpty(o.DepartureTime, o.ArrivalTime))
+				if err != nil {
+					return nil, fmt.Errorf("trip %s: %w", tt.TripID, err)
+				}
+				arrival, err := clockOn(day, firstNonEmpty(st.ArrivalTime, st.DepartureTime))
+				if err != nil {
+					return nil, fmt.Errorf("trip %s: %w", tt.TripID, err)
+				}
+				if arrival.Before(departure) {
+					arrival = arrival.AddDate(0, 0, 1)
+				}
+				trips = append(trips, InterCityTrip{
+					RouteUID:  s.RouteUID,
+					RouteName: s.RouteName,
+					Direction: s.Direction,
+					TripID:    tt.TripID,
+					From:      o.StopName,
+					To:        st.StopName,
+					Departure: departure,
+					Arrival:   arrival,
+				})
+				break
+			}
+		}
+	}
+	switch {
+	case !valid:
+		return nil, &ServiceError{Service: "intercity", Kind: ErrOutOfTimetableRange, Value: dayString}
+	case !running:
+		return nil, &ServiceError{Service: "intercity", Kind: ErrRouteNotOperated, Value: route + " on " + dayString}
+	}
+	sort.SliceStable(trips, func(i, j int) bool { return trips[i].Departure.Before(trips[j].Departure) })
+	return trips, nil
+}
+
+// clockOn returns the time of day "HH:MM" on day in Taiwan time. Hours past
+// 23, used by timetables for trips after midnight, roll over to the next day.
+func clockOn(day time.Time, hhmm string) (time.Time, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(hhmm, "%d:%d", &hour, &minute); err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", hhmm)
+	}
+	y, m, d := day.In(taipei).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, taipei).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
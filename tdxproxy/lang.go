@@ -0,0 +1,129 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Languages accepted by Name.In and FlattenNames.
+const (
+	LangZhTW = "zh-TW"
+	LangEn   = "en"
+)
+
+// Name is a bilingual TDX name field, such as RouteName or StopName.
+type Name struct {
+	ZhTw string `json:"Zh_tw,omitempty"`
+	En   string `json:"En,omitempty"`
+}
+
+// In returns the name in lang, falling back to the other language when it is
+// missing. Any lang other than English, e.g. "zh-TW" or "", selects Chinese.
+func (n Name) In(lang string) string {
+	preferred, fallback := n.ZhTw, n.En
+	if isEnglish(lang) {
+		preferred, fallback = n.En, n.ZhTw
+	}
+	if preferred != "" {
+		return preferred
+	}
+	return fallback
+}
+
+// String returns the Chinese name, or the English one if it is missing.
+func (n Name) String() string {
+	return n.In(LangZhTW)
+}
+
+// FlattenNames replaces every {"Zh_tw": ..., "En": ...} object in a record,
+// at any depth, with the string in lang as chosen by Name.In. Other values and
+// the field order are kept, so the result can be decoded into structs with
+// plain string fields.
+func FlattenNames(record json.RawMessage, lang string) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := flattenNames(&buf, record, lang); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func flattenNames(buf *bytes.Buffer, value json.RawMessage, lang string) error {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || (value[0] != '{' && value[0] != '[') {
+		buf.Write(value)
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	if value[0] == '[' {
+		buf.WriteByte('[')
+		for i := 0; decoder.More(); i++ {
+			var item json.RawMessage
+			if err := decoder.Decode(&item); err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := flattenNames(buf, item, lang); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	type field struct {
+		key   string
+		value json.RawMessage
+	}
+	var fields []field
+	isName := true
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := token.(string)
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		if key != "Zh_tw" && key != "En" {
+			isName = false
+		}
+		fields = append(fields, field{key: key, value: raw})
+	}
+
+	if isName && len(fields) > 0 {
+		var name Name
+		if err := json.Unmarshal(value, &name); err == nil {
+			text, _ := json.Marshal(name.In(lang))
+			buf.Write(text)
+			return nil
+		}
+	}
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		if err := flattenNames(buf, f.value, lang); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func isEnglish(lang string) bool {
+	lang = strings.ToLower(lang)
+	return lang == "en" || strings.HasPrefix(lang, "en-") || strings.HasPrefix(lang, "en_")
+}
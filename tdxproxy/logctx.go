@@ -0,0 +1,33 @@
+package tdxproxy
+
+import (
+	"context"
+	"log/slog"
+)
+
+type logAttrsKey struct{}
+
+// WithLogAttrs returns a copy of ctx carrying attrs. Every log line the proxy
+// writes for a request made with the returned context includes them, which
+// makes logs of a shared proxy attributable to a user or feature.
+// Attributes accumulate when WithLogAttrs is applied more than once.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing := logAttrsFromContext(ctx)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, merged)
+}
+
+func logAttrsFromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// log writes a log line with the context's attributes appended to attrs.
+func (proxy *TDXProxy) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if extra := logAttrsFromContext(ctx); len(extra) > 0 {
+		attrs = append(attrs, extra...)
+	}
+	proxy.logger.LogAttrs(ctx, level, msg, attrs...)
+}
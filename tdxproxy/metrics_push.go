@@ -0,0 +1,289 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric is one value of the proxy's Stats, as pushed to a MetricsExporter.
+type Metric struct {
+	Name string
+	// Counter marks cumulative counts; other metrics are gauges.
+	Counter bool
+	Value   float64
+	Labels  map[string]string
+}
+
+// StatsMetrics converts stats into metrics named like "tdxproxy.requests",
+// with a gauge per pooled credential labelled with its app_id.
+func StatsMetrics(stats Stats) []Metric {
+	metrics := []Metric{
+		{Name: "tdxproxy.requests", Counter: true, Value: float64(stats.Requests)},
+		{Name: "tdxproxy.cache_hits", Counter: true, Value: float64(stats.CacheHits)},
+		{Name: "tdxproxy.attempts", Counter: true, Value: float64(stats.Attempts)},
+		{Name: "tdxproxy.errors", Counter: true, Value: float64(stats.Errors)},
+		{Name: "tdxproxy.token_refreshes", Counter: true, Value: float64(stats.TokenRefreshes)},
+	}
+	for _, c := range stats.Credentials {
+		labels := map[string]string{"app_id": c.AppID}
+		quarantined := 0.0
+		if c.Quarantined {
+			quarantined = 1
+		}
+		metrics = append(metrics,
+			Metric{Name: "tdxproxy.credential.error_rate", Value: c.ErrorRate, Labels: labels},
+			Metric{Name: "tdxproxy.credential.quarantined", Value: quarantined, Labels: labels},
+		)
+	}
+	return metrics
+}
+
+// MetricsExporter sends metrics to a monitoring system. Export is called with
+// the cumulative values of every metric each time.
+type MetricsExporter interface {
+	Export(ctx context.Context, metrics []Metric) error
+}
+
+// PushMetrics exports the proxy's Stats to exporter every interval until ctx
+// is done, and once more then, so that a short-lived batch job reports its
+// final counts before exiting. Failed exports are logged and retried on the
+// next interval.
+func (proxy *TDXProxy) PushMetrics(ctx context.Context, exporter MetricsExporter, interval time.Duration) {
+	push := func(ctx context.Context) {
+		if err := exporter.Export(ctx, StatsMetrics(proxy.Stats())); err != nil {
+			proxy.logger.Warn("Failed to push metrics", slog.String("error", err.Error()))
+		}
+	}
+	for {
+		select {
+		case <-proxy.clock.After(interval):
+			push(ctx)
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			push(final)
+			cancel()
+			return
+		}
+	}
+}
+
+// statsdPacketSize keeps StatsD datagrams within a typical Ethernet MTU.
+const statsdPacketSize = 1432
+
+// StatsDExporter sends metrics to a StatsD server over UDP. Counters are
+// sent as the increase since the previous export, gauges as their value.
+// Labels are sent as DogStatsD tags, which StatsD servers without tag
+// support, such as the original Etsy one, ignore or reject.
+type StatsDExporter struct {
+	conn   net.Conn
+	prefix string
+
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// NewStatsDExporter creates an exporter sending to addr, such as
+// "localhost:8125", prepending prefix and a dot to metric names if prefix is
+// not empty.
+func NewStatsDExporter(addr, prefix string) (*StatsDExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD: %w", err)
+	}
+	if prefix != "" {
+		prefix += "."
+	}
+	return &StatsDExporter{conn: conn, prefix: prefix, last: map[string]float64{}}, nil
+}
+
+func (e *StatsDExporter) Export(ctx context.Context, metrics []Metric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := e.conn.Write(bytes.TrimSuffix(packet.Bytes(), []byte("\n")))
+		packet.Reset()
+		return err
+	}
+	for _, m := range metrics {
+		tags := statsdTags(m.Labels)
+		var line string
+		if m.Counter {
+			key := m.Name + tags
+			delta := m.Value - e.last[key]
+			e.last[key] = m.Value
+			if delta <= 0 {
+				continue
+			}
+			line = fmt.Sprintf("%s%s:%s|c%s\n", e.prefix, m.Name, strconv.FormatFloat(delta, 'f', -1, 64), tags)
+		} else {
+			line = fmt.Sprintf("%s%s:%s|g%s\n", e.prefix, m.Name, strconv.FormatFloat(m.Value, 'f', -1, 64), tags)
+		}
+		if packet.Len()+len(line) > statsdPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
+
+// Close closes the UDP socket.
+func (e *StatsDExporter) Close() error {
+	return e.conn.Close()
+}
+
+func statsdTags(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		tags = append(tags, k+":"+labels[k])
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// OTLPExporter sends metrics to an OpenTelemetry collector with OTLP over
+// HTTP, encoded as JSON, as cumulative sums and gauges.
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	start    time.Time
+	// Header is sent with every export, e.g. for the collector's API key.
+	Header http.Header
+}
+
+// NewOTLPExporter creates an exporter posting to endpoint, such as
+// "http://localhost:4318/v1/metrics", reporting service as service.name.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	if service == "" {
+		service = "tdxproxy"
+	}
+	return &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		start:    time.Now(),
+		Header:   http.Header{},
+	}
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+	// AggregationTemporality 2 is cumulative.
+	AggregationTemporality int  `json:"aggregationTemporality"`
+	IsMonotonic            bool `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+func otlpAttributes(labels map[string]string) []otlpAttribute {
+	var attributes []otlpAttribute
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		attribute := otlpAttribute{Key: k}
+		attribute.Value.StringValue = labels[k]
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, metrics []Metric) error {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+
+	// Data points of the same metric, e.g. one per credential, are grouped.
+	var out []*otlpMetric
+	byName := map[string]*otlpMetric{}
+	for _, m := range metrics {
+		metric, ok := byName[m.Name]
+		if !ok {
+			metric = &otlpMetric{Name: m.Name}
+			if m.Counter {
+				metric.Sum = &otlpSum{AggregationTemporality: 2, IsMonotonic: true}
+			} else {
+				metric.Gauge = &otlpGauge{}
+			}
+			byName[m.Name] = metric
+			out = append(out, metric)
+		}
+		point := otlpDataPoint{Attributes: otlpAttributes(m.Labels), TimeUnixNano: now, AsDouble: m.Value}
+		if metric.Sum != nil {
+			point.StartTimeUnixNano = start
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, point)
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, point)
+		}
+	}
+
+	payload := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]string{"service.name": e.service})},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]string{"name": "github.com/chihsuanwu/tdxproxy"},
+				"metrics": out,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP request: %w", err)
+	}
+	for k, v := range e.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OTLP export failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP export failed: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package tdxproxy
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// objectCache keeps decoded records of static datasets, such as routes,
+// stops and timetables, keyed by request and record type.
+type objectCache struct {
+	ttl   time.Duration
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[objectKey]objectEntry
+}
+
+type objectKey struct {
+	typ     reflect.Type
+	request string
+}
+
+type objectEntry struct {
+	records  any
+	storedAt time.Time
+}
+
+// SetObjectCache makes the typed clients keep the decoded records of static
+// datasets, such as routes, stops, operators and timetables, for ttl, so that
+// repeated calls skip both the request and the JSON decoding. Live data, such
+// as arrival estimates and positions, is never kept. A non-positive ttl turns
+// the cache off and drops its contents.
+//
+// Calls answered from the cache share the cached records: slices returned by
+// BusOperators and RouteNetworks must be treated as read-only.
+func (proxy *TDXProxy) SetObjectCache(ttl time.Duration) {
+	var cache *objectCache
+	if ttl > 0 {
+		cache = &objectCache{ttl: ttl, clock: proxy.clock, entries: map[objectKey]objectEntry{}}
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.objects = cache
+}
+
+func (c *objectCache) get(key objectKey) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.clock.Now().Sub(entry.storedAt) >= c.ttl {
+		return nil, false
+	}
+	return entry.records, true
+}
+
+func (c *objectCache) set(key objectKey, records any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	for k, entry := range c.entries {
+		if now.Sub(entry.storedAt) >= c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = objectEntry{records: records, storedAt: now}
+}
+
+// fetchStatic fetches a static dataset and decodes it into T, answering from
+// the object cache when it is enabled.
+func fetchStatic[T any](ctx context.Context, proxy *TDXProxy, url string, params map[string]string) ([]T, error) {
+	cache := proxy.settings().objects
+	var key objectKey
+	if cache != nil {
+		key = objectKey{typ: reflect.TypeFor[T](), request: proxy.cacheKey(url, params)}
+		if records, ok := cache.get(key); ok {
+			return records.([]T), nil
+		}
+	}
+	body, err := proxy.fetchBody(ctx, url, params)
+	if err != nil {
+		return nil, err
+	}
+	records, err := DecodeAs[T](body)
+	if err != nil {
+		return nil, err
+	}
+	if cache != nil {
+		cache.set(key, records)
+	}
+	return records, nil
+}
@@ -0,0 +1,102 @@
+package tdxproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// maxFilterLength bounds a $filter expression accepted by ValidateFilter.
+const maxFilterLength = 4096
+
+// ValidateFilter checks that an unescaped OData $filter expression is well
+// formed enough to forward: string literals are closed, parentheses balance
+// outside of them and there are no control characters. It does not check
+// field names or operators, which TDX reports itself.
+func ValidateFilter(filter string) error {
+	if filter == "" {
+		return errors.New("empty filter")
+	}
+	if len(filter) > maxFilterLength {
+		return fmt.Errorf("filter longer than %d bytes", maxFilterLength)
+	}
+	depth := 0
+	inString := false
+	for i, r := range filter {
+		switch {
+		case r == unicode.ReplacementChar:
+			return fmt.Errorf("invalid UTF-8 at offset %d", i)
+		case unicode.IsControl(r):
+			return fmt.Errorf("control character at offset %d", i)
+		case r == '\'':
+			// A quote inside a literal is escaped by doubling it, which
+			// reads as closing and reopening the literal.
+			inString = !inString
+		case inString:
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth == 0 {
+				return fmt.Errorf("unbalanced ')' at offset %d", i)
+			}
+			depth--
+		}
+	}
+	if inString {
+		return errors.New("unterminated string literal")
+	}
+	if depth > 0 {
+		return errors.New("unbalanced '('")
+	}
+	return nil
+}
+
+// odataString quotes s as an OData string literal, doubling embedded single
+// quotes so that the value cannot end the literal.
+func odataString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// validParamName reports whether a query parameter name can be forwarded
+// verbatim: OData system options such as $filter and plain identifiers.
+func validParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r == '$' && i == 0 || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// gatewayQuery converts a downstream query into proxy parameters. Values are
+// escaped; names are rejected rather than escaped since TDX matches them
+// literally.
+// Parameters consumed by the gateway itself are dropped.
+func gatewayQuery(query url.Values) (map[string]string, error) {
+	if len(query) == 0 {
+		return nil, nil
+	}
+	params := make(map[string]string, len(query))
+	for k := range query {
+		if gatewayParams[k] {
+			continue
+		}
+		if !validParamName(k) {
+			return nil, fmt.Errorf("invalid query parameter %q", k)
+		}
+		v := query.Get(k)
+		if k == "$filter" {
+			if err := ValidateFilter(v); err != nil {
+				return nil, fmt.Errorf("invalid $filter: %w", err)
+			}
+		}
+		params[k] = EscapeParam(v)
+	}
+	return params, nil
+}
@@ -0,0 +1,268 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// BusOperator is a bus company, as listed by the Operator endpoints.
+type BusOperator struct {
+	OperatorID    string
+	OperatorName  Name
+	OperatorCode  string
+	OperatorNo    string
+	OperatorPhone string
+	OperatorEmail string
+	OperatorUrl   string
+}
+
+// NetworkRoute is a route belonging to a RouteNetwork.
+type NetworkRoute struct {
+	RouteUID  string
+	RouteName Name
+}
+
+// RouteNetwork is a named group of routes published by a city, such as its
+// trunk or feeder network.
+type RouteNetwork struct {
+	NetworkID   string
+	NetworkName Name
+	Routes      []NetworkRoute
+}
+
+// Headway is a period of a route run by frequency rather than by timetable.
+type Headway struct {
+	// Start and End are the times of day the period runs, "HH:MM". End may
+	// be past 24:00 for periods running after midnight.
+	Start, End string
+	MinHeadway time.Duration
+	MaxHeadway time.Duration
+	// Days lists the days of the week the period applies to, or is nil for every day.
+	Days []time.Weekday
+}
+
+// Trips estimates the number of departures in the period from its mean headway.
+func (h Headway) Trips() float64 {
+	mean := (h.MinHeadway + h.MaxHeadway) / 2
+	if mean <= 0 {
+		return 0
+	}
+	span, err := clockSpan(h.Start, h.End)
+	if err != nil {
+		return 0
+	}
+	return float64(span) / float64(mean)
+}
+
+// RunsOn reports whether the period applies on day.
+func (h Headway) RunsOn(day time.Weekday) bool {
+	return h.Days == nil || slices.Contains(h.Days, day)
+}
+
+// RouteFrequency is the service of one direction of a sub-route, as published
+// by the Schedule endpoints: headway periods, timetabled trips, or both.
+type RouteFrequency struct {
+	RouteUID    string
+	RouteName   Name
+	SubRouteUID string
+	Direction   int
+	OperatorID  string
+	Headways    []Headway
+	// TimetableTrips counts the timetabled trips running on each day of the week.
+	TimetableTrips map[time.Weekday]int
+}
+
+// TripsOn estimates the number of departures on day, counting timetabled
+// trips and the trips implied by headway periods.
+func (f RouteFrequency) TripsOn(day time.Weekday) float64 {
+	trips := float64(f.TimetableTrips[day])
+	for _, h := range f.Headways {
+		if h.RunsOn(day) {
+			trips += h.Trips()
+		}
+	}
+	return trips
+}
+
+// OperatorServiceLevel summarizes the service an operator runs on a day of the week.
+type OperatorServiceLevel struct {
+	Operator BusOperator
+	// Routes is the number of routes with at least one trip on the day.
+	Routes int
+	// Trips is the estimated number of departures over all its routes and directions.
+	Trips float64
+}
+
+// busPath returns the v2 bus path of an endpoint for a city, or for
+// intercity routes when city is "InterCity".
+func busPath(endpoint, city string) string {
+	if city == "InterCity" {
+		return "v2/Bus/" + endpoint + "/InterCity"
+	}
+	return "v2/Bus/" + endpoint + "/City/" + city
+}
+
+// BusOperators returns the bus operators of a city, or the intercity operators
+// when city is "InterCity".
+func (proxy *TDXProxy) BusOperators(ctx context.Context, city string) ([]BusOperator, error) {
+	if err := checkBusCity(city, true); err != nil {
+		return nil, err
+	}
+	return fetchStatic[BusOperator](ctx, proxy, busPath("Operator", city), nil)
+}
+
+// RouteNetworks returns the route networks a city publishes.
+func (proxy *TDXProxy) RouteNetworks(ctx context.Context, city string) ([]RouteNetwork, error) {
+	if err := checkBusCity(city, false); err != nil {
+		return nil, err
+	}
+	return fetchStatic[RouteNetwork](ctx, proxy, busPath("Network", city), nil)
+}
+
+// BusFrequencies returns the headway periods and timetabled trip counts of
+// every route of a city, or of intercity routes when city is "InterCity".
+func (proxy *TDXProxy) BusFrequencies(ctx context.Context, city string) ([]RouteFrequency, error) {
+	if err := checkBusCity(city, true); err != nil {
+		return nil, err
+	}
+	type schedule struct {
+		RouteUID    string
+		RouteName   Name
+		SubRouteUID string
+		Direction   int
+		OperatorID  string
+		Timetables  []struct {
+			ServiceDay map[string]int
+		}
+		Frequencys []struct {
+			StartTime      string
+			EndTime        string
+			MinHeadwayMins int
+			MaxHeadwayMins int
+			ServiceDay     map[string]int
+		}
+	}
+	schedules, err := fetchStatic[schedule](ctx, proxy, busPath("Schedule", city), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	frequencies := make([]RouteFrequency, 0, len(schedules))
+	for _, s := range schedules {
+		f := RouteFrequency{
+			RouteUID:       s.RouteUID,
+			RouteName:      s.RouteName,
+			SubRouteUID:    s.SubRouteUID,
+			Direction:      s.Direction,
+			OperatorID:     s.OperatorID,
+			TimetableTrips: map[time.Weekday]int{},
+		}
+		for _, tt := range s.Timetables {
+			for day := time.Sunday; day <= time.Saturday; day++ {
+				if tt.ServiceDay == nil || tt.ServiceDay[day.String()] == 1 {
+					f.TimetableTrips[day]++
+				}
+			}
+		}
+		for _, fr := range s.Frequencys {
+			if _, err := clockSpan(fr.StartTime, fr.EndTime); err != nil {
+				return nil, fmt.Errorf("route %s: %w", s.RouteUID, err)
+			}
+			f.Headways = append(f.Headways, Headway{
+				Start:      fr.StartTime,
+				End:        fr.EndTime,
+				MinHeadway: time.Duration(fr.MinHeadwayMins) * time.Minute,
+				MaxHeadway: time.Duration(fr.MaxHeadwayMins) * time.Minute,
+				Days:       serviceDays(fr.ServiceDay),
+			})
+		}
+		frequencies = append(frequencies, f)
+	}
+	return frequencies, nil
+}
+
+// OperatorServiceLevels estimates the service each operator of a city runs on
+// a day of the week, from the Operator and Schedule endpoints, ordered by
+// trips, busiest first. Operators without trips on the day are included with
+// zero trips.
+func (proxy *TDXProxy) OperatorServiceLevels(ctx context.Context, city string, day time.Weekday) ([]OperatorServiceLevel, error) {
+	operators, err := proxy.BusOperators(ctx, city)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch operators: %w", err)
+	}
+	frequencies, err := proxy.BusFrequencies(ctx, city)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schedules: %w", err)
+	}
+
+	levels := map[string]*OperatorServiceLevel{}
+	for _, op := range operators {
+		levels[op.OperatorID] = &OperatorServiceLevel{Operator: op}
+	}
+	routes := map[string]map[string]bool{}
+	for _, f := range frequencies {
+		level, ok := levels[f.OperatorID]
+		if !ok {
+			level = &OperatorServiceLevel{Operator: BusOperator{OperatorID: f.OperatorID}}
+			levels[f.OperatorID] = level
+		}
+		trips := f.TripsOn(day)
+		if trips == 0 {
+			continue
+		}
+		level.Trips += trips
+		if routes[f.OperatorID] == nil {
+			routes[f.OperatorID] = map[string]bool{}
+		}
+		routes[f.OperatorID][f.RouteUID] = true
+	}
+
+	result := make([]OperatorServiceLevel, 0, len(levels))
+	for id, level := range levels {
+		level.Routes = len(routes[id])
+		result = append(result, *level)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Trips != result[j].Trips {
+			return result[i].Trips > result[j].Trips
+		}
+		return result[i].Operator.OperatorID < result[j].Operator.OperatorID
+	})
+	return result, nil
+}
+
+// clockSpan returns the time from start to end, both "HH:MM", treating an
+// end before start as the next day.
+func clockSpan(start, end string) (time.Duration, error) {
+	day := time.Date(2000, 1, 1, 0, 0, 0, 0, taipei)
+	from, err := clockOn(day, start)
+	if err != nil {
+		return 0, err
+	}
+	to, err := clockOn(day, end)
+	if err != nil {
+		return 0, err
+	}
+	if to.Before(from) {
+		to = to.AddDate(0, 0, 1)
+	}
+	return to.Sub(from), nil
+}
+
+// serviceDays converts a TDX ServiceDay object to the days it marks with 1,
+// or nil if it is absent.
+func serviceDays(serviceDay map[string]int) []time.Weekday {
+	if serviceDay == nil {
+		return nil
+	}
+	days := []time.Weekday{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if serviceDay[day.String()] == 1 {
+			days = append(days, day)
+		}
+	}
+	return days
+}
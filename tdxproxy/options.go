@@ -0,0 +1,122 @@
+package tdxproxy
+
+import (
+	"io"
+	"slices"
+	"time"
+)
+
+// RequestOption customizes a single request without changing the proxy configuration.
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	noCache      bool
+	noStore      bool
+	onlyIfCached bool
+	maxAge       time.Duration
+	noRetry      bool
+	// maxBodySize overrides the proxy's limit when non-zero; negative means none.
+	maxBodySize int64
+	// keepResponse returns the final unsuccessful response instead of an error.
+	keepResponse bool
+	// accept overrides the proxy's Accept header when non-empty.
+	accept string
+	// dryRun overrides SetDryRun when non-nil.
+	dryRun io.Writer
+	// successStatuses replaces 200 and 304 as success statuses when non-nil.
+	successStatuses []int
+}
+
+func newRequestOptions(opts []RequestOption) *requestOptions {
+	options := &requestOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// isSuccess reports whether a response with status ends the request
+// successfully.
+func (o *requestOptions) isSuccess(status int) bool {
+	if o.successStatuses != nil {
+		return slices.Contains(o.successStatuses, status)
+	}
+	return isSuccessStatus(status)
+}
+
+// NoCache skips the cache lookup and always fetches from TDX.
+// The fresh response still replaces the cached entry.
+func NoCache() RequestOption {
+	return func(o *requestOptions) {
+		o.noCache = true
+	}
+}
+
+// NoStore keeps the response out of the cache. Together with NoCache the
+// request bypasses the cache entirely.
+func NoStore() RequestOption {
+	return func(o *requestOptions) {
+		o.noStore = true
+	}
+}
+
+// OnlyIfCached answers from the cache only. If there is no fresh entry,
+// the request fails with ErrNotCached instead of contacting TDX.
+func OnlyIfCached() RequestOption {
+	return func(o *requestOptions) {
+		o.onlyIfCached = true
+	}
+}
+
+// MaxAge accepts a cached response only if it is no older than d.
+// It can only shorten the proxy's cache TTL, not extend it.
+func MaxAge(d time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.maxAge = d
+	}
+}
+
+// NoRetry sends the request exactly once: no retries and no token-refresh retry.
+// An unsuccessful status is returned right away as a *StatusError.
+// Use SetRetryPolicy(NeverRetry) to do the same for every request.
+func NoRetry() RequestOption {
+	return func(o *requestOptions) {
+		o.noRetry = true
+	}
+}
+
+// MaxBodySize caps the response body of this request at n bytes, overriding
+// SetMaxBodySize. n <= 0 removes the limit for this request.
+func MaxBodySize(n int64) RequestOption {
+	return func(o *requestOptions) {
+		if n <= 0 {
+			n = -1
+		}
+		o.maxBodySize = n
+	}
+}
+
+// Accept sets the Accept header of this request, overriding SetAccept. An
+// Accept header passed to the request takes precedence.
+func Accept(mediaType string) RequestOption {
+	return func(o *requestOptions) {
+		o.accept = mediaType
+	}
+}
+
+// DryRun prints this request to w instead of sending it, see SetDryRun.
+func DryRun(w io.Writer) RequestOption {
+	return func(o *requestOptions) {
+		o.dryRun = w
+	}
+}
+
+// SuccessStatus makes the given statuses, and only them, count as success for
+// this request, in place of the default 200 and 304, e.g. for endpoints that
+// answer 202 or 206. Other statuses fail with a *StatusError or are retried
+// as before. Only 200 responses are cached.
+func SuccessStatus(statuses ...int) RequestOption {
+	return func(o *requestOptions) {
+		o.successStatuses = append([]int{}, statuses...)
+	}
+}
@@ -0,0 +1,155 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Cursor is the position of a paginated fetch. It is plain JSON, so it can be
+// persisted after every page and handed to ResumePaginator after a crash.
+type Cursor struct {
+	URL      string            `json:"url"`
+	Params   map[string]string `json:"params,omitempty"`
+	PageSize int               `json:"page_size"`
+	// Skip is the $skip offset of the next page.
+	Skip  int `json:"skip"`
+	Pages int `json:"pages"`
+	// LastUpdateTime is the newest value of the paginator's time field seen so far.
+	LastUpdateTime time.Time `json:"last_update_time,omitempty"`
+	Done           bool      `json:"done"`
+}
+
+// Save writes the cursor to path, replacing the file atomically so a crash
+// never leaves a truncated checkpoint.
+func (c Cursor) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCursor reads a cursor written by Cursor.Save.
+func LoadCursor(path string) (Cursor, error) {
+	var cursor Cursor
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("failed to parse cursor %s: %w", path, err)
+	}
+	return cursor, nil
+}
+
+// Paginator fetches an endpoint page by page with $top and $skip. A page
+// shorter than the page size ends the fetch. Results are only stable across
+// pages if the query has a deterministic order, so set $orderby in params.
+type Paginator struct {
+	proxy  *TDXProxy
+	cursor Cursor
+	field  string
+}
+
+// NewPaginator starts a paginated fetch of url with pageSize records per page.
+// $top and $skip in params are managed by the paginator and are overridden.
+func (proxy *TDXProxy) NewPaginator(url string, params map[string]string, pageSize int) *Paginator {
+	if pageSize <= 0 {
+		proxy.logger.Warn("Invalid page size provided", slog.Int("size", pageSize))
+		pageSize = 1000
+	}
+	return proxy.ResumePaginator(Cursor{URL: url, Params: params, PageSize: pageSize})
+}
+
+// ResumePaginator continues a paginated fetch from a saved cursor.
+func (proxy *TDXProxy) ResumePaginator(cursor Cursor) *Paginator {
+	return &Paginator{proxy: proxy, cursor: cursor, field: "UpdateTime"}
+}
+
+// SetField changes the record field tracked in Cursor.LastUpdateTime.
+func (p *Paginator) SetField(field string) {
+	p.field = field
+}
+
+// Cursor returns the current position, to be saved after each page is processed.
+func (p *Paginator) Cursor() Cursor {
+	return p.cursor
+}
+
+// Done reports whether the last page has been fetched.
+func (p *Paginator) Done() bool {
+	return p.cursor.Done
+}
+
+// Next fetches the next page. It returns io.EOF once all pages have been fetched.
+// The cursor only advances when the page was fetched and decoded successfully.
+func (p *Paginator) Next(ctx context.Context) ([]json.RawMessage, error) {
+	if p.cursor.Done {
+		return nil, io.EOF
+	}
+	query := make(map[string]string, len(p.cursor.Params)+3)
+	for k, v := range p.cursor.Params {
+		query[k] = v
+	}
+	if _, ok := query["$format"]; !ok {
+		query["$format"] = "JSON"
+	}
+	query["$top"] = strconv.Itoa(p.cursor.PageSize)
+	query["$skip"] = strconv.Itoa(p.cursor.Skip)
+
+	body, err := p.proxy.fetchBody(ctx, p.cursor.URL, query)
+	if err != nil {
+		return nil, err
+	}
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if t, ok := recordTime(record, p.field); ok && t.After(p.cursor.LastUpdateTime) {
+			p.cursor.LastUpdateTime = t
+		}
+	}
+	p.cursor.Skip += len(records)
+	p.cursor.Pages++
+	p.cursor.Done = len(records) < p.cursor.PageSize
+	return records, nil
+}
+
+// Each calls fn with every remaining page until the fetch is done or an error
+// occurs. Inside fn, p.Cursor() already points past the page, so saving it at
+// the end of fn checkpoints exactly the pages processed.
+func (p *Paginator) Each(ctx context.Context, fn func(records []json.RawMessage) error) error {
+	for {
+		records, err := p.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+	}
+}
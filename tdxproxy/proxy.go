@@ -0,0 +1,30 @@
+package tdxproxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Proxy is the basic interface of a TDX proxy: plain GET requests against a
+// configurable base URL. Code that only needs these should accept a Proxy, so
+// it works with any ProxyV2 as well as with simple mocks.
+type Proxy interface {
+	Get(url string, params map[string]string, headers map[string]string, timeout time.Duration, opts ...RequestOption) (*http.Response, error)
+	SetBaseURL(url string)
+}
+
+// ProxyV2 extends Proxy with context-aware requests, token management and
+// statistics. Decorators such as logging or metrics wrappers can implement it
+// by embedding a ProxyV2 and overriding the methods they care about; since it
+// embeds Proxy, every ProxyV2 can still be passed where a Proxy is expected.
+type ProxyV2 interface {
+	Proxy
+	GetContext(ctx context.Context, url string, params map[string]string, headers map[string]string, timeout time.Duration, opts ...RequestOption) (*http.Response, error)
+	PostContext(ctx context.Context, url string, params map[string]string, headers map[string]string, contentType string, body []byte, timeout time.Duration, opts ...RequestOption) (*http.Response, error)
+	Do(req *http.Request) (*http.Response, error)
+	RefreshToken(ctx context.Context) error
+	Stats() Stats
+}
+
+var _ ProxyV2 = (*TDXProxy)(nil)
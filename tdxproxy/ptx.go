@@ -0,0 +1,95 @@
+package tdxproxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ptxHost is the host of the retired PTX platform.
+const ptxHost = "ptx.transportdata.tw"
+
+// RewritePTXPath converts a PTX-era URL or path, such as
+// "https://ptx.transportdata.tw/MOTC/v2/Bus/Route/City/Taipei?$top=10" or
+// "MOTC/v2/Bus/Route/City/Taipei", into the equivalent TDX path relative to
+// the basic API base URL, keeping any query string.
+// It reports false if path does not look like a PTX path.
+func RewritePTXPath(path string) (string, bool) {
+	rest := path
+	if u, err := url.Parse(path); err == nil && u.IsAbs() {
+		if !strings.EqualFold(u.Hostname(), ptxHost) {
+			return path, false
+		}
+		rest = u.Path
+		if u.RawQuery != "" {
+			rest += "?" + u.RawQuery
+		}
+	}
+
+	rest = strings.TrimPrefix(rest, "/")
+	if len(rest) < len("MOTC/") || !strings.EqualFold(rest[:len("MOTC/")], "MOTC/") {
+		return path, false
+	}
+	return rest[len("MOTC/"):], true
+}
+
+// SetPTXCompat enables rewriting of legacy PTX paths and URLs passed to Get and Do
+// into their TDX equivalents. PTX HMAC authentication headers are dropped from
+// rewritten requests, since TDX uses bearer tokens instead.
+func (proxy *TDXProxy) SetPTXCompat(enabled bool) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.ptxCompat = enabled
+}
+
+// rewritePTXRequest applies PTX compatibility to a Get call, moving any inline
+// query string of the legacy path into params.
+func (proxy *TDXProxy) rewritePTXRequest(path string, params, headers map[string]string) (string, map[string]string, map[string]string) {
+	if !proxy.settings().ptxCompat {
+		return path, params, headers
+	}
+	rewritten, ok := RewritePTXPath(path)
+	if !ok {
+		return path, params, headers
+	}
+
+	path, rawQuery, _ := strings.Cut(rewritten, "?")
+	if query, err := url.ParseQuery(rawQuery); err == nil && len(query) > 0 {
+		merged := make(map[string]string, len(query)+len(params))
+		for k := range query {
+			merged[k] = query.Get(k)
+		}
+		for k, v := range params {
+			merged[k] = v
+		}
+		params = merged
+	}
+
+	filtered := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if isPTXAuthHeader(k, v) {
+			continue
+		}
+		filtered[k] = v
+	}
+	return path, params, filtered
+}
+
+// stripPTXAuth removes PTX HMAC authentication headers from header.
+func stripPTXAuth(header http.Header) {
+	for k := range header {
+		if isPTXAuthHeader(k, header.Get(k)) {
+			header.Del(k)
+		}
+	}
+}
+
+func isPTXAuthHeader(name, value string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "X-Date":
+		return true
+	case "Authorization":
+		return strings.HasPrefix(strings.ToLower(value), "hmac ")
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// These tests exercise the proxy from many goroutines at once. They assert
+// little beyond the absence of errors; their value is in running them with
+//
+//	go test -race ./tdxproxy
+
+// fakeTDX answers token and API requests in memory.
+type fakeTDX struct {
+	tokens atomic.Int64
+	calls  atomic.Int64
+}
+
+func (f *fakeTDX) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := `[{"StopUID":"TPE1","StopName":{"Zh_tw":"站牌","En":"Stop"}}]`
+	if req.URL.String() == authURL {
+		n := f.tokens.Add(1)
+		body = fmt.Sprintf(`{"access_token":"token-%d","expires_in":3600}`, n)
+	} else {
+		f.calls.Add(1)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func raceProxy(t *testing.T) (*TDXProxy, *fakeTDX) {
+	t.Helper()
+	fake := &fakeTDX{}
+	proxy := NewTDXProxy("id", "key", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.SetTransport(fake)
+	return proxy, fake
+}
+
+// hammer runs each function from workers goroutines, rounds times each, and
+// waits for all of them.
+func hammer(workers, rounds int, fns ...func(i int)) {
+	var wg sync.WaitGroup
+	for _, fn := range fns {
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range rounds {
+					fn(i)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func get(t *testing.T, proxy *TDXProxy, path string) {
+	resp, err := proxy.GetContext(context.Background(), path, nil, nil, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func TestRaceTokenExpiry(t *testing.T) {
+	proxy, fake := raceProxy(t)
+	clock := NewManualClock(time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	proxy.SetClock(clock)
+
+	const expiries = 5
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range expiries {
+			time.Sleep(2 * time.Millisecond)
+			clock.Advance(time.Hour)
+		}
+		done.Store(true)
+	}()
+	hammer(16, 100, func(int) {
+		if !done.Load() {
+			get(t, proxy, "v2/Bus/Stop/City/Taipei")
+		}
+	})
+	wg.Wait()
+
+	// Requests finding the token expired share one refresh, so there is at
+	// most one per expiry plus the initial fetch.
+	if n := fake.tokens.Load(); n > expiries+1 {
+		t.Errorf("fetched %d tokens for %d expiries", n, expiries)
+	}
+	if n := proxy.Stats().TokenRefreshes; n != fake.tokens.Load() {
+		t.Errorf("Stats reports %d token refreshes, want %d", n, fake.tokens.Load())
+	}
+}
+
+func TestRaceSetters(t *testing.T) {
+	proxy, fake := raceProxy(t)
+	other := &fakeTDX{}
+	single := []Credential{{AppID: "id", AppKey: "key"}}
+	pooled := []Credential{{AppID: "a", AppKey: "1"}, {AppID: "b", AppKey: "2"}}
+
+	hammer(4, 50,
+		func(int) { get(t, proxy, "v2/Bus/Route/City/Taipei") },
+		func(int) {
+			resp, err := proxy.PostContext(context.Background(), "v2/Bus/Route", nil, nil, "application/json", []byte("{}"), 0)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		},
+		func(i int) {
+			if i%2 == 0 {
+				proxy.SetCredentials(pooled...)
+			} else {
+				proxy.SetCredentials(single...)
+			}
+		},
+		func(i int) {
+			if i%2 == 0 {
+				proxy.SetTransport(other)
+			} else {
+				proxy.SetTransport(fake)
+			}
+		},
+		func(i int) {
+			proxy.SetBaseURL(TDX_URL_BASIC)
+			proxy.SetRetryPolicy(defaultRetryPolicy())
+			proxy.SetRateLimiter(NewTokenBucket(float64(1000+i), 10))
+			proxy.SetMaxConcurrency(i%4 + 1)
+			proxy.SetMaxBodySize(int64(1 << (10 + i%10)))
+			proxy.SetPTXCompat(i%2 == 0)
+		},
+		func(int) {
+			if err := proxy.RefreshToken(context.Background()); err != nil {
+				t.Error(err)
+			}
+			proxy.Stats()
+			proxy.LastRequestInfo()
+		},
+	)
+}
+
+func TestRaceCache(t *testing.T) {
+	proxy, _ := raceProxy(t)
+	cache := NewMemoryCache()
+	proxy.SetCache(cache, time.Minute)
+	paths := []string{"v2/Bus/Stop/City/Taipei", "v2/Bus/Stop/City/Tainan", "v2/Rail/TRA/Station"}
+
+	hammer(4, 100,
+		func(i int) { get(t, proxy, paths[i%len(paths)]) },
+		func(i int) {
+			resp, err := proxy.GetContext(context.Background(), paths[i%len(paths)], nil, nil, 0, OnlyIfCached())
+			if err == nil {
+				resp.Body.Close()
+			}
+		},
+		func(i int) {
+			switch i % 3 {
+			case 0:
+				proxy.SetCache(nil, 0)
+			case 1:
+				proxy.SetCache(cache, time.Minute)
+			case 2:
+				if err := proxy.FlushCache(); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+		func(i int) {
+			key := proxy.cacheKey(paths[i%len(paths)], map[string]string{"$format": "JSON"})
+			cache.Delete(key)
+			cache.Get(key)
+		},
+	)
+}
+
+func TestRaceGateway(t *testing.T) {
+	proxy, _ := raceProxy(t)
+	proxy.SetCache(NewMemoryCache(), time.Minute)
+	gateway := NewGateway(proxy, 0)
+	routes := []TransformRule{{Path: "v2/Bus/Stop/City/*", Transform: Transform{Lang: LangEn}}}
+
+	hammer(4, 50,
+		func(int) {
+			rec := httptest.NewRecorder()
+			gateway.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/Bus/Stop/City/Taipei", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("status %d: %s", rec.Code, rec.Body)
+			}
+		},
+		func(i int) {
+			if i%2 == 0 {
+				gateway.SetTransforms(routes)
+				gateway.SetCachedPaths([]string{"v2/Bus/*/City/*"})
+			} else {
+				gateway.SetTransforms(nil)
+				gateway.SetCachedPaths(nil)
+			}
+			gateway.RecentErrors()
+		},
+	)
+}
@@ -0,0 +1,163 @@
+package tdxproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces outbound requests. *rate.Limiter from golang.org/x/time/rate
+// satisfies it, so a limiter already shared by other clients can be plugged in
+// and the proxy counts against the same budget.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// SetRateLimiter makes every outbound TDX request, including retries, wait on limiter first.
+// Passing nil removes the limiter.
+func (proxy *TDXProxy) SetRateLimiter(limiter RateLimiter) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.limiter = limiter
+}
+
+// TokenBucket is a RateLimiter allowing rate requests per second on average
+// with bursts of up to burst requests. Its rate can be changed while in use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	b := &TokenBucket{clock: systemClock{}}
+	b.SetRate(rate, burst)
+	b.tokens = float64(b.burst)
+	return b
+}
+
+// SetRate changes the rate and burst. A non-positive rate removes the limit.
+func (b *TokenBucket) SetRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = rate
+	b.burst = max(burst, 1)
+	b.tokens = min(b.tokens, float64(b.burst))
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.rate <= 0 {
+			b.mu.Unlock()
+			return nil
+		}
+		now := b.clock.Now()
+		if !b.last.IsZero() {
+			b.tokens = min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.clock.After(wait):
+		}
+	}
+}
+
+type cityKey struct{}
+
+// WithCity returns a copy of ctx whose requests count against the share of
+// city in a CityRateBudget. ForEachCity tags its requests this way.
+func WithCity(ctx context.Context, city string) context.Context {
+	return context.WithValue(ctx, cityKey{}, city)
+}
+
+// CityFromContext returns the city ctx was tagged with by WithCity.
+func CityFromContext(ctx context.Context) (string, bool) {
+	city, ok := ctx.Value(cityKey{}).(string)
+	return city, ok
+}
+
+// CityRateBudget is a RateLimiter splitting a rate budget into equal shares
+// per city, so that a nationwide poller slows every city down alike instead
+// of starving the cities it polls last. A request tagged with WithCity waits
+// for its city's share and then for the overall budget; untagged requests
+// wait for the overall budget only.
+type CityRateBudget struct {
+	total *TokenBucket
+
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	shares int
+	cities map[string]*TokenBucket
+}
+
+// NewCityRateBudget creates a budget of rate requests per second with bursts
+// of up to burst requests, split among the given cities, or all Cities if
+// none are given. Each city may send rate/len(cities) requests per second.
+// Cities not listed get a share of the same size.
+func NewCityRateBudget(rate float64, burst int, cities ...string) *CityRateBudget {
+	if len(cities) == 0 {
+		cities = Cities
+	}
+	b := &CityRateBudget{total: NewTokenBucket(rate, burst), shares: len(cities), cities: map[string]*TokenBucket{}}
+	b.rate, b.burst = rate, burst
+	for _, city := range cities {
+		b.cities[city] = NewTokenBucket(b.shareLocked())
+	}
+	return b
+}
+
+// shareLocked returns the rate and burst of one city. b.mu must be held, or b
+// not yet shared.
+func (b *CityRateBudget) shareLocked() (float64, int) {
+	return b.rate / float64(b.shares), max(b.burst/b.shares, 1)
+}
+
+// SetRate changes the overall rate and burst, and the cities' shares with
+// them. A non-positive rate removes the limit.
+func (b *CityRateBudget) SetRate(rate float64, burst int) {
+	b.total.SetRate(rate, burst)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate, b.burst = rate, burst
+	for _, bucket := range b.cities {
+		bucket.SetRate(b.shareLocked())
+	}
+}
+
+// Wait blocks until a request may be sent within its city's share and the
+// overall budget, or ctx is done.
+func (b *CityRateBudget) Wait(ctx context.Context) error {
+	if city, ok := CityFromContext(ctx); ok {
+		if err := b.bucket(city).Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return b.total.Wait(ctx)
+}
+
+func (b *CityRateBudget) bucket(city string) *TokenBucket {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bucket, ok := b.cities[city]
+	if !ok {
+		bucket = NewTokenBucket(b.shareLocked())
+		b.cities[city] = bucket
+	}
+	return bucket
+}
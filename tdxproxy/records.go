@@ -0,0 +1,136 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrNotJSON is returned by the decode helpers for a response body that is
+// not JSON, such as the XML some endpoints answer without $format=JSON.
+var ErrNotJSON = errors.New("response is not JSON")
+
+// utf8BOM is the byte order mark some servers put before UTF-8 text.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// DecodeRecords splits a TDX response body into its records.
+// v2 APIs return a bare JSON array; v3 APIs wrap the array in an object
+// alongside metadata such as UpdateTime, in which case the single
+// array-valued field is used.
+func DecodeRecords(body []byte) ([]json.RawMessage, error) {
+	// Some endpoints prefix their body with a UTF-8 byte order mark.
+	body = bytes.TrimPrefix(bytes.TrimLeft(body, " \t\r\n"), utf8BOM)
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty response body")
+	}
+	if body[0] != '[' && body[0] != '{' {
+		if body[0] == '<' {
+			return nil, fmt.Errorf("%w: got XML, request it with $format=JSON", ErrNotJSON)
+		}
+		return nil, ErrNotJSON
+	}
+
+	var records []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, fmt.Errorf("failed to decode records: %w", err)
+		}
+		return records, nil
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode response envelope: %w", err)
+	}
+	found := ""
+	for name, value := range envelope {
+		value = bytes.TrimSpace(value)
+		if len(value) == 0 || value[0] != '[' {
+			continue
+		}
+		if found != "" {
+			return nil, fmt.Errorf("ambiguous response envelope: both %s and %s are arrays", found, name)
+		}
+		found = name
+	}
+	if found == "" {
+		return nil, errors.New("response envelope contains no record array")
+	}
+	if err := json.Unmarshal(envelope[found], &records); err != nil {
+		return nil, fmt.Errorf("failed to decode records in %s: %w", found, err)
+	}
+	return records, nil
+}
+
+// decodeErrorRawLimit caps the raw record included when a DecodeError is logged.
+const decodeErrorRawLimit = 1 << 10
+
+// DecodeError reports a record that could not be decoded into a typed model,
+// locating the failure so that schema changes on the TDX side can be
+// diagnosed from logs. It logs as a group including the offending record.
+type DecodeError struct {
+	// Index is the position of the record in the response.
+	Index int
+	// Path is the dotted path of the failing field, e.g. "BusPosition.PositionLat",
+	// or empty if the record itself is malformed.
+	Path string
+	Raw  json.RawMessage
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("record %d: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("record %d: field %s: %v", e.Index, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) LogValue() slog.Value {
+	raw := string(e.Raw)
+	if len(raw) > decodeErrorRawLimit {
+		raw = raw[:decodeErrorRawLimit] + "..."
+	}
+	return slog.GroupValue(
+		slog.Int("index", e.Index),
+		slog.String("path", e.Path),
+		slog.String("error", e.Err.Error()),
+		slog.String("raw", raw),
+	)
+}
+
+// decodeRecord unmarshals one record into v, returning a *DecodeError on failure.
+func decodeRecord(index int, record json.RawMessage, v any) error {
+	err := json.Unmarshal(record, v)
+	if err == nil {
+		return nil
+	}
+	decodeErr := &DecodeError{Index: index, Raw: record, Err: err}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		decodeErr.Path = typeErr.Field
+	}
+	return decodeErr
+}
+
+// DecodeAs decodes a TDX response body into typed records. A record that does
+// not match T fails the whole decode with a *DecodeError.
+func DecodeAs[T any](body []byte) ([]T, error) {
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, len(records))
+	for i, record := range records {
+		if err := decodeRecord(i, record, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,192 @@
+package tdxproxy
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+//go:embed reference.json
+var embeddedReference string
+
+// CityInfo is a city or county as TDX names it in paths, with its code used
+// in UIDs and its display names.
+type CityInfo struct {
+	City     string
+	CityCode string
+	CityName Name
+}
+
+// OperatorInfo is a rail operator with its display names.
+type OperatorInfo struct {
+	OperatorCode string
+	OperatorName Name
+}
+
+// MetroLine is a metro or light rail line with its display names and color.
+type MetroLine struct {
+	Operator string
+	LineID   string
+	LineName Name
+	// LineColor is the line's color as a hex RGB string, such as "#E3002C".
+	LineColor string
+}
+
+// ReferenceData is rarely-changing reference data, such as city codes and
+// metro line colors, for rendering labels and colors without TDX requests.
+type ReferenceData struct {
+	Cities     []CityInfo     `json:"cities"`
+	Operators  []OperatorInfo `json:"operators"`
+	MetroLines []MetroLine    `json:"metro_lines"`
+}
+
+// LoadReferenceData reads reference data in the JSON layout written by
+// ReferenceData.Encode.
+func LoadReferenceData(r io.Reader) (*ReferenceData, error) {
+	var data ReferenceData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to read reference data: %w", err)
+	}
+	if len(data.Cities) == 0 {
+		return nil, errors.New("reference data lists no cities")
+	}
+	return &data, nil
+}
+
+// Encode writes the reference data as JSON, for LoadReferenceData to read,
+// e.g. to keep the result of UpdateReferenceData across restarts.
+func (d *ReferenceData) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+var (
+	defaultReferenceMu sync.RWMutex
+	defaultReference   *ReferenceData
+)
+
+// DefaultReferenceData returns the reference data used by the lookup
+// functions. Unless replaced with SetReferenceData, it is the data embedded
+// in the package.
+func DefaultReferenceData() *ReferenceData {
+	defaultReferenceMu.RLock()
+	data := defaultReference
+	defaultReferenceMu.RUnlock()
+	if data != nil {
+		return data
+	}
+
+	defaultReferenceMu.Lock()
+	defer defaultReferenceMu.Unlock()
+	if defaultReference == nil {
+		data, err := LoadReferenceData(strings.NewReader(embeddedReference))
+		if err != nil {
+			panic("tdxproxy: invalid embedded reference data: " + err.Error())
+		}
+		defaultReference = data
+	}
+	return defaultReference
+}
+
+// SetReferenceData replaces the default reference data, e.g. with the result
+// of UpdateReferenceData.
+func SetReferenceData(data *ReferenceData) {
+	defaultReferenceMu.Lock()
+	defer defaultReferenceMu.Unlock()
+	defaultReference = data
+}
+
+// City returns the city named city in TDX paths, such as "Taipei".
+func (d *ReferenceData) City(city string) (CityInfo, bool) {
+	i := slices.IndexFunc(d.Cities, func(c CityInfo) bool { return c.City == city })
+	if i < 0 {
+		return CityInfo{}, false
+	}
+	return d.Cities[i], true
+}
+
+// CityByCode returns the city with the code code, such as "TPE".
+func (d *ReferenceData) CityByCode(code string) (CityInfo, bool) {
+	i := slices.IndexFunc(d.Cities, func(c CityInfo) bool { return c.CityCode == code })
+	if i < 0 {
+		return CityInfo{}, false
+	}
+	return d.Cities[i], true
+}
+
+// Operator returns the rail operator with the code code, such as "TRTC".
+func (d *ReferenceData) Operator(code string) (OperatorInfo, bool) {
+	i := slices.IndexFunc(d.Operators, func(o OperatorInfo) bool { return o.OperatorCode == code })
+	if i < 0 {
+		return OperatorInfo{}, false
+	}
+	return d.Operators[i], true
+}
+
+// MetroLine returns the line lineID of a metro operator.
+func (d *ReferenceData) MetroLine(operator, lineID string) (MetroLine, bool) {
+	i := slices.IndexFunc(d.MetroLines, func(l MetroLine) bool { return l.Operator == operator && l.LineID == lineID })
+	if i < 0 {
+		return MetroLine{}, false
+	}
+	return d.MetroLines[i], true
+}
+
+// MetroLineColor returns the color of a metro line from the default reference
+// data, such as "#E3002C" for TRTC line R, or "" if the line is unknown.
+func MetroLineColor(operator, lineID string) string {
+	line, _ := DefaultReferenceData().MetroLine(operator, lineID)
+	return line.LineColor
+}
+
+// UpdateReferenceData returns a copy of base, or of the default reference
+// data if base is nil, with the metro lines of every operator in
+// metroSchemas refreshed from TDX. Lines of an operator whose request fails
+// are kept as they were, and the errors are joined; the result is usable
+// either way. Pass it to SetReferenceData to apply it.
+func (proxy *TDXProxy) UpdateReferenceData(ctx context.Context, base *ReferenceData) (*ReferenceData, error) {
+	if base == nil {
+		base = DefaultReferenceData()
+	}
+	data := &ReferenceData{
+		Cities:     slices.Clone(base.Cities),
+		Operators:  slices.Clone(base.Operators),
+		MetroLines: slices.Clone(base.MetroLines),
+	}
+
+	operators := make([]string, 0, len(metroSchemas))
+	for operator := range metroSchemas {
+		operators = append(operators, operator)
+	}
+	slices.Sort(operators)
+
+	var errs []error
+	for _, operator := range operators {
+		body, err := proxy.fetchBody(ctx, "v2/Rail/Metro/Line/"+operator, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", operator, err))
+			continue
+		}
+		lines, err := DecodeAs[MetroLine](body)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", operator, err))
+			continue
+		}
+		data.MetroLines = slices.DeleteFunc(data.MetroLines, func(l MetroLine) bool { return l.Operator == operator })
+		for _, line := range lines {
+			line.Operator = operator
+			if line.LineColor != "" && !strings.HasPrefix(line.LineColor, "#") {
+				line.LineColor = "#" + line.LineColor
+			}
+			data.MetroLines = append(data.MetroLines, line)
+		}
+	}
+	return data, errors.Join(errs...)
+}
@@ -0,0 +1,203 @@
+package tdxproxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// IDKind is one of the identifier spaces TDX uses for bus stops and stations.
+type IDKind int
+
+const (
+	// StopUIDKind is the nationally unique stop ID, e.g. "TPE10001".
+	StopUIDKind IDKind = iota
+	// StopIDKind is the stop ID within its city, e.g. "10001".
+	StopIDKind
+	// StationUIDKind is the nationally unique ID of the station grouping the
+	// stops of both directions at one place.
+	StationUIDKind
+	// StationIDKind is the station ID within its city.
+	StationIDKind
+	// StationGroupIDKind groups the stations sharing a name around a junction.
+	StationGroupIDKind
+	numIDKinds
+)
+
+func (k IDKind) String() string {
+	switch k {
+	case StopUIDKind:
+		return "StopUID"
+	case StopIDKind:
+		return "StopID"
+	case StationUIDKind:
+		return "StationUID"
+	case StationIDKind:
+		return "StationID"
+	case StationGroupIDKind:
+		return "StationGroupID"
+	}
+	return fmt.Sprintf("IDKind(%d)", int(k))
+}
+
+// StopRef holds every ID a bus stop is known by. IDs TDX does not publish
+// for the stop are empty.
+type StopRef struct {
+	// City is the city code the stop was listed under, or "InterCity".
+	City           string
+	StopUID        string
+	StopID         string
+	StationUID     string
+	StationID      string
+	StationGroupID string
+	StopName       Name
+}
+
+// ID returns the stop's ID of the given kind.
+func (r StopRef) ID(kind IDKind) string {
+	switch kind {
+	case StopUIDKind:
+		return r.StopUID
+	case StopIDKind:
+		return r.StopID
+	case StationUIDKind:
+		return r.StationUID
+	case StationIDKind:
+		return r.StationID
+	case StationGroupIDKind:
+		return r.StationGroupID
+	}
+	return ""
+}
+
+// IDResolver cross-references the IDs of bus stops, so an ID from one feed
+// can be matched against records keyed by another, e.g. the StationID of an
+// alert against the StopUIDs of estimated arrivals. It is immutable and safe
+// for concurrent use; rebuild it when the stop data changes.
+type IDResolver struct {
+	refs  []StopRef
+	index [numIDKinds]map[string][]int
+}
+
+func NewIDResolver(refs []StopRef) *IDResolver {
+	r := &IDResolver{refs: refs}
+	for kind := range r.index {
+		r.index[kind] = map[string][]int{}
+	}
+	for i, ref := range refs {
+		for kind := range r.index {
+			if id := ref.ID(IDKind(kind)); id != "" {
+				r.index[kind][id] = append(r.index[kind][id], i)
+			}
+		}
+	}
+	return r
+}
+
+// Resolve returns the stops known by id in the given ID space, in the order
+// they were indexed, or nil if there are none. Only UIDs are unique: a StopID
+// or StationID may match stops in several cities, and a station or station
+// group matches each of its stops.
+func (r *IDResolver) Resolve(kind IDKind, id string) []StopRef {
+	if kind < 0 || kind >= numIDKinds {
+		return nil
+	}
+	indices := r.index[kind][id]
+	if len(indices) == 0 {
+		return nil
+	}
+	refs := make([]StopRef, len(indices))
+	for i, index := range indices {
+		refs[i] = r.refs[index]
+	}
+	return refs
+}
+
+// ResolveIn is like Resolve, keeping only the stops of city.
+func (r *IDResolver) ResolveIn(city string, kind IDKind, id string) []StopRef {
+	var refs []StopRef
+	for _, ref := range r.Resolve(kind, id) {
+		if ref.City == city {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Len returns the number of indexed stops.
+func (r *IDResolver) Len() int {
+	return len(r.refs)
+}
+
+// StopRefs returns the IDs of every bus stop of the given cities, or of
+// intercity stops for "InterCity", joining the Stop and Station endpoints:
+// stops carry their StationID, and StationUIDs are taken from the stations
+// listing them.
+func (proxy *TDXProxy) StopRefs(ctx context.Context, cities ...string) ([]StopRef, error) {
+	var refs []StopRef
+	for _, city := range cities {
+		if err := checkBusCity(city, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, city := range cities {
+		stops, err := fetchStatic[struct {
+			StopUID        string
+			StopID         string
+			StopName       Name
+			StationID      string
+			StationGroupID string
+		}](ctx, proxy, busPath("Stop", city), map[string]string{
+			"$select": "StopUID,StopID,StopName,StationID,StationGroupID",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stops of %s: %w", city, err)
+		}
+
+		stations, err := fetchStatic[struct {
+			StationUID string
+			StationID  string
+			Stops      []struct{ StopUID string }
+		}](ctx, proxy, busPath("Station", city), map[string]string{
+			"$select": "StationUID,StationID,Stops",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stations of %s: %w", city, err)
+		}
+		byStop := map[string]string{}
+		byStation := map[string]string{}
+		for _, s := range stations {
+			if s.StationID != "" {
+				byStation[s.StationID] = s.StationUID
+			}
+			for _, stop := range s.Stops {
+				byStop[stop.StopUID] = s.StationUID
+			}
+		}
+
+		for _, s := range stops {
+			ref := StopRef{
+				City:           city,
+				StopUID:        s.StopUID,
+				StopID:         s.StopID,
+				StationID:      s.StationID,
+				StationGroupID: s.StationGroupID,
+				StopName:       s.StopName,
+			}
+			ref.StationUID = byStop[s.StopUID]
+			if ref.StationUID == "" && s.StationID != "" {
+				ref.StationUID = byStation[s.StationID]
+			}
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// IDResolver builds an IDResolver over the bus stops of the given cities.
+func (proxy *TDXProxy) IDResolver(ctx context.Context, cities ...string) (*IDResolver, error) {
+	refs, err := proxy.StopRefs(ctx, cities...)
+	if err != nil {
+		return nil, err
+	}
+	return NewIDResolver(refs), nil
+}
@@ -0,0 +1,133 @@
+package tdxproxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides whether a failed attempt is retried.
+type RetryPolicy interface {
+	// ShouldRetry is called after every unsuccessful attempt, numbered from 1.
+	// resp is nil when the request failed with err. It returns how long to
+	// wait before the next attempt and whether there should be one at all.
+	// The proxy waits at least as long as the response's Retry-After header
+	// asks. Unauthorized responses refresh the token before the next attempt.
+	ShouldRetry(attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// StatusRetryPolicy retries unauthorized responses right away and
+// rate-limited responses after the Backoff delay, up to MaxAttempts in total.
+// Transport errors and other statuses are not retried.
+type StatusRetryPolicy struct {
+	MaxAttempts int
+	Backoff     Backoff
+}
+
+// NeverRetry is a RetryPolicy that never retries, for callers implementing their own policy.
+var NeverRetry RetryPolicy = neverRetry{}
+
+type neverRetry struct{}
+
+func (neverRetry) ShouldRetry(int, *http.Response, error) (time.Duration, bool) {
+	return 0, false
+}
+
+func defaultRetryPolicy() RetryPolicy {
+	return &StatusRetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{Delay: 1 * time.Second}}
+}
+
+// sequenceRetryPolicy is a RetryPolicy that can pass the previous delay of a
+// request on to a SequenceBackoff.
+type sequenceRetryPolicy interface {
+	shouldRetryAfter(previous time.Duration, attempt int, resp *http.Response, err error) (time.Duration, bool)
+}
+
+// shouldRetry asks policy whether to retry a failed attempt, telling policies
+// that can use it the delay waited before the attempt.
+func shouldRetry(policy RetryPolicy, previous time.Duration, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if p, ok := policy.(sequenceRetryPolicy); ok {
+		return p.shouldRetryAfter(previous, attempt, resp, err)
+	}
+	return policy.ShouldRetry(attempt, resp, err)
+}
+
+func (p *StatusRetryPolicy) ShouldRetry(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	return p.shouldRetryAfter(-1, attempt, resp, err)
+}
+
+func (p *StatusRetryPolicy) shouldRetryAfter(previous time.Duration, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil || attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return 0, true
+	case http.StatusTooManyRequests:
+		if p.Backoff == nil {
+			return 0, true
+		}
+		return nextDelay(p.Backoff, previous, attempt, resp), true
+	default:
+		return 0, false
+	}
+}
+
+// AuthRetryPolicy retries token requests that failed with a transport error,
+// 429 or a 5xx status, waiting the Backoff delay, up to MaxAttempts in total.
+// Other failures, such as rejected credentials, are not retried.
+type AuthRetryPolicy struct {
+	MaxAttempts int
+	Backoff     Backoff
+}
+
+// defaultAuthRetryPolicy spreads out retries of the auth endpoint, which every
+// request depends on, so that a struggling endpoint is not hit by all waiting
+// requests at once.
+func defaultAuthRetryPolicy() RetryPolicy {
+	return &AuthRetryPolicy{MaxAttempts: 4, Backoff: DecorrelatedJitterBackoff{Base: 500 * time.Millisecond, Max: 10 * time.Second}}
+}
+
+func (p *AuthRetryPolicy) ShouldRetry(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	return p.shouldRetryAfter(-1, attempt, resp, err)
+}
+
+func (p *AuthRetryPolicy) shouldRetryAfter(previous time.Duration, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if err == nil && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false
+	}
+	if p.Backoff == nil {
+		return 0, true
+	}
+	return nextDelay(p.Backoff, previous, attempt, resp), true
+}
+
+// SetRetryPolicy replaces the policy deciding which failed attempts are retried.
+func (proxy *TDXProxy) SetRetryPolicy(policy RetryPolicy) {
+	if policy == nil {
+		proxy.logger.Warn("Nil retry policy provided")
+		return
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.retryPolicy = policy
+}
+
+// SetAuthRetryPolicy replaces the policy deciding which failed token requests
+// are retried. Token requests hold up every request needing the token, so
+// the default backs off with jitter on 429 and 5xx responses.
+func (proxy *TDXProxy) SetAuthRetryPolicy(policy RetryPolicy) {
+	if policy == nil {
+		proxy.logger.Warn("Nil auth retry policy provided")
+		return
+	}
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.authRetry = policy
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusTooManyRequests
+}
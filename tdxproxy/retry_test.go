@@ -0,0 +1,135 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingClock is the system clock, except that After records the delay
+// and fires at once, so retry tests see the waits without sleeping.
+type recordingClock struct {
+	systemClock
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+// retryServer answers the nth request, counting from 1, with respond(n, w).
+func retryServer(t *testing.T, respond func(n int64, w http.ResponseWriter)) (*TDXProxy, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respond(calls.Add(1), w)
+	}))
+	t.Cleanup(server.Close)
+	proxy := NewTDXProxyNoAuth(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	proxy.SetBaseURL(server.URL + "/")
+	return proxy, &calls
+}
+
+func TestRetryAttempts(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		attempts  int64
+		wantDelay int
+	}{
+		{"rate limited", http.StatusTooManyRequests, 3, 2},
+		{"server error", http.StatusInternalServerError, 1, 0},
+		{"not found", http.StatusNotFound, 1, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy, calls := retryServer(t, func(_ int64, w http.ResponseWriter) {
+				w.WriteHeader(tc.status)
+			})
+			clock := &recordingClock{}
+			proxy.SetClock(clock)
+			proxy.SetRetryPolicy(&StatusRetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{Delay: time.Second}})
+
+			_, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0)
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tc.status {
+				t.Fatalf("got %v, want a %d StatusError", err, tc.status)
+			}
+			if n := calls.Load(); n != tc.attempts {
+				t.Errorf("sent %d requests, want %d", n, tc.attempts)
+			}
+			if len(statusErr.Attempts) != int(tc.attempts) {
+				t.Errorf("error lists %d attempts, want %d", len(statusErr.Attempts), tc.attempts)
+			}
+			if len(clock.delays) != tc.wantDelay {
+				t.Errorf("waited %v, want %d waits", clock.delays, tc.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	proxy, calls := retryServer(t, func(n int64, w http.ResponseWriter) {
+		switch n {
+		case 1:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// Shorter than the backoff, which wins.
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			io.WriteString(w, "[]")
+		}
+	})
+	clock := &recordingClock{}
+	proxy.SetClock(clock)
+	proxy.SetRetryPolicy(&StatusRetryPolicy{MaxAttempts: 3, Backoff: ConstantBackoff{Delay: 2 * time.Second}})
+
+	resp, err := proxy.GetContext(context.Background(), "v2/Bus/Route/City/Taipei", nil, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := calls.Load(); n != 3 {
+		t.Errorf("sent %d requests, want 3", n)
+	}
+	want := []time.Duration{30 * time.Second, 2 * time.Second}
+	if len(clock.delays) != len(want) || clock.delays[0] != want[0] || clock.delays[1] != want[1] {
+		t.Errorf("waited %v, want %v", clock.delays, want)
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	proxy, calls := retryServer(t, func(_ int64, w http.ResponseWriter) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	proxy.SetRetryPolicy(&StatusRetryPolicy{MaxAttempts: 10, Backoff: ConstantBackoff{Delay: time.Hour}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := proxy.GetContext(ctx, "v2/Bus/Route/City/Taipei", nil, nil, 0)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned %v after the cancel", elapsed)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1 before the cancel", n)
+	}
+}
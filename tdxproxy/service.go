@@ -0,0 +1,102 @@
+package tdxproxy
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Service is a sub-client bound to a TDX path prefix, such as "v2/Bus/", with
+// default query parameters and headers added to each of its requests. It
+// shares the proxy's credentials, cache and settings. A Service is immutable
+// and safe for concurrent use; the With methods return modified copies.
+//
+//	bus := proxy.Service("v2/Bus/").WithParams(map[string]string{"$format": "JSON"})
+//	resp, err := bus.GetContext(ctx, "Route/City/Taipei", map[string]string{"$top": "10"})
+type Service struct {
+	proxy   *TDXProxy
+	prefix  string
+	params  map[string]string
+	headers map[string]string
+	timeout time.Duration
+}
+
+// Service returns a sub-client for the paths under prefix.
+func (proxy *TDXProxy) Service(prefix string) *Service {
+	return &Service{proxy: proxy, prefix: joinServicePath("", prefix)}
+}
+
+// Service returns a sub-client for the paths under prefix, relative to the
+// service's own prefix, keeping its defaults.
+func (s *Service) Service(prefix string) *Service {
+	c := *s
+	c.prefix = joinServicePath(s.prefix, prefix)
+	return &c
+}
+
+// WithParams returns a copy of the service with params added to its default
+// query parameters. Parameters passed to a request take precedence.
+func (s *Service) WithParams(params map[string]string) *Service {
+	c := *s
+	c.params = mergeStrings(s.params, params)
+	return &c
+}
+
+// WithHeaders returns a copy of the service with headers added to its
+// default headers. Headers passed to a request take precedence.
+func (s *Service) WithHeaders(headers map[string]string) *Service {
+	c := *s
+	c.headers = mergeStrings(s.headers, headers)
+	return &c
+}
+
+// WithTimeout returns a copy of the service whose requests time out after d.
+func (s *Service) WithTimeout(d time.Duration) *Service {
+	c := *s
+	c.timeout = d
+	return &c
+}
+
+// Path returns the TDX path of path under the service's prefix.
+func (s *Service) Path(path string) string {
+	return s.prefix + strings.TrimPrefix(path, "/")
+}
+
+// Get is like GetContext with a background context.
+func (s *Service) Get(path string, params map[string]string, opts ...RequestOption) (*http.Response, error) {
+	return s.GetContext(context.Background(), path, params, opts...)
+}
+
+// GetContext sends a GET request for path under the service's prefix, with
+// params merged over the service's default parameters.
+func (s *Service) GetContext(ctx context.Context, path string, params map[string]string, opts ...RequestOption) (*http.Response, error) {
+	return s.GetWithHeaders(ctx, path, params, nil, opts...)
+}
+
+// GetWithHeaders is like GetContext with headers merged over the service's default headers.
+func (s *Service) GetWithHeaders(ctx context.Context, path string, params, headers map[string]string, opts ...RequestOption) (*http.Response, error) {
+	return s.proxy.GetContext(ctx, s.Path(path), mergeStrings(s.params, params), mergeStrings(s.headers, headers), s.timeout, opts...)
+}
+
+// joinServicePath appends prefix to base, ending the result with a slash.
+func joinServicePath(base, prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return base
+	}
+	return base + prefix + "/"
+}
+
+// mergeStrings returns the entries of a overridden by those of b, or nil if
+// there are none, so that requests without parameters get the proxy defaults.
+func mergeStrings(a, b map[string]string) map[string]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(a)+len(b))
+	maps.Copy(merged, a)
+	maps.Copy(merged, b)
+	return merged
+}
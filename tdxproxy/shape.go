@@ -0,0 +1,227 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RouteShape is the geometry of a route direction, measured in meters along
+// its length, for snapping vehicle positions onto the route.
+type RouteShape struct {
+	RouteUID    string
+	SubRouteUID string
+	Direction   int
+	points      []shapePoint
+}
+
+type shapePoint struct {
+	lat, lon float64
+	// distance is the length of the shape from its start to this point.
+	distance float64
+}
+
+// ShapeMatch is a position snapped onto a RouteShape.
+type ShapeMatch struct {
+	// Lat and Lon are the nearest point on the shape.
+	Lat float64
+	Lon float64
+	// Progress is the distance in meters from the start of the shape.
+	Progress float64
+	// Offset is the distance in meters between the position and the shape.
+	Offset float64
+}
+
+// NewRouteShape builds a shape from points given as latitude and longitude.
+func NewRouteShape(points [][2]float64) *RouteShape {
+	shape := &RouteShape{points: make([]shapePoint, len(points))}
+	for i, p := range points {
+		shape.points[i] = shapePoint{lat: p[0], lon: p[1]}
+		if i > 0 {
+			prev := shape.points[i-1]
+			shape.points[i].distance = prev.distance + haversine(prev.lat, prev.lon, p[0], p[1])
+		}
+	}
+	return shape
+}
+
+// ParseLineString reads a WKT LINESTRING, as in the Geometry field of TDX shape
+// records, into latitude and longitude pairs. WKT lists longitude first.
+func ParseLineString(wkt string) ([][2]float64, error) {
+	wkt = strings.TrimSpace(wkt)
+	if len(wkt) < len("LINESTRING") || !strings.EqualFold(wkt[:len("LINESTRING")], "LINESTRING") {
+		return nil, fmt.Errorf("not a WKT LINESTRING: %.32q", wkt)
+	}
+	coords := strings.TrimSpace(wkt[len("LINESTRING"):])
+	coords, ok := strings.CutPrefix(coords, "(")
+	if ok {
+		coords, ok = strings.CutSuffix(coords, ")")
+	}
+	if !ok {
+		return nil, fmt.Errorf("not a WKT LINESTRING: %.32q", wkt)
+	}
+
+	var points [][2]float64
+	for _, pair := range strings.Split(coords, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid LINESTRING coordinate %q", pair)
+		}
+		lon, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LINESTRING coordinate %q", pair)
+		}
+		lat, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || math.IsNaN(lon) || math.IsInf(lon, 0) || math.IsNaN(lat) || math.IsInf(lat, 0) {
+			return nil, fmt.Errorf("invalid LINESTRING coordinate %q", pair)
+		}
+		points = append(points, [2]float64{lat, lon})
+	}
+	return points, nil
+}
+
+// ShapesFromRecords builds shapes from TDX Bus Shape records.
+func ShapesFromRecords(records []json.RawMessage) ([]*RouteShape, error) {
+	shapes := make([]*RouteShape, 0, len(records))
+	for i, record := range records {
+		var fields struct {
+			RouteUID    string
+			SubRouteUID string
+			Direction   int
+			Geometry    string
+		}
+		if err := decodeRecord(i, record, &fields); err != nil {
+			return nil, err
+		}
+		points, err := ParseLineString(fields.Geometry)
+		if err != nil {
+			return nil, &DecodeError{Index: i, Path: "Geometry", Raw: record, Err: err}
+		}
+		shape := NewRouteShape(points)
+		shape.RouteUID, shape.SubRouteUID, shape.Direction = fields.RouteUID, fields.SubRouteUID, fields.Direction
+		shapes = append(shapes, shape)
+	}
+	return shapes, nil
+}
+
+// BusRouteShapes fetches the shapes of a city bus route, one per direction or
+// sub-route. A route without shapes fails with ErrRouteNotOperated.
+func (proxy *TDXProxy) BusRouteShapes(ctx context.Context, city, route string) ([]*RouteShape, error) {
+	if err := checkBusCity(city, false); err != nil {
+		return nil, err
+	}
+	body, err := proxy.fetchBody(ctx, "v2/Bus/Shape/City/"+city+"/"+url.PathEscape(route), nil)
+	if err != nil {
+		return nil, err
+	}
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, &ServiceError{Service: "bus", Kind: ErrRouteNotOperated, Value: route}
+	}
+	return ShapesFromRecords(records)
+}
+
+// Length returns the length of the shape in meters.
+func (s *RouteShape) Length() float64 {
+	if len(s.points) == 0 {
+		return 0
+	}
+	return s.points[len(s.points)-1].distance
+}
+
+// Snap returns the point of the shape nearest to a position.
+func (s *RouteShape) Snap(lat, lon float64) ShapeMatch {
+	return s.snap(lat, lon, 0)
+}
+
+// SnapAfter is like Snap but ignores the shape before minProgress. Passing the
+// vehicle's previous progress keeps it from jumping back on routes that loop
+// or run along the same road in both directions.
+func (s *RouteShape) SnapAfter(lat, lon, minProgress float64) ShapeMatch {
+	return s.snap(lat, lon, minProgress)
+}
+
+func (s *RouteShape) snap(lat, lon, minProgress float64) ShapeMatch {
+	if len(s.points) == 0 {
+		return ShapeMatch{Lat: lat, Lon: lon}
+	}
+	if len(s.points) == 1 {
+		p := s.points[0]
+		return ShapeMatch{Lat: p.lat, Lon: p.lon, Offset: haversine(lat, lon, p.lat, p.lon)}
+	}
+
+	best := ShapeMatch{Offset: math.Inf(1)}
+	for i := 1; i < len(s.points); i++ {
+		a, b := s.points[i-1], s.points[i]
+		if b.distance < minProgress {
+			continue
+		}
+		// Project onto the segment in a local plane around its start, which is
+		// accurate for the short segments shapes are made of.
+		scale := math.Cos(a.lat * math.Pi / 180)
+		bx, by := (b.lon-a.lon)*scale, b.lat-a.lat
+		px, py := (lon-a.lon)*scale, lat-a.lat
+		t := 0.0
+		if length2 := bx*bx + by*by; length2 > 0 {
+			t = math.Max(0, math.Min(1, (px*bx+py*by)/length2))
+		}
+		if progress := a.distance + t*(b.distance-a.distance); progress < minProgress && b.distance > a.distance {
+			t = (minProgress - a.distance) / (b.distance - a.distance)
+		}
+		snappedLat, snappedLon := a.lat+t*(b.lat-a.lat), a.lon+t*(b.lon-a.lon)
+		if offset := haversine(lat, lon, snappedLat, snappedLon); offset < best.Offset {
+			best = ShapeMatch{
+				Lat:      snappedLat,
+				Lon:      snappedLon,
+				Progress: a.distance + t*(b.distance-a.distance),
+				Offset:   offset,
+			}
+		}
+	}
+	if math.IsInf(best.Offset, 1) {
+		last := s.points[len(s.points)-1]
+		return ShapeMatch{Lat: last.lat, Lon: last.lon, Progress: last.distance, Offset: haversine(lat, lon, last.lat, last.lon)}
+	}
+	return best
+}
+
+// PointAt returns the position at progress meters along the shape, clamped to
+// its ends, for animating a vehicle smoothly between position reports.
+func (s *RouteShape) PointAt(progress float64) (lat, lon float64) {
+	if len(s.points) == 0 {
+		return 0, 0
+	}
+	for i := 1; i < len(s.points); i++ {
+		a, b := s.points[i-1], s.points[i]
+		if progress <= b.distance {
+			if b.distance == a.distance || progress <= a.distance {
+				return a.lat, a.lon
+			}
+			t := (progress - a.distance) / (b.distance - a.distance)
+			return a.lat + t*(b.lat-a.lat), a.lon + t*(b.lon-a.lon)
+		}
+	}
+	last := s.points[len(s.points)-1]
+	return last.lat, last.lon
+}
+
+// DistanceAlong returns the distance in meters along the shape from a snapped
+// position to a stop, negative if the stop has already been passed.
+func (s *RouteShape) DistanceAlong(from ShapeMatch, stopLat, stopLon float64) float64 {
+	return s.Snap(stopLat, stopLon).Progress - from.Progress
+}
+
+// haversine returns the great-circle distance in meters between two coordinates.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dPhi, dLambda := phi2-phi1, (lon2-lon1)*math.Pi/180
+	h := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,67 @@
+package tdxproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLineString(t *testing.T) {
+	tests := []struct {
+		name string
+		wkt  string
+		want [][2]float64
+	}{
+		{"line", "LINESTRING(121.517 25.0478,121.5081 25.0421)", [][2]float64{{25.0478, 121.517}, {25.0421, 121.5081}}},
+		{"spaced", " linestring ( 121.517 25.0478 , 121.5081 25.0421 ) ", [][2]float64{{25.0478, 121.517}, {25.0421, 121.5081}}},
+		{"with height", "LINESTRING(121.517 25.0478 12)", [][2]float64{{25.0478, 121.517}}},
+
+		{"empty", "", nil},
+		{"blank", "   ", nil},
+		{"empty line", "LINESTRING EMPTY", nil},
+		{"no coordinates", "LINESTRING()", nil},
+		{"keyword only", "LINESTRING", nil},
+		{"truncated keyword", "LINESTR", nil},
+		{"truncated after paren", "LINESTRING(", nil},
+		{"truncated coordinate", "LINESTRING(121.517 25.0478,121.5", nil},
+		{"truncated close", "LINESTRING(121.517 25.0478,121.5081 25.0421", nil},
+		{"no open", "LINESTRING 121.517 25.0478)", nil},
+		{"trailing comma", "LINESTRING(121.517 25.0478,)", nil},
+		{"not a number", "LINESTRING(121.517 north)", nil},
+		{"not finite", "LINESTRING(121.517 25.0478,NaN Inf)", nil},
+		{"point", "POINT(121.517 25.0478)", nil},
+		{"multi", "MULTILINESTRING((121.517 25.0478,121.5081 25.0421))", nil},
+		{"polygon", "POLYGON((121.5 25,121.6 25,121.6 25.1,121.5 25))", nil},
+		{"json", `{"type":"LineString"}`, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseLineString(tc.wkt)
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestShapesFromRecordsInvalidGeometry(t *testing.T) {
+	records := []json.RawMessage{
+		json.RawMessage(`{"RouteUID":"TPE10132","Direction":0,"Geometry":"LINESTRING(121.517 25.0478,121.5081 25.0421)"}`),
+		json.RawMessage(`{"RouteUID":"TPE10132","Direction":1,"Geometry":"LINESTRING(121.5081 25.0421,121.5"}`),
+	}
+	_, err := ShapesFromRecords(records)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Index != 1 || decodeErr.Path != "Geometry" {
+		t.Errorf("got %v, want a DecodeError for the Geometry of record 1", err)
+	}
+}
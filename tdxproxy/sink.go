@@ -0,0 +1,84 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Batch is a set of records fetched from one endpoint.
+type Batch struct {
+	Endpoint string
+	Time     time.Time
+	Records  []json.RawMessage
+}
+
+// Sink is a destination for fetched records. The watcher, the exporters and
+// the pipeline package all write through it, so custom destinations only need
+// to implement these three methods.
+//
+// Write may buffer; Flush sends everything written so far. Close flushes and
+// releases the sink's own resources, but not clients passed to its constructor.
+type Sink interface {
+	Write(ctx context.Context, batch Batch) error
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+var (
+	_ Sink = (*MQTTSink)(nil)
+	_ Sink = (*KafkaSink)(nil)
+	_ Sink = (*NATSSink)(nil)
+	_ Sink = (*ObjectExporter)(nil)
+)
+
+// SinkFactory creates a sink from string options, as given in a pipeline spec.
+type SinkFactory func(options map[string]string) (Sink, error)
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = make(map[string]SinkFactory)
+)
+
+// RegisterSink makes a sink type available by name to OpenSink. It is meant to
+// be called from init functions and panics if name is registered twice.
+func RegisterSink(name string, factory SinkFactory) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if factory == nil {
+		panic("tdxproxy: RegisterSink factory is nil")
+	}
+	if _, dup := sinks[name]; dup {
+		panic("tdxproxy: RegisterSink called twice for sink " + name)
+	}
+	sinks[name] = factory
+}
+
+// OpenSink creates a sink of a registered type.
+func OpenSink(name string, options map[string]string) (Sink, error) {
+	sinksMu.RLock()
+	factory, ok := sinks[name]
+	sinksMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+	return factory(options)
+}
+
+// Sinks returns the names of the registered sink types in sorted order.
+func Sinks() []string {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	return sortedKeys(sinks)
+}
+
+// eventBatch decodes the records of a change event.
+func eventBatch(event ChangeEvent) (Batch, error) {
+	records, err := DecodeRecords(event.Data)
+	if err != nil {
+		return Batch{}, err
+	}
+	return Batch{Endpoint: event.Endpoint, Time: event.Time, Records: records}, nil
+}
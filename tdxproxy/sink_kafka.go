@@ -0,0 +1,140 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// KafkaMessage is a message for a KafkaProducer.
+type KafkaMessage struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer is the part of a Kafka client the sink needs. Clients such as
+// franz-go, sarama or segmentio/kafka-go can be adapted to it.
+type KafkaProducer interface {
+	Produce(ctx context.Context, messages []KafkaMessage) error
+}
+
+// RecordEncoder encodes a single record into a message value.
+type RecordEncoder interface {
+	Encode(record json.RawMessage) ([]byte, error)
+}
+
+// JSONEncoder writes records as compact JSON.
+type JSONEncoder struct{}
+
+func (JSONEncoder) Encode(record json.RawMessage) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+// KafkaSink writes records to Kafka, one message per record. Topics are built
+// from a template like MQTTSink topics ({path}, {0}, {1}, ...), keys are taken
+// from a top-level record field, and values are encoded with JSONEncoder unless
+// another encoder, such as an AvroEncoder, is set.
+type KafkaSink struct {
+	producer KafkaProducer
+	topic    string
+	keyField string
+	encoder  RecordEncoder
+	logger   *slog.Logger
+}
+
+func NewKafkaSink(producer KafkaProducer, topic string, logger *slog.Logger) *KafkaSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &KafkaSink{
+		producer: producer,
+		topic:    topic,
+		encoder:  JSONEncoder{},
+		logger:   logger,
+	}
+}
+
+// SetKeyField selects the record field used as message key, e.g. "StopUID".
+// Records without the field are sent without a key.
+func (s *KafkaSink) SetKeyField(field string) {
+	s.keyField = field
+}
+
+// SetEncoder replaces the encoder of message values.
+func (s *KafkaSink) SetEncoder(encoder RecordEncoder) {
+	if encoder == nil {
+		s.logger.Warn("Nil record encoder provided")
+		return
+	}
+	s.encoder = encoder
+}
+
+// WriteRecords sends the records fetched from endpoint as one batch.
+func (s *KafkaSink) WriteRecords(ctx context.Context, endpoint string, records []json.RawMessage) error {
+	topic := expandTopic(s.topic, endpoint)
+	messages := make([]KafkaMessage, 0, len(records))
+	for i, record := range records {
+		value, err := s.encoder.Encode(record)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+		messages = append(messages, KafkaMessage{
+			Topic: topic,
+			Key:   recordKey(record, s.keyField),
+			Value: value,
+		})
+	}
+	if err := s.producer.Produce(ctx, messages); err != nil {
+		return fmt.Errorf("failed to produce to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Publish sends the records of a watcher change event.
+func (s *KafkaSink) Publish(ctx context.Context, event ChangeEvent) error {
+	batch, err := eventBatch(event)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, batch)
+}
+
+// Write sends a batch; it implements Sink.
+func (s *KafkaSink) Write(ctx context.Context, batch Batch) error {
+	return s.WriteRecords(ctx, batch.Endpoint, batch.Records)
+}
+
+// Flush implements Sink. Messages are produced by Write, so there is nothing to flush.
+func (s *KafkaSink) Flush(ctx context.Context) error { return nil }
+
+// Close implements Sink. It does not close the producer.
+func (s *KafkaSink) Close() error { return nil }
+
+// Run publishes every event from the watcher until ctx is done. Failures are
+// logged and do not stop the sink.
+func (s *KafkaSink) Run(ctx context.Context, watcher *Watcher) error {
+	return watcher.RunSink(ctx, s)
+}
+
+// recordKey returns the value of a top-level field as key bytes, or nil.
+// String values are used without their JSON quotes.
+func recordKey(record json.RawMessage, field string) []byte {
+	if field == "" {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil
+	}
+	raw, ok := fields[field]
+	if !ok {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return []byte(s)
+	}
+	return []byte(raw)
+}
@@ -0,0 +1,152 @@
+package tdxproxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// MQTTPublisher is the part of an MQTT client the sink needs. Clients such as
+// Eclipse Paho can be adapted with a few lines, e.g. waiting on the returned token.
+type MQTTPublisher interface {
+	Publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error
+}
+
+// MQTTSink publishes watcher change events to an MQTT broker.
+//
+// The topic for an event is built from the template set with SetTopic, where
+// {0}, {1}, ... are replaced with the segments of the endpoint path. With the
+// default template "tdx/{path}", {path} is the whole endpoint path, so
+// v2/Bus/EstimatedTimeOfArrival/City/Taichung/307 is published to
+// tdx/v2/Bus/EstimatedTimeOfArrival/City/Taichung/307.
+// Templates can also be set per endpoint prefix, for example
+// SetTopicFor("v2/Bus/EstimatedTimeOfArrival/", "tdx/bus/eta/{4}/{5}").
+type MQTTSink struct {
+	client   MQTTPublisher
+	qos      byte
+	retained bool
+	topic    string
+	prefixes []topicRule
+	logger   *slog.Logger
+}
+
+type topicRule struct {
+	prefix   string
+	template string
+}
+
+// NewMQTTSink creates a sink publishing with QoS 1 and the retained flag set,
+// so displays that connect later receive the latest data immediately.
+func NewMQTTSink(client MQTTPublisher, logger *slog.Logger) *MQTTSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &MQTTSink{
+		client:   client,
+		qos:      1,
+		retained: true,
+		topic:    "tdx/{path}",
+		logger:   logger,
+	}
+}
+
+// SetQoS sets the MQTT quality of service level (0, 1 or 2) and whether messages are retained.
+func (s *MQTTSink) SetQoS(qos byte, retained bool) {
+	if qos > 2 {
+		s.logger.Warn("Invalid MQTT QoS provided", slog.Int("qos", int(qos)))
+		return
+	}
+	s.qos = qos
+	s.retained = retained
+}
+
+// SetTopic sets the default topic template.
+func (s *MQTTSink) SetTopic(template string) {
+	if template == "" {
+		s.logger.Warn("Empty MQTT topic template provided")
+		return
+	}
+	s.topic = template
+}
+
+// SetTopicFor sets the topic template for endpoints starting with prefix.
+// The longest matching prefix wins.
+func (s *MQTTSink) SetTopicFor(prefix, template string) {
+	s.prefixes = append(s.prefixes, topicRule{prefix: prefix, template: template})
+}
+
+// Topic returns the topic an endpoint's events are published to.
+func (s *MQTTSink) Topic(endpoint string) string {
+	template, longest := s.topic, -1
+	for _, rule := range s.prefixes {
+		if strings.HasPrefix(endpoint, rule.prefix) && len(rule.prefix) > longest {
+			template, longest = rule.template, len(rule.prefix)
+		}
+	}
+	return expandTopic(template, endpoint)
+}
+
+// Publish sends the event's data to its topic.
+func (s *MQTTSink) Publish(ctx context.Context, event ChangeEvent) error {
+	topic := s.Topic(event.Endpoint)
+	if err := s.client.Publish(ctx, topic, s.qos, s.retained, event.Data); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Write publishes the batch's records as a JSON array; it implements Sink.
+// Publish sends the original response body instead.
+func (s *MQTTSink) Write(ctx context.Context, batch Batch) error {
+	records := batch.Records
+	if records == nil {
+		records = []json.RawMessage{}
+	}
+	payload, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+	topic := s.Topic(batch.Endpoint)
+	if err := s.client.Publish(ctx, topic, s.qos, s.retained, payload); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Flush implements Sink. Messages are published by Write, so there is nothing to flush.
+func (s *MQTTSink) Flush(ctx context.Context) error { return nil }
+
+// Close implements Sink. It does not disconnect the client.
+func (s *MQTTSink) Close() error { return nil }
+
+// Run publishes every event from the watcher until ctx is done. Publish
+// failures are logged and do not stop the sink.
+func (s *MQTTSink) Run(ctx context.Context, watcher *Watcher) error {
+	events, unsubscribe := watcher.Subscribe(64)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Publish(ctx, event); err != nil {
+				s.logger.Error("Failed to publish change event", slog.String("url", event.Endpoint), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// expandTopic fills a topic template from the endpoint path.
+func expandTopic(template, endpoint string) string {
+	segments := strings.Split(strings.Trim(endpoint, "/"), "/")
+	replacements := []string{"{path}", strings.Join(segments, "/")}
+	for i, segment := range segments {
+		replacements = append(replacements, fmt.Sprintf("{%d}", i), segment)
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
@@ -0,0 +1,196 @@
+package tdxproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPublisher is the part of a NATS or JetStream client the sink needs.
+// msgID should be sent as the Nats-Msg-Id header, which lets JetStream drop
+// duplicates within its deduplication window.
+type NATSPublisher interface {
+	Publish(ctx context.Context, subject string, data []byte, msgID string) error
+}
+
+// NATSSink publishes watcher change events and snapshots to NATS subjects.
+//
+// Subjects are built from a template like MQTTSink topics, with "/" turned
+// into "." so the default "tdx.{path}" maps v2/Bus/Route/City/Taipei to
+// tdx.v2.Bus.Route.City.Taipei. Change events are published one message per
+// record. The message ID is made of the endpoint, the event time and the
+// record's hash, so JetStream drops redeliveries of an event but neither
+// identical records of different endpoints nor a record that changes back to
+// an earlier value. With deduplication enabled, records identical to ones
+// published in the endpoint's previous event are skipped.
+type NATSSink struct {
+	client  NATSPublisher
+	subject string
+	dedup   bool
+	logger  *slog.Logger
+
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+
+	store    StateStore
+	stateKey string
+}
+
+func NewNATSSink(client NATSPublisher, logger *slog.Logger) *NATSSink {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &NATSSink{
+		client:  client,
+		subject: "tdx.{path}",
+		logger:  logger,
+		seen:    make(map[string]map[string]struct{}),
+	}
+}
+
+// SetSubject sets the subject template.
+func (s *NATSSink) SetSubject(template string) {
+	if template == "" {
+		s.logger.Warn("Empty NATS subject template provided")
+		return
+	}
+	s.subject = template
+}
+
+// SetDedup enables skipping records that have not changed since the endpoint's previous event.
+func (s *NATSSink) SetDedup(enabled bool) {
+	s.dedup = enabled
+}
+
+// SetStateStore makes the sink keep the record hashes it deduplicates
+// against in store, under key followed by "/" and the endpoint, so that the
+// first event after a restart publishes only the records that changed.
+func (s *NATSSink) SetStateStore(store StateStore, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store, s.stateKey = store, key
+}
+
+// loadSeen returns the record hashes of an endpoint saved in the state store.
+// Failures are logged; the endpoint's next event is then published in full.
+func (s *NATSSink) loadSeen(ctx context.Context, endpoint string) map[string]struct{} {
+	s.mu.Lock()
+	store, key := s.store, s.stateKey
+	s.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+	data, err := store.LoadState(ctx, key+"/"+endpoint)
+	var hashes []string
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, &hashes)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to load NATS dedup state", slog.String("endpoint", endpoint), slog.String("error", err.Error()))
+		return nil
+	}
+	seen := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		seen[hash] = struct{}{}
+	}
+	return seen
+}
+
+// saveSeen writes the record hashes of an endpoint to the state store,
+// logging failures.
+func (s *NATSSink) saveSeen(ctx context.Context, endpoint string, seen map[string]struct{}) {
+	s.mu.Lock()
+	store, key := s.store, s.stateKey
+	s.mu.Unlock()
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(sortedKeys(seen))
+	if err == nil {
+		err = store.SaveState(context.WithoutCancel(ctx), key+"/"+endpoint, data)
+	}
+	if err != nil {
+		s.logger.Warn("Failed to save NATS dedup state", slog.String("endpoint", endpoint), slog.String("error", err.Error()))
+	}
+}
+
+// Subject returns the subject an endpoint's messages are published to.
+func (s *NATSSink) Subject(endpoint string) string {
+	return strings.ReplaceAll(expandTopic(s.subject, endpoint), "/", ".")
+}
+
+// Publish sends the records of a change event.
+func (s *NATSSink) Publish(ctx context.Context, event ChangeEvent) error {
+	batch, err := eventBatch(event)
+	if err != nil {
+		return err
+	}
+	return s.Write(ctx, batch)
+}
+
+// Write sends the records of a batch; it implements Sink. Deduplication
+// compares against the previous batch of the same endpoint.
+func (s *NATSSink) Write(ctx context.Context, batch Batch) error {
+	subject := s.Subject(batch.Endpoint)
+	current := make(map[string]struct{}, len(batch.Records))
+	s.mu.Lock()
+	previous, ok := s.seen[batch.Endpoint]
+	s.mu.Unlock()
+	if !ok && s.dedup {
+		previous = s.loadSeen(ctx, batch.Endpoint)
+	}
+
+	for _, record := range batch.Records {
+		sum := sha256.Sum256(record)
+		hash := hex.EncodeToString(sum[:])
+		current[hash] = struct{}{}
+		if _, ok := previous[hash]; ok && s.dedup {
+			continue
+		}
+		msgID := batch.Endpoint + "@" + batch.Time.UTC().Format(time.RFC3339Nano) + ":" + hash
+		if err := s.client.Publish(ctx, subject, record, msgID); err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", subject, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.seen[batch.Endpoint] = current
+	s.mu.Unlock()
+	if s.dedup {
+		s.saveSeen(ctx, batch.Endpoint, current)
+	}
+	return nil
+}
+
+// Flush implements Sink. Messages are published by Write, so there is nothing to flush.
+func (s *NATSSink) Flush(ctx context.Context) error { return nil }
+
+// Close implements Sink. It does not close the client.
+func (s *NATSSink) Close() error { return nil }
+
+// PublishSnapshot sends a whole snapshot as one message to the subject of its
+// name with ".snapshot" appended, using name and version as message ID.
+func (s *NATSSink) PublishSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	subject := s.Subject(snapshot.Name) + ".snapshot"
+	msgID := fmt.Sprintf("%s@%d", snapshot.Name, snapshot.Version)
+	if err := s.client.Publish(ctx, subject, data, msgID); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// Run publishes every event from the watcher until ctx is done. Failures are
+// logged and do not stop the sink.
+func (s *NATSSink) Run(ctx context.Context, watcher *Watcher) error {
+	return watcher.RunSink(ctx, s)
+}
@@ -0,0 +1,210 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is one stored version of a dataset.
+type Snapshot struct {
+	Name      string            `json:"name"`
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"created_at"`
+	Source    string            `json:"source,omitempty"`
+	Records   []json.RawMessage `json:"records"`
+}
+
+// SnapshotStore keeps successive versions of datasets as JSON files under a
+// directory, one subdirectory per dataset name: <dir>/<name>/v000001.json.
+type SnapshotStore struct {
+	dir   string
+	clock Clock
+}
+
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{dir: dir, clock: systemClock{}}
+}
+
+// Save stores records as the next version of the named dataset.
+func (s *SnapshotStore) Save(name, source string, records []json.RawMessage) (*Snapshot, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	versions, err := s.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	}
+
+	snapshot := &Snapshot{
+		Name:      name,
+		Version:   next,
+		CreatedAt: s.clock.Now(),
+		Source:    source,
+		Records:   records,
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, name), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := os.WriteFile(s.path(name, next), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// Versions lists the stored versions of the named dataset in ascending order.
+func (s *SnapshotStore) Versions(name string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var versions []int
+	for _, entry := range entries {
+		var version int
+		if _, err := fmt.Sscanf(entry.Name(), "v%06d.json", &version); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// Load reads a stored version of the named dataset. Version 0 loads the latest.
+func (s *SnapshotStore) Load(name string, version int) (*Snapshot, error) {
+	if version == 0 {
+		versions, err := s.Versions(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("no snapshots of %s", name)
+		}
+		version = versions[len(versions)-1]
+	}
+	return LoadSnapshotFile(s.path(name, version))
+}
+
+func (s *SnapshotStore) path(name string, version int) string {
+	return filepath.Join(s.dir, name, fmt.Sprintf("v%06d.json", version))
+}
+
+// LoadSnapshotFile reads a snapshot file. A plain JSON array or TDX response
+// body is accepted as well and loaded as an unversioned snapshot.
+func LoadSnapshotFile(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err == nil && snapshot.Records != nil {
+		return &snapshot, nil
+	}
+	records, err := DecodeRecords(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return &Snapshot{Name: filepath.Base(path), Records: records}, nil
+}
+
+// ChangedRecord is a record present in both snapshots with different content.
+type ChangedRecord struct {
+	Key string          `json:"key"`
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// SnapshotDiff lists how records changed between two snapshots.
+type SnapshotDiff struct {
+	Added   []json.RawMessage `json:"added"`
+	Removed []json.RawMessage `json:"removed"`
+	Changed []ChangedRecord   `json:"changed"`
+}
+
+// DiffRecords compares two record sets, matching records by the top-level key
+// field (e.g. "StopUID"). Content is compared after normalizing JSON, so field
+// order and whitespace do not count as changes. Results are ordered by key.
+func DiffRecords(before, after []json.RawMessage, key string) (*SnapshotDiff, error) {
+	oldByKey, err := indexRecords(before, key)
+	if err != nil {
+		return nil, fmt.Errorf("old snapshot: %w", err)
+	}
+	newByKey, err := indexRecords(after, key)
+	if err != nil {
+		return nil, fmt.Errorf("new snapshot: %w", err)
+	}
+
+	diff := &SnapshotDiff{}
+	for _, k := range sortedKeys(newByKey) {
+		newRecord := newByKey[k]
+		oldRecord, ok := oldByKey[k]
+		if !ok {
+			diff.Added = append(diff.Added, newRecord.raw)
+			continue
+		}
+		if !bytes.Equal(oldRecord.normalized, newRecord.normalized) {
+			diff.Changed = append(diff.Changed, ChangedRecord{Key: k, Old: oldRecord.raw, New: newRecord.raw})
+		}
+	}
+	for _, k := range sortedKeys(oldByKey) {
+		if _, ok := newByKey[k]; !ok {
+			diff.Removed = append(diff.Removed, oldByKey[k].raw)
+		}
+	}
+	return diff, nil
+}
+
+type indexedRecord struct {
+	raw        json.RawMessage
+	normalized []byte
+}
+
+func indexRecords(records []json.RawMessage, key string) (map[string]indexedRecord, error) {
+	index := make(map[string]indexedRecord, len(records))
+	for i, record := range records {
+		var fields map[string]any
+		if err := json.Unmarshal(record, &fields); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		value, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("record %d has no %s field", i, key)
+		}
+		k := fmt.Sprint(value)
+		if _, dup := index[k]; dup {
+			return nil, fmt.Errorf("duplicate %s %q", key, k)
+		}
+		// Marshaling a map sorts its keys, which normalizes field order.
+		normalized, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		index[k] = indexedRecord{raw: record, normalized: normalized}
+	}
+	return index, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
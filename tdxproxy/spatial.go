@@ -0,0 +1,88 @@
+package tdxproxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Nearby builds a $spatialFilter value selecting records within meters of the
+// given coordinate, escaped with EscapeParam.
+func Nearby(lat, lon float64, meters int) (string, error) {
+	if err := checkCoordinate(lat, lon); err != nil {
+		return "", err
+	}
+	if meters <= 0 {
+		return "", fmt.Errorf("invalid distance %d", meters)
+	}
+	return EscapeParam(fmt.Sprintf("nearby(%s, %s, %d)", formatDegrees(lat), formatDegrees(lon), meters)), nil
+}
+
+// BoundingBox is a map viewport given by its south-west and north-east corners.
+// When West is greater than East the box crosses the antimeridian.
+type BoundingBox struct {
+	South, West float64
+	North, East float64
+}
+
+// NewBoundingBox builds a box from its south-west and north-east corners, as
+// reported by most map libraries for the visible viewport.
+func NewBoundingBox(southWestLat, southWestLon, northEastLat, northEastLon float64) (BoundingBox, error) {
+	if err := checkCoordinate(southWestLat, southWestLon); err != nil {
+		return BoundingBox{}, err
+	}
+	if err := checkCoordinate(northEastLat, northEastLon); err != nil {
+		return BoundingBox{}, err
+	}
+	if southWestLat > northEastLat {
+		return BoundingBox{}, errors.New("south-west corner is north of the north-east corner")
+	}
+	return BoundingBox{South: southWestLat, West: southWestLon, North: northEastLat, East: northEastLon}, nil
+}
+
+// CrossesAntimeridian reports whether the box wraps around longitude ±180.
+func (b BoundingBox) CrossesAntimeridian() bool {
+	return b.West > b.East
+}
+
+// Contains reports whether a coordinate lies in the box, edges included.
+func (b BoundingBox) Contains(lat, lon float64) bool {
+	if lat < b.South || lat > b.North {
+		return false
+	}
+	if b.CrossesAntimeridian() {
+		return lon >= b.West || lon <= b.East
+	}
+	return lon >= b.West && lon <= b.East
+}
+
+// Filter builds a $filter value selecting records whose position lies in the
+// box, escaped with EscapeParam. position is the record's position object,
+// such as "StopPosition" or "BusPosition", holding PositionLat and
+// PositionLon fields.
+func (b BoundingBox) Filter(position string) string {
+	latField, lonField := position+"/PositionLat", position+"/PositionLon"
+	lat := fmt.Sprintf("%s ge %s and %s le %s", latField, formatDegrees(b.South), latField, formatDegrees(b.North))
+	var lon string
+	if b.CrossesAntimeridian() {
+		lon = fmt.Sprintf("(%s ge %s or %s le %s)", lonField, formatDegrees(b.West), lonField, formatDegrees(b.East))
+	} else {
+		lon = fmt.Sprintf("%s ge %s and %s le %s", lonField, formatDegrees(b.West), lonField, formatDegrees(b.East))
+	}
+	return EscapeParam(lat + " and " + lon)
+}
+
+func checkCoordinate(lat, lon float64) error {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return fmt.Errorf("invalid latitude %v", lat)
+	}
+	if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return fmt.Errorf("invalid longitude %v", lon)
+	}
+	return nil
+}
+
+func formatDegrees(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,68 @@
+package tdxproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// StateStore persists the state of a Watcher or Syncer, such as ETags, content
+// hashes and update times, so that a restarted process resumes where it left
+// off instead of sending every record again as new. State is saved under a
+// key as an opaque blob; watchers save one per endpoint, holding its latest
+// content, and rewrite it only when the endpoint changes. Implementations wrap
+// a file system, Redis or an SQL table, and must be safe for concurrent use.
+type StateStore interface {
+	// LoadState returns the state saved under key, or nil if there is none.
+	LoadState(ctx context.Context, key string) ([]byte, error)
+	SaveState(ctx context.Context, key string, data []byte) error
+}
+
+// FileStateStore keeps each state in a file of a directory, replaced
+// atomically on every save.
+type FileStateStore struct {
+	dir string
+}
+
+// NewFileStateStore creates a store in dir, creating the directory if needed.
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return &FileStateStore{dir: dir}, nil
+}
+
+func (s *FileStateStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+func (s *FileStateStore) LoadState(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (s *FileStateStore) SaveState(ctx context.Context, key string, data []byte) error {
+	tmp, err := os.CreateTemp(s.dir, ".state-*")
+	if err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path(key)); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package tdxproxy
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are cumulative counters of a proxy since it was created.
+type Stats struct {
+	// Requests counts calls that went to the network, including failed ones.
+	Requests int64
+	// CacheHits counts calls answered from the cache.
+	CacheHits int64
+	// Attempts counts HTTP requests sent, so Attempts - Requests were retries.
+	Attempts int64
+	// Errors counts network requests that returned an error.
+	Errors int64
+	// TokenRefreshes counts successful auth token fetches.
+	TokenRefreshes int64
+	// TokenExpiry is when the current auth token is replaced; zero if the
+	// proxy has none yet or uses a CredentialPool.
+	TokenExpiry time.Time
+	// Credentials is the health of each credential of a CredentialPool, if any.
+	Credentials []CredentialHealth
+}
+
+type proxyStats struct {
+	requests       atomic.Int64
+	cacheHits      atomic.Int64
+	attempts       atomic.Int64
+	errors         atomic.Int64
+	tokenRefreshes atomic.Int64
+}
+
+// Stats returns a copy of the proxy's request counters.
+func (proxy *TDXProxy) Stats() Stats {
+	var credentials []CredentialHealth
+	var tokenExpiry time.Time
+	settings := proxy.settings()
+	switch {
+	case settings.auth != nil:
+		if provider, ok := settings.auth.(interface{ Expiry() time.Time }); ok {
+			tokenExpiry = provider.Expiry()
+		}
+	case settings.credentials != nil:
+		credentials = settings.credentials.Health()
+	default:
+		proxy.tokenMu.Lock()
+		if proxy.authToken != "" {
+			tokenExpiry = time.Unix(proxy.expiredTime, 0)
+		}
+		proxy.tokenMu.Unlock()
+	}
+	return Stats{
+		Requests:       proxy.stats.requests.Load(),
+		CacheHits:      proxy.stats.cacheHits.Load(),
+		Attempts:       proxy.stats.attempts.Load(),
+		Errors:         proxy.stats.errors.Load(),
+		TokenRefreshes: proxy.stats.tokenRefreshes.Load(),
+		TokenExpiry:    tokenExpiry,
+		Credentials:    credentials,
+	}
+}
+
+func (s *proxyStats) recordRequest(info *RequestInfo) {
+	s.requests.Add(1)
+	s.attempts.Add(int64(info.Attempts))
+	if info.Err != nil {
+		s.errors.Add(1)
+	}
+}
@@ -0,0 +1,167 @@
+package tdxproxy
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// earthRadius is the mean Earth radius in meters.
+const earthRadius = 6371008.8
+
+// Stop is a located stop or station.
+type Stop struct {
+	UID    string
+	Name   Name
+	Lat    float64
+	Lon    float64
+	Record json.RawMessage
+}
+
+// NearbyStop is a result of StopIndex.NearestStops.
+type NearbyStop struct {
+	Stop
+	// Distance is the great-circle distance in meters.
+	Distance float64
+}
+
+// StopsFromRecords extracts stops from TDX stop or station records, which
+// carry StopUID/StopName/StopPosition or StationUID/StationName/StationPosition.
+// Records without a position are skipped.
+func StopsFromRecords(records []json.RawMessage) ([]Stop, error) {
+	type position struct {
+		PositionLat *float64
+		PositionLon *float64
+	}
+	stops := make([]Stop, 0, len(records))
+	for i, record := range records {
+		var fields struct {
+			StopUID         string
+			StopName        Name
+			StopPosition    position
+			StationUID      string
+			StationName     Name
+			StationPosition position
+		}
+		if err := decodeRecord(i, record, &fields); err != nil {
+			return nil, err
+		}
+		stop := Stop{UID: fields.StopUID, Name: fields.StopName, Record: record}
+		pos := fields.StopPosition
+		if stop.UID == "" {
+			stop.UID, stop.Name, pos = fields.StationUID, fields.StationName, fields.StationPosition
+		}
+		if pos.PositionLat == nil || pos.PositionLon == nil {
+			continue
+		}
+		stop.Lat, stop.Lon = *pos.PositionLat, *pos.PositionLon
+		stops = append(stops, stop)
+	}
+	return stops, nil
+}
+
+// StopIndex is an in-memory k-d tree over stop locations answering nearest
+// stop queries without a TDX request. Locations are indexed as points on the
+// unit sphere, so distances stay correct at any latitude. It is immutable and
+// safe for concurrent use; rebuild it when the stop data changes.
+type StopIndex struct {
+	nodes []stopNode
+}
+
+type stopNode struct {
+	stop  Stop
+	point [3]float64
+	left  int
+	right int
+}
+
+func NewStopIndex(stops []Stop) *StopIndex {
+	index := &StopIndex{nodes: make([]stopNode, 0, len(stops))}
+	items := make([]stopNode, len(stops))
+	for i, stop := range stops {
+		items[i] = stopNode{stop: stop, point: unitVector(stop.Lat, stop.Lon), left: -1, right: -1}
+	}
+	index.build(items, 0)
+	return index
+}
+
+// Len returns the number of indexed stops.
+func (idx *StopIndex) Len() int {
+	return len(idx.nodes)
+}
+
+// build appends the subtree of items to nodes and returns the index of its root.
+func (idx *StopIndex) build(items []stopNode, depth int) int {
+	if len(items) == 0 {
+		return -1
+	}
+	axis := depth % 3
+	sort.Slice(items, func(i, j int) bool { return items[i].point[axis] < items[j].point[axis] })
+	median := len(items) / 2
+	root := len(idx.nodes)
+	idx.nodes = append(idx.nodes, items[median])
+	left := idx.build(items[:median], depth+1)
+	right := idx.build(items[median+1:], depth+1)
+	idx.nodes[root].left, idx.nodes[root].right = left, right
+	return root
+}
+
+// NearestStops returns up to k stops closest to the coordinate, nearest first.
+func (idx *StopIndex) NearestStops(lat, lon float64, k int) []NearbyStop {
+	if k <= 0 || len(idx.nodes) == 0 {
+		return nil
+	}
+	target := unitVector(lat, lon)
+	var best []nearestCandidate
+	idx.search(0, 0, target, k, &best)
+
+	result := make([]NearbyStop, len(best))
+	for i, c := range best {
+		// Convert the chord length between unit vectors to an arc length.
+		distance := 2 * math.Asin(math.Min(1, math.Sqrt(c.dist2)/2)) * earthRadius
+		result[i] = NearbyStop{Stop: idx.nodes[c.node].stop, Distance: distance}
+	}
+	return result
+}
+
+type nearestCandidate struct {
+	node  int
+	dist2 float64
+}
+
+func (idx *StopIndex) search(node, depth int, target [3]float64, k int, best *[]nearestCandidate) {
+	if node < 0 {
+		return
+	}
+	n := &idx.nodes[node]
+	var dist2 float64
+	for i := range target {
+		d := n.point[i] - target[i]
+		dist2 += d * d
+	}
+	if len(*best) < k || dist2 < (*best)[len(*best)-1].dist2 {
+		at := sort.Search(len(*best), func(i int) bool { return (*best)[i].dist2 > dist2 })
+		*best = append(*best, nearestCandidate{})
+		copy((*best)[at+1:], (*best)[at:])
+		(*best)[at] = nearestCandidate{node: node, dist2: dist2}
+		if len(*best) > k {
+			*best = (*best)[:k]
+		}
+	}
+
+	axis := depth % 3
+	diff := target[axis] - n.point[axis]
+	near, far := n.left, n.right
+	if diff > 0 {
+		near, far = n.right, n.left
+	}
+	idx.search(near, depth+1, target, k, best)
+	if len(*best) < k || diff*diff < (*best)[len(*best)-1].dist2 {
+		idx.search(far, depth+1, target, k, best)
+	}
+}
+
+func unitVector(lat, lon float64) [3]float64 {
+	phi, lambda := lat*math.Pi/180, lon*math.Pi/180
+	return [3]float64{math.Cos(phi) * math.Cos(lambda), math.Cos(phi) * math.Sin(lambda), math.Sin(phi)}
+}
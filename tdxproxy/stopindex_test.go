@@ -0,0 +1,93 @@
+package tdxproxy
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// testdata/stops.json holds stop and station records around Taipei and one
+// in Kaohsiung, in the shapes TDX returns them.
+func fixtureStops(t *testing.T) []Stop {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "stops.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatal(err)
+	}
+	stops, err := StopsFromRecords(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stops
+}
+
+func TestStopsFromRecords(t *testing.T) {
+	stops := fixtureStops(t)
+	names := map[string]string{}
+	for _, s := range stops {
+		names[s.UID] = s.Name.En
+	}
+	want := map[string]string{
+		"TPE10001": "Taipei Main Station",
+		"TPE10002": "MRT Ximen Sta.",
+		"TPE10003": "MRT Zhongshan Sta.",
+		"TPE10004": "Taipei 101",
+		"TRA-1020": "Banqiao",
+		"TRA-4220": "Kaohsiung",
+	}
+	if len(stops) != len(want) {
+		t.Errorf("got %d stops, want %d without the one lacking a position", len(stops), len(want))
+	}
+	for uid, name := range want {
+		if names[uid] != name {
+			t.Errorf("stop %s named %q, want %q", uid, names[uid], name)
+		}
+	}
+}
+
+func TestNearestStops(t *testing.T) {
+	stops := fixtureStops(t)
+	index := NewStopIndex(stops)
+	if index.Len() != len(stops) {
+		t.Fatalf("indexed %d stops, want %d", index.Len(), len(stops))
+	}
+
+	tests := []struct {
+		name     string
+		lat, lon float64
+		k        int
+		want     []string
+	}{
+		{"at a stop", 25.0478, 121.517, 3, []string{"TPE10001", "TPE10003", "TPE10002"}},
+		{"between stops", 25.045, 121.512, 2, []string{"TPE10002", "TPE10001"}},
+		{"far south", 22.6, 120.3, 1, []string{"TRA-4220"}},
+		{"more than indexed", 25.0336, 121.5648, 10, []string{"TPE10004", "TPE10003", "TPE10001", "TPE10002", "TRA-1020", "TRA-4220"}},
+		{"none", 25.0478, 121.517, 0, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := index.NearestStops(tc.lat, tc.lon, tc.k)
+			var uids []string
+			for _, s := range got {
+				uids = append(uids, s.UID)
+				if want := haversine(tc.lat, tc.lon, s.Lat, s.Lon); math.Abs(s.Distance-want) > 0.01 {
+					t.Errorf("%s at %.2fm, want %.2fm", s.UID, s.Distance, want)
+				}
+			}
+			if !slices.Equal(uids, tc.want) {
+				t.Errorf("got %v, want %v", uids, tc.want)
+			}
+			if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].Distance < got[j].Distance }) {
+				t.Errorf("not nearest first: %v", uids)
+			}
+		})
+	}
+}
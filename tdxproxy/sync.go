@@ -0,0 +1,242 @@
+package tdxproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Syncer fetches only records that changed since the previous fetch of the same
+// endpoint, by remembering the newest UpdateTime it has seen and adding
+// "$filter=UpdateTime ge <last>" to later requests. Records updated at exactly
+// that time are fetched again, since more may have arrived with the same time,
+// and those already returned are dropped.
+type Syncer struct {
+	proxy *TDXProxy
+	field string
+	mu    sync.Mutex
+	last  map[string]time.Time
+	// boundary holds the hashes of the records returned for each endpoint
+	// whose update time equals its last update time.
+	boundary map[string]map[[sha256.Size]byte]struct{}
+
+	store    StateStore
+	stateKey string
+	loaded   bool
+}
+
+// NewSyncer creates a Syncer tracking the UpdateTime field.
+func NewSyncer(proxy *TDXProxy) *Syncer {
+	return &Syncer{
+		proxy:    proxy,
+		field:    "UpdateTime",
+		last:     make(map[string]time.Time),
+		boundary: make(map[string]map[[sha256.Size]byte]struct{}),
+	}
+}
+
+// SetField changes the record field used to detect changes, e.g. "SrcUpdateTime".
+func (s *Syncer) SetField(field string) {
+	if field == "" {
+		s.proxy.logger.Warn("Empty sync field provided")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.field = field
+}
+
+// SetStateStore makes the syncer load its update times from store under key
+// on the next Fetch, and save them there whenever they advance, so that a
+// restarted process fetches only records changed since it stopped.
+func (s *Syncer) SetStateStore(store StateStore, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store, s.stateKey, s.loaded = store, key, false
+}
+
+// loadState merges the update times saved in the state store, once. A state
+// that fails to load is logged and the syncer starts afresh, fetching every
+// record once, rather than failing every Fetch.
+func (s *Syncer) loadState(ctx context.Context) {
+	s.mu.Lock()
+	store, key := s.store, s.stateKey
+	done := store == nil || s.loaded
+	s.mu.Unlock()
+	if done {
+		return
+	}
+	data, err := store.LoadState(ctx, key)
+	var state map[string]time.Time
+	if err == nil && data != nil {
+		err = json.Unmarshal(data, &state)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		s.proxy.log(ctx, slog.LevelWarn, "Failed to load sync state", slog.String("error", err.Error()))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range state {
+		if v.After(s.last[k]) {
+			s.last[k] = v
+			delete(s.boundary, k)
+		}
+	}
+	s.loaded = true
+}
+
+// saveState writes the update times to the state store. Failures are only
+// logged, as the records were fetched; the next save catches up.
+func (s *Syncer) saveState(ctx context.Context) {
+	s.mu.Lock()
+	store, key := s.store, s.stateKey
+	s.mu.Unlock()
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(s.State())
+	if err == nil {
+		err = store.SaveState(ctx, key, data)
+	}
+	if err != nil {
+		s.proxy.log(ctx, slog.LevelWarn, "Failed to save sync state", slog.String("error", err.Error()))
+	}
+}
+
+// Fetch requests url and returns the records updated since the last Fetch of the
+// same url and params. The first Fetch of an endpoint returns everything.
+// An existing $filter in params is combined with the update-time condition.
+func (s *Syncer) Fetch(ctx context.Context, url string, params map[string]string) ([]json.RawMessage, error) {
+	s.loadState(ctx)
+	key := s.proxy.cacheKey(url, params)
+	s.mu.Lock()
+	field := s.field
+	last, seen := s.last[key]
+	returned := s.boundary[key]
+	s.mu.Unlock()
+
+	query := make(map[string]string, len(params)+2)
+	for k, v := range params {
+		query[k] = v
+	}
+	if _, ok := query["$format"]; !ok {
+		query["$format"] = "JSON"
+	}
+	if seen {
+		query["$filter"] = updateFilter(field, last, params["$filter"])
+	}
+
+	body, err := s.proxy.fetchBody(ctx, url, query)
+	if err != nil {
+		return nil, err
+	}
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+
+	newest := last
+	times := make([]time.Time, len(records))
+	for i, record := range records {
+		if t, ok := recordTime(record, field); ok {
+			times[i] = t
+			if t.After(newest) {
+				newest = t
+			}
+		}
+	}
+	fresh := make([]json.RawMessage, 0, len(records))
+	boundary := make(map[[sha256.Size]byte]struct{})
+	for i, record := range records {
+		if !times[i].Equal(newest) && !times[i].Equal(last) {
+			fresh = append(fresh, record)
+			continue
+		}
+		sum := sha256.Sum256(record)
+		if times[i].Equal(newest) {
+			boundary[sum] = struct{}{}
+		}
+		if _, ok := returned[sum]; ok && seen && times[i].Equal(last) {
+			continue
+		}
+		fresh = append(fresh, record)
+	}
+
+	s.mu.Lock()
+	current := s.last[key]
+	advanced := newest.After(current)
+	switch {
+	case advanced:
+		s.last[key], s.boundary[key] = newest, boundary
+	case newest.Equal(current) && !newest.IsZero():
+		if s.boundary[key] == nil {
+			s.boundary[key] = boundary
+		}
+		for sum := range boundary {
+			s.boundary[key][sum] = struct{}{}
+		}
+	}
+	s.mu.Unlock()
+	if advanced {
+		s.saveState(ctx)
+	}
+	return fresh, nil
+}
+
+// State returns the last seen update time per endpoint, for persisting across restarts.
+func (s *Syncer) State() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := make(map[string]time.Time, len(s.last))
+	for k, v := range s.last {
+		state[k] = v
+	}
+	return state
+}
+
+// Restore replaces the tracked update times with state, as returned by State.
+// The next Fetch of each endpoint returns the records updated at exactly its
+// restored time again, as the state does not say which were returned.
+func (s *Syncer) Restore(state map[string]time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.boundary = make(map[string]map[[sha256.Size]byte]struct{})
+	s.last = make(map[string]time.Time, len(state))
+	for k, v := range state {
+		s.last[k] = v
+	}
+}
+
+// updateFilter builds the OData condition selecting records updated at or
+// after last, combined with an existing filter, which is kept as given.
+func updateFilter(field string, last time.Time, existing string) string {
+	condition := EscapeParam(fmt.Sprintf("%s ge %s", field, last.Format(time.RFC3339)))
+	if existing == "" {
+		return condition
+	}
+	return EscapeParam("(") + existing + EscapeParam(") and ") + condition
+}
+
+// recordTime reads a top-level timestamp field of a record.
+func recordTime(record json.RawMessage, field string) (time.Time, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return time.Time{}, false
+	}
+	var value string
+	if err := json.Unmarshal(fields[field], &value); err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -2,45 +2,141 @@ package tdxproxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	TDX_URL_BASIC = "https://tdx.transportdata.tw/api/basic/"
-	authURL       = "https://tdx.transportdata.tw/auth/realms/TDXConnect/protocol/openid-connect/token"
+	TDX_URL_BASIC      = "https://tdx.transportdata.tw/api/basic/"
+	TDX_URL_HISTORICAL = "https://tdx.transportdata.tw/api/historical/"
+	authURL            = "https://tdx.transportdata.tw/auth/realms/TDXConnect/protocol/openid-connect/token"
+
+	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.122 Safari/537.36"
 )
 
 // TDXProxy simplifies the interface process with the TDX platform.
 // You can directly call the TDX platform's API as long as
 // the Client ID and Secret Key are provided.
 type TDXProxy struct {
+	logger *slog.Logger
+	clock  Clock
+
+	// tokenMu guards the single credential and its token. It is held while
+	// a token is fetched, so requests finding it expired share one refresh.
+	tokenMu     sync.Mutex
 	appID       string
 	appKey      string
 	authToken   string
-	baseUrl     string
 	expiredTime int64
-	logger      *slog.Logger
+
+	// mu guards the settings below, which setters may change while requests
+	// are in flight. Requests read them through settings.
+	mu          sync.RWMutex
+	baseUrl     string
+	credentials *CredentialPool
+	auth        AuthProvider
+	tokenForm   TokenRequest
+	cache       Cache
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+	transport   http.RoundTripper
+	retryPolicy RetryPolicy
+	authRetry   RetryPolicy
+	limiter     RateLimiter
+	inflight    chan struct{}
+	ptxCompat   bool
+	maxBodySize int64
+	accept      string
+	forceJSON   bool
+	charsets    CharsetDecoder
+	dryRun      io.Writer
+	debug       *DebugBuffer
+	objects     *objectCache
+
+	infoMu   sync.Mutex
+	lastInfo *RequestInfo
+	stats    proxyStats
+}
+
+// proxySettings is a copy of the settings guarded by TDXProxy.mu.
+type proxySettings struct {
+	baseURL     string
+	credentials *CredentialPool
+	auth        AuthProvider
+	tokenForm   TokenRequest
+	cache       Cache
+	cacheTTL    time.Duration
+	negativeTTL time.Duration
+	transport   http.RoundTripper
+	retryPolicy RetryPolicy
+	authRetry   RetryPolicy
+	limiter     RateLimiter
+	inflight    chan struct{}
+	ptxCompat   bool
+	maxBodySize int64
+	accept      string
+	forceJSON   bool
+	charsets    CharsetDecoder
+	dryRun      io.Writer
+	debug       *DebugBuffer
+	objects     *objectCache
+}
+
+// settings returns the current settings. A request reads them once where it
+// needs several, so a concurrent setter applies to it entirely or not at all.
+func (proxy *TDXProxy) settings() proxySettings {
+	proxy.mu.RLock()
+	defer proxy.mu.RUnlock()
+	return proxySettings{
+		baseURL:     proxy.baseUrl,
+		credentials: proxy.credentials,
+		auth:        proxy.auth,
+		tokenForm:   proxy.tokenForm,
+		cache:       proxy.cache,
+		cacheTTL:    proxy.cacheTTL,
+		negativeTTL: proxy.negativeTTL,
+		transport:   proxy.transport,
+		retryPolicy: proxy.retryPolicy,
+		authRetry:   proxy.authRetry,
+		limiter:     proxy.limiter,
+		inflight:    proxy.inflight,
+		ptxCompat:   proxy.ptxCompat,
+		maxBodySize: proxy.maxBodySize,
+		accept:      proxy.accept,
+		forceJSON:   proxy.forceJSON,
+		charsets:    proxy.charsets,
+		dryRun:      proxy.dryRun,
+		debug:       proxy.debug,
+		objects:     proxy.objects,
+	}
 }
 
 func NewTDXProxy(appID, appKey string, logger *slog.Logger) *TDXProxy {
 	if logger == nil {
 		logger = slog.Default()
 	}
+	clock := systemClock{}
 	return &TDXProxy{
 		appID:       appID,
 		appKey:      appKey,
 		baseUrl:     TDX_URL_BASIC,
 		authToken:   "",
-		expiredTime: time.Now().Unix(),
+		expiredTime: clock.Now().Unix(),
 		logger:      logger,
+		clock:       clock,
+		retryPolicy: defaultRetryPolicy(),
+		authRetry:   defaultAuthRetryPolicy(),
 	}
 }
 
@@ -52,6 +148,7 @@ func NewTDXProxy(appID, appKey string, logger *slog.Logger) *TDXProxy {
 //	  "app_key": "app_key"
 //	}
 //
+// A JSON array of such objects creates a proxy with a CredentialPool instead.
 // The file path can be specified as the first argument, or the TDX_CREDENTIALS_FILE environment variable.
 func NewTDXProxyFromCredentialFile(fileName string, logger *slog.Logger) (*TDXProxy, error) {
 	if fileName == "" {
@@ -61,21 +158,77 @@ func NewTDXProxyFromCredentialFile(fileName string, logger *slog.Logger) (*TDXPr
 		return nil, errors.New("no credential file specified and TDX_CREDENTIALS_FILE environment variable is not set")
 	}
 
-	file, err := os.Open(fileName)
+	credentials, err := LoadCredentials(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(credentials) > 1 {
+		return NewTDXProxyWithCredentialPool(NewCredentialPool(credentials, logger), logger), nil
+	}
+	return NewTDXProxy(credentials[0].AppID, credentials[0].AppKey, logger), nil
+}
+
+// LoadCredentials reads a credential file in the format described at
+// NewTDXProxyFromCredentialFile, returning one credential for a single object.
+func LoadCredentials(fileName string) ([]Credential, error) {
+	data, err := os.ReadFile(fileName)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return ParseCredentials(data)
+}
 
-	credentials := struct {
-		AppID  string `json:"app_id"`
-		AppKey string `json:"app_key"`
-	}{}
-	if err := json.NewDecoder(file).Decode(&credentials); err != nil {
+// ParseCredentials parses the contents of a credential file, see LoadCredentials.
+func ParseCredentials(data []byte) ([]Credential, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var credentials []Credential
+		if err := json.Unmarshal(trimmed, &credentials); err != nil {
+			return nil, err
+		}
+		if len(credentials) == 0 {
+			return nil, errors.New("credential file contains no credentials")
+		}
+		return credentials, nil
+	}
+	var credential Credential
+	if err := json.Unmarshal(data, &credential); err != nil {
 		return nil, err
 	}
+	return []Credential{credential}, nil
+}
+
+// SetCredentials replaces the proxy's credentials, dropping its current token.
+// One credential is used directly, several through a new CredentialPool, and
+// none turns authentication off.
+func (proxy *TDXProxy) SetCredentials(credentials ...Credential) {
+	var appID, appKey string
+	var pool *CredentialPool
+	switch len(credentials) {
+	case 0:
+	case 1:
+		appID, appKey = credentials[0].AppID, credentials[0].AppKey
+	default:
+		pool = NewCredentialPool(credentials, proxy.logger)
+		pool.setClock(proxy.clock)
+	}
 
-	return NewTDXProxy(credentials.AppID, credentials.AppKey, logger), nil
+	// The locks are taken in turn: a token fetch holds tokenMu and reads settings.
+	proxy.tokenMu.Lock()
+	proxy.authToken = ""
+	proxy.appID, proxy.appKey = appID, appKey
+	proxy.tokenMu.Unlock()
+	proxy.mu.Lock()
+	proxy.credentials = pool
+	proxy.mu.Unlock()
+}
+
+// NewTDXProxyWithCredentialPool creates a proxy that authenticates with the
+// credentials of pool in turn, see CredentialPool.
+func NewTDXProxyWithCredentialPool(pool *CredentialPool, logger *slog.Logger) *TDXProxy {
+	proxy := NewTDXProxyNoAuth(logger)
+	pool.setClock(proxy.clock)
+	proxy.credentials = pool
+	return proxy
 }
 
 func NewTDXProxyNoAuth(logger *slog.Logger) *TDXProxy {
@@ -83,18 +236,107 @@ func NewTDXProxyNoAuth(logger *slog.Logger) *TDXProxy {
 		logger = slog.Default()
 	}
 	return &TDXProxy{
-		appID:   "",
-		appKey:  "",
-		baseUrl: TDX_URL_BASIC,
-		logger:  logger,
+		appID:       "",
+		appKey:      "",
+		baseUrl:     TDX_URL_BASIC,
+		logger:      logger,
+		clock:       systemClock{},
+		retryPolicy: defaultRetryPolicy(),
+		authRetry:   defaultAuthRetryPolicy(),
 	}
 }
 
-func (proxy *TDXProxy) Get(url string, params map[string]string, headers map[string]string, timeout time.Duration) (*http.Response, error) {
+// Get sends a GET request to the given TDX path. Options can be passed to
+// control caching and other behavior for this call only.
+func (proxy *TDXProxy) Get(url string, params map[string]string, headers map[string]string, timeout time.Duration, opts ...RequestOption) (*http.Response, error) {
+	return proxy.GetContext(context.Background(), url, params, headers, timeout, opts...)
+}
+
+// GetContext is like Get but carries a context, which cancels the request and
+// supplies the log attributes attached with WithLogAttrs.
+func (proxy *TDXProxy) GetContext(ctx context.Context, url string, params map[string]string, headers map[string]string, timeout time.Duration, opts ...RequestOption) (*http.Response, error) {
+	url, params, headers = proxy.rewritePTXRequest(url, params, headers)
 	if params == nil {
 		params = map[string]string{"$format": "JSON"}
+	} else if _, ok := params["$format"]; !ok && proxy.settings().forceJSON {
+		params = maps.Clone(params)
+		params["$format"] = "JSON"
+	}
+	options := newRequestOptions(opts)
+	if proxy.settings().cache == nil || proxy.dryRunWriter(options) != nil {
+		if options.onlyIfCached {
+			return nil, ErrNotCached
+		}
+		return proxy.requestWithRetry(ctx, url, params, headers, timeout, options)
 	}
-	return proxy.requestWithRetry(url, params, headers, timeout, 0)
+
+	key := proxy.cacheKey(url, params)
+	if accept := proxy.requestAccept(headers, options); accept != "" {
+		// The fragment is dropped from request URLs, so it cannot clash
+		// with the key of another request.
+		key += "#Accept=" + accept
+	}
+	if !options.noCache {
+		if resp, ok := proxy.cachedResponse(key, options.maxAge); ok {
+			proxy.log(ctx, slog.LevelDebug, "Cache hit", slog.String("url", url))
+			proxy.setLastRequestInfo(ctx, &RequestInfo{URL: url, Time: proxy.clock.Now(), StatusCode: resp.StatusCode, FromCache: true})
+			proxy.stats.cacheHits.Add(1)
+			if resp.StatusCode == http.StatusNotFound {
+				return nil, newStatusError(url, resp, proxy.clock.Now())
+			}
+			return resp, nil
+		}
+	}
+	if options.onlyIfCached {
+		return nil, ErrNotCached
+	}
+	resp, err := proxy.requestWithRetry(ctx, url, params, headers, timeout, options)
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !options.noStore {
+			proxy.storeNegative(key, statusErr)
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK && !options.noStore {
+		if err := proxy.storeResponse(key, resp); err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// PostContext sends a POST request with body to the given TDX path. Unlike
+// GetContext it never uses the cache and adds no default parameters. The retry
+// policy applies as for GET; pass NoRetry for requests that must not repeat.
+func (proxy *TDXProxy) PostContext(ctx context.Context, url string, params map[string]string, headers map[string]string, contentType string, body []byte, timeout time.Duration, opts ...RequestOption) (*http.Response, error) {
+	url, params, headers = proxy.rewritePTXRequest(url, params, headers)
+	if contentType != "" {
+		merged := make(map[string]string, len(headers)+1)
+		merged["Content-Type"] = contentType
+		for k, v := range headers {
+			merged[k] = v
+		}
+		headers = merged
+	}
+	return proxy.send(ctx, http.MethodPost, url, params, headers, body, timeout, newRequestOptions(opts))
+}
+
+// RefreshToken fetches a new auth token now instead of waiting for the current
+// one to expire. It does nothing for proxies without credentials. With a
+// CredentialPool, every credential's token is dropped and fetched on next use,
+// and with an AuthProvider, the provider's token is invalidated and fetched.
+func (proxy *TDXProxy) RefreshToken(ctx context.Context) error {
+	if provider := proxy.settings().auth; provider != nil {
+		invalidateToken(provider)
+		_, err := provider.Token(ctx)
+		return err
+	}
+	if pool := proxy.settings().credentials; pool != nil {
+		pool.invalidateAll()
+		return nil
+	}
+	return proxy.updateAuth(ctx, 0)
 }
 
 func (proxy *TDXProxy) SetBaseURL(url string) {
@@ -103,71 +345,210 @@ func (proxy *TDXProxy) SetBaseURL(url string) {
 		return
 	}
 
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
 	proxy.baseUrl = url
 }
 
-func (proxy *TDXProxy) requestWithRetry(url string, params, headers map[string]string, timeout time.Duration, retryCount int) (*http.Response, error) {
-	if retryCount > 2 {
-		return nil, fmt.Errorf("max retry attempts reached for %s", url)
-	}
+// SetTransport sets the transport used for TDX and auth requests.
+// Passing nil restores http.DefaultTransport.
+func (proxy *TDXProxy) SetTransport(transport http.RoundTripper) {
+	proxy.mu.Lock()
+	defer proxy.mu.Unlock()
+	proxy.transport = transport
+}
+
+func (proxy *TDXProxy) requestWithRetry(ctx context.Context, url string, params, headers map[string]string, timeout time.Duration, options *requestOptions) (*http.Response, error) {
+	return proxy.send(ctx, http.MethodGet, url, params, headers, nil, timeout, options)
+}
 
+// send builds a request from a TDX path and runs it through roundTrip.
+func (proxy *TDXProxy) send(ctx context.Context, method, url string, params, headers map[string]string, body []byte, timeout time.Duration, options *requestOptions) (*http.Response, error) {
 	fullURL := proxy.buildFullURL(url, params)
-	reqHeaders, err := proxy.buildAuthHeaders(timeout)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build auth headers: %w", err)
+	accept := proxy.requestAccept(headers, options)
+	newRequest := func() (*http.Request, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, fullURL, reader)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if accept != "" && req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", accept)
+		}
+		return req, nil
 	}
-	for k, v := range headers {
-		reqHeaders[k] = v
+	return proxy.roundTrip(ctx, url, newRequest, timeout, options)
+}
+
+// roundTrip sends the request built by newRequest until it succeeds or the
+// retry policy gives up. newRequest is called once per attempt, and auth
+// headers are applied to each attempt so a refreshed token is picked up.
+func (proxy *TDXProxy) roundTrip(ctx context.Context, url string, newRequest func() (*http.Request, error), timeout time.Duration, options *requestOptions) (*http.Response, error) {
+	if w := proxy.dryRunWriter(options); w != nil {
+		return nil, proxy.printDryRun(w, newRequest)
 	}
+	start := proxy.clock.Now()
+	info := &RequestInfo{URL: url, Time: start}
+	resp, err := proxy.attempts(ctx, url, newRequest, timeout, options, info)
+	if err == nil {
+		err = limitBody(url, resp, proxy.bodyLimit(options))
+		if err == nil {
+			err = proxy.transcodeBody(ctx, url, resp)
+		}
+		if err != nil {
+			resp = nil
+		}
+	}
+	info.Latency = proxy.clock.Now().Sub(start)
+	info.Err = err
+	proxy.setLastRequestInfo(ctx, info)
+	proxy.stats.recordRequest(info)
+	return resp, err
+}
 
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// attempts runs the retry loop for roundTrip, recording progress in info.
+func (proxy *TDXProxy) attempts(ctx context.Context, url string, newRequest func() (*http.Request, error), timeout time.Duration, options *requestOptions, info *RequestInfo) (*http.Response, error) {
+	settings := proxy.settings()
+	client := &http.Client{Timeout: timeout, Transport: settings.debug.transport(settings.transport)}
+	policy := settings.retryPolicy
+	if options.noRetry {
+		policy = NeverRetry
 	}
-	for k, v := range reqHeaders {
-		req.Header.Set(k, v)
+	var history []Attempt
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		authHeaders, credential, err := proxy.buildAuthHeaders(ctx, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build auth headers: %w", err)
+		}
+		for k, v := range authHeaders {
+			if req.Header.Get(k) == "" {
+				req.Header.Set(k, v)
+			}
+		}
+
+		if settings.limiter != nil {
+			if err := settings.limiter.Wait(ctx); err != nil {
+				return nil, fmt.Errorf("rate limiter: %w", err)
+			}
+		}
+		release, err := acquireSlot(ctx, settings.inflight)
+		if err != nil {
+			return nil, err
+		}
+		sent := proxy.clock.Now()
+		resp, err := client.Do(req)
+		success := err == nil && options.isSuccess(resp.StatusCode)
+		if credential != nil {
+			settings.credentials.report(credential, resp, success)
+		}
+		if err != nil {
+			release()
+		} else {
+			resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+		}
+		info.Attempts = attempt
+		record := Attempt{Time: sent, Err: err}
+		if resp != nil {
+			info.StatusCode = resp.StatusCode
+			info.RateLimit = rateLimitHeaders(resp.Header)
+			record.StatusCode = resp.StatusCode
+			record.RetryAfter = retryAfter(resp.Header, proxy.clock.Now())
+		}
+		history = append(history, record)
+		if success {
+			proxy.log(ctx, slog.LevelInfo, "Successful request", slog.String("url", url), slog.Int("status", resp.StatusCode))
+			return resp, nil
+		}
+
+		var retry bool
+		delay, retry = shouldRetry(policy, delay, attempt, resp, err)
+		// A response asking for a longer wait is not retried sooner.
+		delay = max(delay, record.RetryAfter)
+		if !retry {
+			if options.keepResponse && err == nil {
+				return resp, nil
+			}
+			return nil, proxy.attemptError(ctx, url, history, resp, err)
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		switch {
+		case err != nil:
+			proxy.log(ctx, slog.LevelWarn, "Request failed, retrying...", slog.String("url", url), slog.String("error", err.Error()))
+		case resp.StatusCode == http.StatusUnauthorized && settings.auth != nil:
+			proxy.log(ctx, slog.LevelWarn, "Unauthorized, invalidating the provider's token...", slog.String("url", url))
+			invalidateToken(settings.auth)
+		case resp.StatusCode == http.StatusUnauthorized && credential != nil:
+			proxy.log(ctx, slog.LevelWarn, "Unauthorized, retrying with a new token...", slog.String("url", url), slog.String("app_id", credential.AppID))
+			settings.credentials.invalidate(credential)
+		case resp.StatusCode == http.StatusUnauthorized:
+			proxy.log(ctx, slog.LevelWarn, "Unauthorized, refreshing token...", slog.String("url", url))
+			if err := proxy.updateAuth(ctx, timeout); err != nil {
+				return nil, fmt.Errorf("failed to refresh auth token: %w", err)
+			}
+			proxy.log(ctx, slog.LevelInfo, "Retrying request after refreshing token")
+		case resp.StatusCode == http.StatusTooManyRequests:
+			proxy.log(ctx, slog.LevelWarn, "Rate limit reached, retrying...", slog.String("url", url))
+		default:
+			proxy.log(ctx, slog.LevelWarn, "Unexpected status code, retrying...", slog.String("url", url), slog.Int("status", resp.StatusCode))
+		}
+		if err := proxy.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
 	}
+}
 
-	client := &http.Client{Timeout: timeout}
-	resp, err := client.Do(req)
+// attemptError builds the error for an attempt the retry policy declined to
+// retry, the last of history.
+func (proxy *TDXProxy) attemptError(ctx context.Context, url string, history []Attempt, resp *http.Response, err error) error {
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return fmt.Errorf("request failed: %w", err)
 	}
-	if err := proxy.handleResponse(resp, url, params, headers, timeout, retryCount); err != nil {
-		return nil, err
+	statusErr := newStatusError(url, resp, proxy.clock.Now())
+	statusErr.RetryAfter = history[len(history)-1].RetryAfter
+	statusErr.Attempts = history
+	if len(history) > 1 && isRetryableStatus(resp.StatusCode) {
+		proxy.log(ctx, slog.LevelError, "Max retry attempts reached", slog.String("url", url), slog.Int("status", resp.StatusCode))
+		return fmt.Errorf("max retry attempts reached for %s: %w", url, statusErr)
 	}
-	return resp, nil
+	proxy.log(ctx, slog.LevelError, "Unexpected status code", slog.String("url", url), slog.Int("status", resp.StatusCode))
+	return statusErr
 }
 
-func (proxy *TDXProxy) handleResponse(resp *http.Response, url string, params, headers map[string]string, timeout time.Duration, retryCount int) error {
-	switch resp.StatusCode {
-	case http.StatusOK, http.StatusNotModified:
-		proxy.logger.Info("Successful request", slog.String("url", url), slog.Int("status", resp.StatusCode))
-		return nil
-	case http.StatusUnauthorized:
-		proxy.logger.Warn("Unauthorized, refreshing token...", slog.String("url", url))
-		if err := proxy.updateAuth(timeout); err != nil {
-			return fmt.Errorf("failed to refresh auth token: %w", err)
-		}
-		proxy.logger.Info("Retrying request after refreshing token")
-		_, err := proxy.requestWithRetry(url, params, headers, timeout, retryCount+1)
-		return err
-	case http.StatusTooManyRequests:
-		proxy.logger.Warn("Rate limit reached, retrying...", slog.String("url", url))
-		time.Sleep(1 * time.Second)
-		_, err := proxy.requestWithRetry(url, params, headers, timeout, retryCount+1)
-		return err
-	default:
-		proxy.logger.Error("Unexpected status code", slog.String("url", url), slog.Int("status", resp.StatusCode))
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+// isSuccessStatus reports whether status is one of the default success
+// statuses, see SuccessStatus.
+func isSuccessStatus(status int) bool {
+	return status == http.StatusOK || status == http.StatusNotModified
 }
 
-// buildFullURL constructs the full API URL with query parameters.
+// EscapeParam escapes a value for use as a request parameter. The proxy
+// writes parameters into the URL verbatim, so that values built by Nearby or
+// BoundingBox.Filter can be passed as they are; any other value that may hold
+// spaces, quotes or '&', such as a $filter expression, must go through
+// EscapeParam.
+func EscapeParam(value string) string {
+	return url.QueryEscape(value)
+}
+
+// buildFullURL constructs the full API URL with query parameters, which are
+// written verbatim, see EscapeParam.
 func (proxy *TDXProxy) buildFullURL(url string, params map[string]string) string {
 	var builder strings.Builder
-	builder.WriteString(proxy.baseUrl)
-	builder.WriteString(url)
+	builder.WriteString(proxy.resolveURL(url))
 	builder.WriteString("?")
 
 	for k, v := range params {
@@ -176,66 +557,156 @@ func (proxy *TDXProxy) buildFullURL(url string, params map[string]string) string
 	return strings.TrimSuffix(builder.String(), "&")
 }
 
+// resolveURL prefixes a TDX path with the base URL. Absolute URLs, such as
+// historical API downloads under TDX_URL_HISTORICAL, are returned unchanged.
+func (proxy *TDXProxy) resolveURL(url string) string {
+	if strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://") {
+		return url
+	}
+	return proxy.settings().baseURL + url
+}
+
 // buildAuthHeaders constructs headers including authorization if applicable.
-func (proxy *TDXProxy) buildAuthHeaders(timeout time.Duration) (map[string]string, error) {
-	headers := map[string]string{
-		"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.122 Safari/537.36",
+// An AuthProvider takes precedence over credentials. With a CredentialPool it
+// also returns the pooled credential that was used.
+func (proxy *TDXProxy) buildAuthHeaders(ctx context.Context, timeout time.Duration) (map[string]string, *pooledCredential, error) {
+	headers := map[string]string{"User-Agent": userAgent}
+	settings := proxy.settings()
+
+	if settings.auth != nil {
+		token, err := settings.auth.Token(ctx)
+		if err != nil {
+			proxy.log(ctx, slog.LevelError, "Failed to get auth token from provider", slog.String("error", err.Error()))
+			return nil, nil, err
+		}
+		headers["Authorization"] = "Bearer " + token
+		return headers, nil, nil
 	}
 
-	if proxy.appID == "" || proxy.appKey == "" {
-		return headers, nil
+	if pool := settings.credentials; pool != nil {
+		// A credential whose token request fails is skipped for the next one.
+		var err error
+		for range pool.size() {
+			credential := pool.acquire()
+			var token string
+			token, err = pool.token(ctx, proxy, credential, timeout)
+			if err == nil {
+				headers["Authorization"] = "Bearer " + token
+				return headers, credential, nil
+			}
+			proxy.log(ctx, slog.LevelError, "Failed to update auth token", slog.String("app_id", credential.AppID), slog.String("error", err.Error()))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return headers, nil, nil
 	}
 
-	if proxy.authToken == "" || time.Now().Unix() > proxy.expiredTime {
-		if err := proxy.updateAuth(timeout); err != nil {
-			proxy.logger.Error("Failed to update auth token", slog.String("error", err.Error()))
-			return nil, err
+	proxy.tokenMu.Lock()
+	defer proxy.tokenMu.Unlock()
+	if proxy.appID == "" || proxy.appKey == "" {
+		return headers, nil, nil
+	}
+	if proxy.authToken == "" || proxy.clock.Now().Unix() > proxy.expiredTime {
+		if err := proxy.updateAuthLocked(ctx, timeout); err != nil {
+			proxy.log(ctx, slog.LevelError, "Failed to update auth token", slog.String("error", err.Error()))
+			return nil, nil, err
 		}
 	}
 	headers["Authorization"] = "Bearer " + proxy.authToken
-	return headers, nil
+	return headers, nil, nil
+}
+
+// updateAuth fetches a new authentication token for the single credential,
+// if the proxy has one.
+func (proxy *TDXProxy) updateAuth(ctx context.Context, timeout time.Duration) error {
+	proxy.tokenMu.Lock()
+	defer proxy.tokenMu.Unlock()
+	if proxy.appID == "" || proxy.appKey == "" {
+		return nil
+	}
+	return proxy.updateAuthLocked(ctx, timeout)
 }
 
-// updateAuth fetches a new authentication token.
-func (proxy *TDXProxy) updateAuth(timeout time.Duration) error {
-	data := fmt.Sprintf("grant_type=client_credentials&client_id=%s&client_secret=%s", proxy.appID, proxy.appKey)
-	req, err := http.NewRequest("POST", authURL, bytes.NewBufferString(data))
+// updateAuthLocked is updateAuth for callers holding tokenMu.
+func (proxy *TDXProxy) updateAuthLocked(ctx context.Context, timeout time.Duration) error {
+	token, expires, err := proxy.fetchToken(ctx, proxy.appID, proxy.appKey, timeout)
 	if err != nil {
-		return fmt.Errorf("failed to create auth request: %w", err)
+		return err
+	}
+	proxy.authToken = token
+	proxy.expiredTime = expires
+	return nil
+}
+
+// fetchToken requests a token for a client ID and secret and returns it with
+// the Unix time, a minute early, at which it should be replaced. Failed token
+// requests are retried as decided by the auth retry policy.
+func (proxy *TDXProxy) fetchToken(ctx context.Context, appID, appKey string, timeout time.Duration) (string, int64, error) {
+	policy := proxy.settings().authRetry
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		token, expires, resp, err := proxy.requestToken(ctx, appID, appKey, timeout)
+		if err == nil {
+			return token, expires, nil
+		}
+		var retry bool
+		if resp != nil {
+			delay, retry = shouldRetry(policy, delay, attempt, resp, nil)
+		} else {
+			delay, retry = shouldRetry(policy, delay, attempt, nil, err)
+		}
+		if !retry || ctx.Err() != nil {
+			return "", 0, err
+		}
+		proxy.log(ctx, slog.LevelWarn, "Token request failed, retrying...", slog.String("app_id", appID), slog.Duration("delay", delay), slog.String("error", err.Error()))
+		if err := proxy.sleep(ctx, delay); err != nil {
+			return "", 0, err
+		}
+	}
+}
+
+// requestToken makes a single token request. The response is returned with
+// any error, its body closed, unless the request failed without one.
+func (proxy *TDXProxy) requestToken(ctx context.Context, appID, appKey string, timeout time.Duration) (string, int64, *http.Response, error) {
+	settings := proxy.settings()
+	data := settings.tokenForm.form(appID, appKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", authURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("failed to create auth request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{Timeout: timeout}
+	client := &http.Client{Timeout: timeout, Transport: settings.debug.transport(settings.transport)}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("auth request failed: %w", err)
+		return "", 0, nil, fmt.Errorf("auth request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("auth request returned status %d", resp.StatusCode)
+		return "", 0, resp, fmt.Errorf("auth request failed: %w", newStatusError(authURL, resp, proxy.clock.Now()))
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read auth response: %w", err)
+		return "", 0, resp, fmt.Errorf("failed to read auth response: %w", err)
 	}
 
 	var response map[string]interface{}
 	if err := json.Unmarshal(body, &response); err != nil {
-		return fmt.Errorf("failed to parse auth response: %w", err)
+		return "", 0, resp, fmt.Errorf("failed to parse auth response: %w", err)
 	}
 
 	token, ok := response["access_token"].(string)
 	if !ok {
-		return errors.New("auth response missing access_token")
+		return "", 0, resp, errors.New("auth response missing access_token")
 	}
 	expiresIn, ok := response["expires_in"].(float64)
 	if !ok {
-		return errors.New("auth response missing expires_in")
+		return "", 0, resp, errors.New("auth response missing expires_in")
 	}
 
-	proxy.authToken = token
-	proxy.expiredTime = time.Now().Unix() + int64(expiresIn) - 60
-	return nil
+	proxy.stats.tokenRefreshes.Add(1)
+	return token, proxy.clock.Now().Unix() + int64(expiresIn) - 60, resp, nil
 }
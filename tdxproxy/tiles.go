@@ -0,0 +1,573 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// TileFormat is the encoding of the tiles written by TileSet.
+type TileFormat int
+
+const (
+	// TileFormatMVT is the Mapbox Vector Tile format, version 2.
+	TileFormatMVT TileFormat = iota
+	// TileFormatGeoJSON writes each tile as a GeoJSON FeatureCollection, with
+	// the layer of each feature in its "layer" property.
+	TileFormatGeoJSON
+)
+
+// Ext returns the file extension of tiles in the format.
+func (f TileFormat) Ext() string {
+	if f == TileFormatGeoJSON {
+		return ".geojson"
+	}
+	return ".mvt"
+}
+
+func (f TileFormat) contentType() string {
+	if f == TileFormatGeoJSON {
+		return "application/geo+json"
+	}
+	return "application/vnd.mapbox-vector-tile"
+}
+
+// tileExtent is the resolution of a tile: coordinates are rounded to a grid of
+// tileExtent units a side, which also simplifies shapes at low zooms.
+const tileExtent = 4096
+
+// maxTileZoom is the highest zoom TileSet writes, finer than stop positions.
+const maxTileZoom = 20
+
+// TileWriter stores a tile at path, such as "12/3429/1751.mvt".
+type TileWriter interface {
+	WriteTile(ctx context.Context, path string, data []byte, contentType string) error
+}
+
+type dirTileWriter string
+
+// NewDirTileWriter returns a TileWriter writing tiles to files under dir.
+func NewDirTileWriter(dir string) TileWriter {
+	return dirTileWriter(dir)
+}
+
+func (dir dirTileWriter) WriteTile(ctx context.Context, path string, data []byte, contentType string) error {
+	name := filepath.Join(string(dir), filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+type objectTileWriter struct {
+	store  ObjectStore
+	prefix string
+}
+
+// NewObjectTileWriter returns a TileWriter uploading tiles to store, with keys
+// prefixed by prefix, such as "tiles/taipei/".
+func NewObjectTileWriter(store ObjectStore, prefix string) TileWriter {
+	return objectTileWriter{store: store, prefix: prefix}
+}
+
+func (w objectTileWriter) WriteTile(ctx context.Context, path string, data []byte, contentType string) error {
+	key := w.prefix + path
+	if err := w.store.PutObject(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// TileSet collects route shapes and stops and cuts them into z/x/y web
+// mercator tiles, so that map frontends load only the part of a network in
+// view, already simplified for the zoom, rather than whole TDX payloads.
+type TileSet struct {
+	// Buffer is how far features extend past the edges of each tile, in
+	// 1/4096ths of a tile, so that lines are not cut visibly at tile edges.
+	Buffer int
+
+	layers   []string
+	features map[string][]*tileFeature
+	stops    map[string]*tileFeature
+}
+
+type tileFeature struct {
+	// points are latitude and longitude pairs, one for a point feature.
+	points     [][2]float64
+	line       bool
+	properties map[string]any
+}
+
+// NewTileSet creates an empty tile set with a buffer of 64.
+func NewTileSet() *TileSet {
+	return &TileSet{Buffer: 64, features: map[string][]*tileFeature{}, stops: map[string]*tileFeature{}}
+}
+
+func (t *TileSet) add(layer string, f *tileFeature) {
+	if _, ok := t.features[layer]; !ok {
+		t.layers = append(t.layers, layer)
+	}
+	t.features[layer] = append(t.features[layer], f)
+}
+
+// AddLine adds a line of latitude and longitude pairs to layer. Property
+// values should be strings, numbers or booleans.
+func (t *TileSet) AddLine(layer string, points [][2]float64, properties map[string]any) {
+	if len(points) < 2 {
+		return
+	}
+	t.add(layer, &tileFeature{points: slices.Clone(points), line: true, properties: maps.Clone(properties)})
+}
+
+// AddPoint adds a point to layer, with properties as in AddLine.
+func (t *TileSet) AddPoint(layer string, lat, lon float64, properties map[string]any) {
+	t.add(layer, &tileFeature{points: [][2]float64{{lat, lon}}, properties: maps.Clone(properties)})
+}
+
+// AddShapes adds route shapes to the "routes" layer, with their route_uid,
+// sub_route_uid and direction properties.
+func (t *TileSet) AddShapes(shapes ...*RouteShape) {
+	for _, s := range shapes {
+		points := make([][2]float64, len(s.points))
+		for i, p := range s.points {
+			points[i] = [2]float64{p.lat, p.lon}
+		}
+		t.AddLine("routes", points, map[string]any{
+			"route_uid":     s.RouteUID,
+			"sub_route_uid": s.SubRouteUID,
+			"direction":     s.Direction,
+		})
+	}
+}
+
+// AddStops adds the stops of sequences to the "stops" layer, with their
+// stop_uid, station_id, name and name_en properties. A stop served by several
+// sequences is added once, with the names of the routes calling there in its
+// routes property, separated by commas.
+func (t *TileSet) AddStops(sequences ...StopSequence) {
+	for _, s := range sequences {
+		for _, stop := range s.Stops {
+			f, ok := t.stops[stop.StopUID]
+			if !ok {
+				f = &tileFeature{points: [][2]float64{{stop.Lat, stop.Lon}}, properties: map[string]any{
+					"stop_uid":   stop.StopUID,
+					"station_id": stop.StationID,
+					"name":       stop.StopName.ZhTw,
+					"name_en":    stop.StopName.En,
+				}}
+				t.stops[stop.StopUID] = f
+				t.add("stops", f)
+			}
+			routes, _ := f.properties["routes"].(string)
+			if !slices.Contains(strings.Split(routes, ","), s.RouteName.ZhTw) {
+				f.properties["routes"] = strings.TrimPrefix(routes+","+s.RouteName.ZhTw, ",")
+			}
+		}
+	}
+}
+
+// tilePoint is a position in tiles from the top left of the world at a zoom.
+type tilePoint struct{ x, y float64 }
+
+// project converts a latitude and longitude to web mercator at zoom z.
+func project(lat, lon float64, z int) tilePoint {
+	n := float64(uint(1) << z)
+	lat = math.Max(-85.0511, math.Min(85.0511, lat))
+	phi := lat * math.Pi / 180
+	return tilePoint{
+		x: (lon + 180) / 360 * n,
+		y: (1 - math.Log(math.Tan(phi)+1/math.Cos(phi))/math.Pi) / 2 * n,
+	}
+}
+
+// unproject is the inverse of project.
+func unproject(p tilePoint, z int) (lat, lon float64) {
+	n := float64(uint(1) << z)
+	lon = p.x/n*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*p.y/n))) * 180 / math.Pi
+	return lat, lon
+}
+
+type tileRect struct{ minX, minY, maxX, maxY float64 }
+
+// clipSegment clips the segment from a to b to r, returning the ends
+// unchanged when they lie inside.
+func clipSegment(a, b tilePoint, r tileRect) (tilePoint, tilePoint, bool) {
+	t0, t1 := 0.0, 1.0
+	dx, dy := b.x-a.x, b.y-a.y
+	edges := [4][2]float64{{-dx, a.x - r.minX}, {dx, r.maxX - a.x}, {-dy, a.y - r.minY}, {dy, r.maxY - a.y}}
+	for _, e := range edges {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return a, b, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			if t > t1 {
+				return a, b, false
+			}
+			t0 = math.Max(t0, t)
+		} else {
+			if t < t0 {
+				return a, b, false
+			}
+			t1 = math.Min(t1, t)
+		}
+	}
+	ca, cb := a, b
+	if t0 > 0 {
+		ca = tilePoint{a.x + t0*dx, a.y + t0*dy}
+	}
+	if t1 < 1 {
+		cb = tilePoint{a.x + t1*dx, a.y + t1*dy}
+	}
+	return ca, cb, true
+}
+
+// clipLine returns the parts of a line inside r.
+func clipLine(points []tilePoint, r tileRect) [][]tilePoint {
+	var parts [][]tilePoint
+	var part []tilePoint
+	for i := 1; i < len(points); i++ {
+		a, b, ok := clipSegment(points[i-1], points[i], r)
+		if !ok {
+			continue
+		}
+		if len(part) > 0 && part[len(part)-1] != a {
+			parts = append(parts, part)
+			part = nil
+		}
+		if len(part) == 0 {
+			part = append(part, a)
+		}
+		part = append(part, b)
+	}
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// tileGeometry is a feature clipped to a tile, in grid units from the tile's
+// top left corner.
+type tileGeometry struct {
+	feature *tileFeature
+	parts   [][][2]int
+}
+
+type tileKey struct{ x, y int }
+
+// cut clips the features of a layer at zoom z to the tiles they cross.
+func (t *TileSet) cut(features []*tileFeature, z int, tiles map[tileKey][]tileGeometry) {
+	buffer := float64(t.Buffer) / tileExtent
+	last := 1<<z - 1
+	for _, f := range features {
+		points := make([]tilePoint, len(f.points))
+		for i, p := range f.points {
+			points[i] = project(p[0], p[1], z)
+		}
+		if !f.line {
+			p := points[0]
+			for x := max(0, int(p.x-buffer)); x <= min(last, int(p.x+buffer)); x++ {
+				for y := max(0, int(p.y-buffer)); y <= min(last, int(p.y+buffer)); y++ {
+					r := tileRect{float64(x) - buffer, float64(y) - buffer, float64(x+1) + buffer, float64(y+1) + buffer}
+					if p.x >= r.minX && p.x < r.maxX && p.y >= r.minY && p.y < r.maxY {
+						key := tileKey{x, y}
+						tiles[key] = append(tiles[key], tileGeometry{feature: f, parts: [][][2]int{toGrid([]tilePoint{p}, x, y)}})
+					}
+				}
+			}
+			continue
+		}
+		for key, segments := range lineTiles(points, buffer, last) {
+			r := tileRect{float64(key.x) - buffer, float64(key.y) - buffer, float64(key.x+1) + buffer, float64(key.y+1) + buffer}
+			g := tileGeometry{feature: f}
+			// Clip each run of consecutive segments near the tile, so that
+			// the work per tile grows with the segments near it only.
+			for start := 0; start < len(segments); {
+				end := start
+				for end+1 < len(segments) && segments[end+1] == segments[end]+1 {
+					end++
+				}
+				for _, part := range clipLine(points[segments[start]:segments[end]+2], r) {
+					if grid := toGrid(part, key.x, key.y); len(grid) >= 2 {
+						g.parts = append(g.parts, grid)
+					}
+				}
+				start = end + 1
+			}
+			if len(g.parts) > 0 {
+				tiles[key] = append(tiles[key], g)
+			}
+		}
+	}
+}
+
+// lineTiles returns the tiles within buffer of a line, each with the
+// increasing indices of the segments that may cross it. Segments are walked
+// in steps of at most a tile, so the work grows with the line's length in
+// tiles rather than the area of its bounding box, which at high zooms is
+// millions of tiles.
+func lineTiles(points []tilePoint, buffer float64, last int) map[tileKey][]int {
+	tiles := map[tileKey][]int{}
+	for i := 0; i+1 < len(points); i++ {
+		a, b := points[i], points[i+1]
+		steps := max(1, int(math.Ceil(math.Max(math.Abs(b.x-a.x), math.Abs(b.y-a.y)))))
+		for s := 0; s < steps; s++ {
+			f0, f1 := float64(s)/float64(steps), float64(s+1)/float64(steps)
+			p := tilePoint{a.x + (b.x-a.x)*f0, a.y + (b.y-a.y)*f0}
+			q := tilePoint{a.x + (b.x-a.x)*f1, a.y + (b.y-a.y)*f1}
+			// Tiles are closed on every side when clipped, so a line along
+			// the edge between two tiles is in both.
+			minX, maxX := max(0, int(math.Ceil(math.Min(p.x, q.x)-buffer))-1), min(last, int(math.Max(p.x, q.x)+buffer))
+			minY, maxY := max(0, int(math.Ceil(math.Min(p.y, q.y)-buffer))-1), min(last, int(math.Max(p.y, q.y)+buffer))
+			for x := minX; x <= maxX; x++ {
+				for y := minY; y <= maxY; y++ {
+					key := tileKey{x, y}
+					if segments := tiles[key]; len(segments) == 0 || segments[len(segments)-1] != i {
+						tiles[key] = append(segments, i)
+					}
+				}
+			}
+		}
+	}
+	return tiles
+}
+
+// toGrid rounds points to the grid of tile x, y, dropping repeated points.
+func toGrid(points []tilePoint, x, y int) [][2]int {
+	var grid [][2]int
+	for _, p := range points {
+		g := [2]int{int(math.Round((p.x - float64(x)) * tileExtent)), int(math.Round((p.y - float64(y)) * tileExtent))}
+		if len(grid) == 0 || grid[len(grid)-1] != g {
+			grid = append(grid, g)
+		}
+	}
+	return grid
+}
+
+// Write cuts the tile set into tiles for every zoom from minZoom to maxZoom
+// and writes those with features to w, at paths "{z}/{x}/{y}" with the
+// format's extension. It returns the number of tiles written.
+func (t *TileSet) Write(ctx context.Context, w TileWriter, format TileFormat, minZoom, maxZoom int) (int, error) {
+	if minZoom < 0 || minZoom > maxZoom || maxZoom > maxTileZoom {
+		return 0, fmt.Errorf("invalid zoom range %d-%d: must be within 0-%d", minZoom, maxZoom, maxTileZoom)
+	}
+	written := 0
+	for z := minZoom; z <= maxZoom; z++ {
+		layers := make([]map[tileKey][]tileGeometry, len(t.layers))
+		var keys []tileKey
+		for i, layer := range t.layers {
+			layers[i] = map[tileKey][]tileGeometry{}
+			t.cut(t.features[layer], z, layers[i])
+			for k := range layers[i] {
+				keys = append(keys, k)
+			}
+		}
+		slices.SortFunc(keys, func(a, b tileKey) int { return cmp.Or(cmp.Compare(a.x, b.x), cmp.Compare(a.y, b.y)) })
+		for _, k := range slices.Compact(keys) {
+			if err := ctx.Err(); err != nil {
+				return written, err
+			}
+			tile := make([][]tileGeometry, len(t.layers))
+			for i := range t.layers {
+				tile[i] = layers[i][k]
+			}
+			var data []byte
+			var err error
+			if format == TileFormatGeoJSON {
+				data, err = t.encodeGeoJSON(tile, z, k)
+			} else {
+				data = t.encodeMVT(tile)
+			}
+			if err != nil {
+				return written, err
+			}
+			path := fmt.Sprintf("%d/%d/%d%s", z, k.x, k.y, format.Ext())
+			if err := w.WriteTile(ctx, path, data, format.contentType()); err != nil {
+				return written, fmt.Errorf("failed to write tile %s: %w", path, err)
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+func (t *TileSet) encodeGeoJSON(tile [][]tileGeometry, z int, k tileKey) ([]byte, error) {
+	coordinate := func(g [2]int) [2]float64 {
+		lat, lon := unproject(tilePoint{float64(k.x) + float64(g[0])/tileExtent, float64(k.y) + float64(g[1])/tileExtent}, z)
+		return [2]float64{math.Round(lon*1e6) / 1e6, math.Round(lat*1e6) / 1e6}
+	}
+	features := []any{}
+	for i, layer := range tile {
+		for _, g := range layer {
+			properties := maps.Clone(g.feature.properties)
+			if properties == nil {
+				properties = map[string]any{}
+			}
+			properties["layer"] = t.layers[i]
+			var geometry map[string]any
+			if !g.feature.line {
+				geometry = map[string]any{"type": "Point", "coordinates": coordinate(g.parts[0][0])}
+			} else {
+				lines := make([][][2]float64, len(g.parts))
+				for j, part := range g.parts {
+					for _, p := range part {
+						lines[j] = append(lines[j], coordinate(p))
+					}
+				}
+				if len(lines) == 1 {
+					geometry = map[string]any{"type": "LineString", "coordinates": lines[0]}
+				} else {
+					geometry = map[string]any{"type": "MultiLineString", "coordinates": lines}
+				}
+			}
+			features = append(features, map[string]any{"type": "Feature", "geometry": geometry, "properties": properties})
+		}
+	}
+	return json.Marshal(map[string]any{"type": "FeatureCollection", "features": features})
+}
+
+// pbf appends protocol buffer fields, enough of the encoding for vector tiles.
+type pbf []byte
+
+func (p *pbf) key(field, wireType int) {
+	*p = binary.AppendUvarint(*p, uint64(field<<3|wireType))
+}
+
+func (p *pbf) uint(field int, v uint64) {
+	p.key(field, 0)
+	*p = binary.AppendUvarint(*p, v)
+}
+
+func (p *pbf) double(field int, v float64) {
+	p.key(field, 1)
+	*p = binary.LittleEndian.AppendUint64(*p, math.Float64bits(v))
+}
+
+func (p *pbf) bytes(field int, b []byte) {
+	p.key(field, 2)
+	*p = binary.AppendUvarint(*p, uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+func (p *pbf) packed(field int, values []uint32) {
+	var inner []byte
+	for _, v := range values {
+		inner = binary.AppendUvarint(inner, uint64(v))
+	}
+	p.bytes(field, inner)
+}
+
+func zigzag(v int) uint32 {
+	return uint32(int32(v)<<1 ^ int32(v)>>31)
+}
+
+// mvtValue encodes a property value as a vector tile Value message.
+func mvtValue(v any) []byte {
+	var p pbf
+	switch v := v.(type) {
+	case string:
+		p.bytes(1, []byte(v))
+	case float64:
+		p.double(3, v)
+	case float32:
+		p.double(3, float64(v))
+	case int:
+		p.uint(4, uint64(v))
+	case int64:
+		p.uint(4, uint64(v))
+	case bool:
+		b := uint64(0)
+		if v {
+			b = 1
+		}
+		p.uint(7, b)
+	default:
+		p.bytes(1, []byte(fmt.Sprint(v)))
+	}
+	return p
+}
+
+func (t *TileSet) encodeMVT(tile [][]tileGeometry) []byte {
+	var out pbf
+	for i, geometries := range tile {
+		if len(geometries) == 0 {
+			continue
+		}
+		var layer pbf
+		layer.uint(15, 2)
+		layer.bytes(1, []byte(t.layers[i]))
+
+		var keys []string
+		var values [][]byte
+		keyIndex, valueIndex := map[string]uint32{}, map[string]uint32{}
+		for _, g := range geometries {
+			var tags []uint32
+			for _, k := range slices.Sorted(maps.Keys(g.feature.properties)) {
+				ki, ok := keyIndex[k]
+				if !ok {
+					ki = uint32(len(keys))
+					keyIndex[k] = ki
+					keys = append(keys, k)
+				}
+				value := mvtValue(g.feature.properties[k])
+				vi, ok := valueIndex[string(value)]
+				if !ok {
+					vi = uint32(len(values))
+					valueIndex[string(value)] = vi
+					values = append(values, value)
+				}
+				tags = append(tags, ki, vi)
+			}
+
+			// Geometry commands move a cursor kept across the parts.
+			var commands []uint32
+			var cursor [2]int
+			for _, part := range g.parts {
+				commands = append(commands, 1|1<<3, zigzag(part[0][0]-cursor[0]), zigzag(part[0][1]-cursor[1]))
+				cursor = part[0]
+				if len(part) > 1 {
+					commands = append(commands, 2|uint32(len(part)-1)<<3)
+					for _, p := range part[1:] {
+						commands = append(commands, zigzag(p[0]-cursor[0]), zigzag(p[1]-cursor[1]))
+						cursor = p
+					}
+				}
+			}
+
+			var feature pbf
+			if len(tags) > 0 {
+				feature.packed(2, tags)
+			}
+			geomType := uint64(1)
+			if g.feature.line {
+				geomType = 2
+			}
+			feature.uint(3, geomType)
+			feature.packed(4, commands)
+			layer.bytes(2, feature)
+		}
+		for _, k := range keys {
+			layer.bytes(3, []byte(k))
+		}
+		for _, v := range values {
+			layer.bytes(4, v)
+		}
+		layer.uint(5, tileExtent)
+		out.bytes(3, layer)
+	}
+	return out
+}
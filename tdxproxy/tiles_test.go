@@ -0,0 +1,74 @@
+package tdxproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTileSetCutLine(t *testing.T) {
+	const z = 2
+	tests := []struct {
+		name   string
+		buffer int
+		line   []tilePoint
+		want   map[tileKey][][][2]int
+	}{
+		{
+			name: "diagonal through a corner",
+			line: []tilePoint{{0.5, 0.5}, {1.5, 1.5}},
+			want: map[tileKey][][][2]int{
+				{0, 0}: {{{2048, 2048}, {4096, 4096}}},
+				{1, 1}: {{{0, 0}, {2048, 2048}}},
+			},
+		},
+		{
+			name:   "diagonal through a buffered corner",
+			buffer: 64,
+			line:   []tilePoint{{0.5, 0.5}, {1.5, 1.5}},
+			want: map[tileKey][][][2]int{
+				{0, 0}: {{{2048, 2048}, {4160, 4160}}},
+				{1, 0}: {{{-64, 4032}, {64, 4160}}},
+				{0, 1}: {{{4032, -64}, {4160, 64}}},
+				{1, 1}: {{{-64, -64}, {2048, 2048}}},
+			},
+		},
+		{
+			name: "along an edge",
+			line: []tilePoint{{1, 0.25}, {1, 0.75}},
+			want: map[tileKey][][][2]int{
+				{0, 0}: {{{4096, 1024}, {4096, 3072}}},
+				{1, 0}: {{{0, 1024}, {0, 3072}}},
+			},
+		},
+		{
+			name: "touching an edge",
+			line: []tilePoint{{0.5, 0.25}, {1, 0.5}, {0.5, 0.75}},
+			want: map[tileKey][][][2]int{
+				{0, 0}: {{{2048, 1024}, {4096, 2048}, {2048, 3072}}},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &tileFeature{line: true}
+			for _, p := range tc.line {
+				lat, lon := unproject(p, z)
+				f.points = append(f.points, [2]float64{lat, lon})
+			}
+			set := NewTileSet()
+			set.Buffer = tc.buffer
+			tiles := map[tileKey][]tileGeometry{}
+			set.cut([]*tileFeature{f}, z, tiles)
+
+			got := map[tileKey][][][2]int{}
+			for key, geometries := range tiles {
+				for _, g := range geometries {
+					got[key] = append(got[key], g.parts...)
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package tdxproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Transform reshapes the records of a JSON response. The steps run in the
+// order of the fields: names are flattened, records are converted to GeoJSON
+// and then trimmed to the selected fields, which for GeoJSON applies to each
+// feature's properties so the geometry can come from an unselected field.
+type Transform struct {
+	// Lang flattens bilingual name objects to plain strings, see FlattenNames.
+	Lang string `json:"lang,omitempty" yaml:"lang"`
+	// GeoJSON turns the records into a FeatureCollection. Point geometry is
+	// taken from the alphabetically first top-level *Position field with
+	// PositionLat and PositionLon, and line geometry from a WKT LINESTRING in
+	// Geometry.
+	GeoJSON bool `json:"geojson,omitempty" yaml:"geojson"`
+	// Select keeps only these top-level fields.
+	Select []string `json:"select,omitempty" yaml:"select"`
+}
+
+// TransformRule applies a Transform to gateway responses whose TDX path
+// matches Path, a path.Match pattern such as "v2/Bus/Stop/City/*".
+type TransformRule struct {
+	Path      string `json:"path" yaml:"path"`
+	Transform `yaml:",inline"`
+}
+
+// Apply transforms a response body and returns the new body with its content type.
+func (t Transform) Apply(body []byte) ([]byte, string, error) {
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, record := range records {
+		if t.Lang != "" {
+			if record, err = FlattenNames(record, t.Lang); err != nil {
+				return nil, "", fmt.Errorf("record %d: %w", i, err)
+			}
+		}
+		if !t.GeoJSON {
+			if record, err = selectFields(record, t.Select); err != nil {
+				return nil, "", fmt.Errorf("record %d: %w", i, err)
+			}
+		}
+		records[i] = record
+	}
+
+	if !t.GeoJSON {
+		data, err := json.Marshal(records)
+		return data, "application/json", err
+	}
+	type feature struct {
+		Type       string          `json:"type"`
+		Geometry   any             `json:"geometry"`
+		Properties json.RawMessage `json:"properties"`
+	}
+	features := make([]feature, len(records))
+	for i, record := range records {
+		geometry, err := recordGeometry(record)
+		if err != nil {
+			return nil, "", fmt.Errorf("record %d: %w", i, err)
+		}
+		properties, err := selectFields(record, t.Select)
+		if err != nil {
+			return nil, "", fmt.Errorf("record %d: %w", i, err)
+		}
+		features[i] = feature{Type: "Feature", Geometry: geometry, Properties: properties}
+	}
+	data, err := json.Marshal(map[string]any{"type": "FeatureCollection", "features": features})
+	return data, "application/geo+json", err
+}
+
+// matchTransform returns the transform of the first rule matching a TDX path.
+func matchTransform(rules []TransformRule, tdxPath string) (Transform, bool) {
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Path, tdxPath); ok {
+			return rule.Transform, true
+		}
+	}
+	return Transform{}, false
+}
+
+// selectFields keeps the named top-level fields of a record in the given order.
+// With no fields the record is returned unchanged.
+func selectFields(record json.RawMessage, fields []string) (json.RawMessage, error) {
+	if len(fields) == 0 {
+		return record, nil
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(record, &all); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for _, name := range fields {
+		value, ok := all[name]
+		if !ok {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// recordGeometry builds the GeoJSON geometry of a record, or nil if it has none.
+func recordGeometry(record json.RawMessage) (any, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(record, &fields); err != nil {
+		return nil, err
+	}
+	if raw, ok := fields["Geometry"]; ok {
+		var wkt string
+		if json.Unmarshal(raw, &wkt) == nil && wkt != "" {
+			points, err := ParseLineString(wkt)
+			if err != nil {
+				return nil, err
+			}
+			coordinates := make([][2]float64, len(points))
+			for i, p := range points {
+				coordinates[i] = [2]float64{p[1], p[0]}
+			}
+			return map[string]any{"type": "LineString", "coordinates": coordinates}, nil
+		}
+	}
+	for _, name := range sortedKeys(fields) {
+		if !strings.HasSuffix(name, "Position") {
+			continue
+		}
+		var position struct {
+			PositionLat *float64
+			PositionLon *float64
+		}
+		if json.Unmarshal(fields[name], &position) != nil || position.PositionLat == nil || position.PositionLon == nil {
+			continue
+		}
+		return map[string]any{"type": "Point", "coordinates": [2]float64{*position.PositionLon, *position.PositionLat}}, nil
+	}
+	return nil, nil
+}
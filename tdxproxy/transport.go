@@ -0,0 +1,44 @@
+package tdxproxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Transport returns an http.RoundTripper that sends requests through the proxy,
+// so generated API clients and other http.Client based code get TDX auth and
+// retries by setting it as their transport.
+//
+// Only requests to the base URL's host receive the bearer token; requests to
+// other hosts go straight to the underlying transport. Unlike Do, responses
+// with unsuccessful statuses are returned as responses rather than errors.
+func (proxy *TDXProxy) Transport() http.RoundTripper {
+	return &proxyTransport{proxy: proxy}
+}
+
+type proxyTransport struct {
+	proxy *TDXProxy
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	settings := t.proxy.settings()
+	legacy := settings.ptxCompat && strings.EqualFold(req.URL.Hostname(), ptxHost)
+	if req.URL.IsAbs() && !legacy && !t.proxy.ownsHost(req.URL.Host) {
+		base := settings.transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		return base.RoundTrip(req)
+	}
+	return t.proxy.do(req, &requestOptions{keepResponse: true})
+}
+
+// ownsHost reports whether host is the host of the proxy's base URL.
+func (proxy *TDXProxy) ownsHost(host string) bool {
+	base, err := url.Parse(proxy.settings().baseURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(base.Host, host)
+}
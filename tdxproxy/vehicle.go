@@ -0,0 +1,189 @@
+package tdxproxy
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// VehiclePosition is a real-time bus position, as reported by the
+// RealTimeByFrequency (A1) endpoints.
+type VehiclePosition struct {
+	PlateNumb string    `json:"PlateNumb"`
+	RouteUID  string    `json:"RouteUID"`
+	RouteName Name      `json:"RouteName"`
+	Direction int       `json:"Direction"`
+	Lat       float64   `json:"Lat"`
+	Lon       float64   `json:"Lon"`
+	Speed     float64   `json:"Speed"`
+	Azimuth   float64   `json:"Azimuth"`
+	GPSTime   time.Time `json:"GPSTime"`
+}
+
+// busPositionPath returns the A1 path for a city, narrowed to a route if given.
+func busPositionPath(city, route string) string {
+	path := "v2/Bus/RealTimeByFrequency/City/" + city
+	if route != "" {
+		path += "/" + url.PathEscape(route)
+	}
+	return path
+}
+
+// BusPositions fetches the current bus positions of a city, or of one route
+// if route is not empty.
+func (proxy *TDXProxy) BusPositions(ctx context.Context, city, route string) ([]VehiclePosition, error) {
+	if err := checkBusCity(city, false); err != nil {
+		return nil, err
+	}
+	body, err := proxy.fetchBody(ctx, busPositionPath(city, route), nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeVehiclePositions(body)
+}
+
+func decodeVehiclePositions(body []byte) ([]VehiclePosition, error) {
+	records, err := DecodeRecords(body)
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]VehiclePosition, 0, len(records))
+	for i, record := range records {
+		var raw struct {
+			PlateNumb   string
+			RouteUID    string
+			RouteName   Name
+			Direction   int
+			BusPosition struct {
+				PositionLat float64
+				PositionLon float64
+			}
+			Speed   float64
+			Azimuth float64
+			GPSTime time.Time
+		}
+		if err := decodeRecord(i, record, &raw); err != nil {
+			return nil, err
+		}
+		if raw.PlateNumb == "" {
+			continue
+		}
+		positions = append(positions, VehiclePosition{
+			PlateNumb: raw.PlateNumb,
+			RouteUID:  raw.RouteUID,
+			RouteName: raw.RouteName,
+			Direction: raw.Direction,
+			Lat:       raw.BusPosition.PositionLat,
+			Lon:       raw.BusPosition.PositionLon,
+			Speed:     raw.Speed,
+			Azimuth:   raw.Azimuth,
+			GPSTime:   raw.GPSTime,
+		})
+	}
+	return positions, nil
+}
+
+// VehicleFeed polls bus positions of cities or routes and delivers an update
+// only when a vehicle reports a new GPS time or moves, so subscribers driving
+// a live map receive each position once.
+type VehicleFeed struct {
+	watcher *Watcher
+
+	mu   sync.Mutex
+	last map[string]VehiclePosition
+	subs map[chan VehiclePosition]struct{}
+}
+
+// NewVehicleFeed creates a feed polling every interval. TDX refreshes A1 data
+// about every 15 to 20 seconds, so shorter intervals only add requests.
+func NewVehicleFeed(proxy *TDXProxy, interval time.Duration) *VehicleFeed {
+	return &VehicleFeed{
+		watcher: NewWatcher(proxy, interval),
+		last:    make(map[string]VehiclePosition),
+		subs:    make(map[chan VehiclePosition]struct{}),
+	}
+}
+
+// WatchCity adds every bus of a city to the feed.
+func (f *VehicleFeed) WatchCity(city string) {
+	f.watcher.Watch(busPositionPath(city, ""), nil)
+}
+
+// WatchRoute adds the buses of one route to the feed.
+func (f *VehicleFeed) WatchRoute(city, route string) {
+	f.watcher.Watch(busPositionPath(city, route), nil)
+}
+
+// Latest returns the last known position of a vehicle by plate number.
+func (f *VehicleFeed) Latest(plate string) (VehiclePosition, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	position, ok := f.last[plate]
+	return position, ok
+}
+
+// Subscribe returns a channel receiving position updates and a function ending
+// the subscription. As with Watcher.Subscribe, updates are dropped for
+// subscribers whose buffer is full.
+func (f *VehicleFeed) Subscribe(buffer int) (<-chan VehiclePosition, func()) {
+	ch := make(chan VehiclePosition, buffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subs, ch)
+			f.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Run polls the watched cities and routes until ctx is done.
+func (f *VehicleFeed) Run(ctx context.Context) error {
+	events, unsubscribe := f.watcher.Subscribe(16)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- f.watcher.Run(ctx) }()
+
+	for {
+		select {
+		case err := <-done:
+			return err
+		case event := <-events:
+			positions, err := decodeVehiclePositions(event.Data)
+			if err != nil {
+				f.watcher.proxy.log(ctx, slog.LevelWarn, "Failed to decode vehicle positions", slog.String("url", event.Endpoint), slog.String("error", err.Error()))
+				continue
+			}
+			f.update(positions)
+		}
+	}
+}
+
+// update records positions and publishes those that changed.
+func (f *VehicleFeed) update(positions []VehiclePosition) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, position := range positions {
+		previous, seen := f.last[position.PlateNumb]
+		if seen && (position.GPSTime.Before(previous.GPSTime) ||
+			position.GPSTime.Equal(previous.GPSTime) && position.Lat == previous.Lat && position.Lon == previous.Lon) {
+			continue
+		}
+		f.last[position.PlateNumb] = position
+		for ch := range f.subs {
+			select {
+			case ch <- position:
+			default:
+			}
+		}
+	}
+}
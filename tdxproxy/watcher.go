@@ -0,0 +1,447 @@
+package tdxproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ChangeEvent reports new content of a watched endpoint.
+type ChangeEvent struct {
+	Endpoint string          `json:"endpoint"`
+	Time     time.Time       `json:"time"`
+	Hash     string          `json:"hash"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type watchedEndpoint struct {
+	path   string
+	params map[string]string
+	etag   string
+	hash   string
+	latest *ChangeEvent
+}
+
+// Watcher polls TDX endpoints at an interval and delivers a ChangeEvent to its
+// subscribers whenever an endpoint's content changes. Conditional requests are
+// used when TDX provides an ETag, so unchanged data costs no body transfer.
+type Watcher struct {
+	proxy    *TDXProxy
+	interval time.Duration
+	timeout  time.Duration
+
+	mu          sync.Mutex
+	minInterval time.Duration
+	maxInterval time.Duration
+	endpoints   map[string]*watchedEndpoint
+	subs        map[chan ChangeEvent]struct{}
+
+	store    StateStore
+	stateKey string
+	// saved is the loaded state of endpoints, applied when they are watched.
+	saved map[string]watcherState
+	// dirty holds the paths of endpoints whose state changed since it was saved.
+	dirty map[string]struct{}
+}
+
+// watcherState is the persisted state of a watched endpoint.
+type watcherState struct {
+	Params map[string]string `json:"params,omitempty"`
+	ETag   string            `json:"etag,omitempty"`
+	Hash   string            `json:"hash"`
+	Latest *ChangeEvent      `json:"latest,omitempty"`
+}
+
+func NewWatcher(proxy *TDXProxy, interval time.Duration) *Watcher {
+	return &Watcher{
+		proxy:     proxy,
+		interval:  interval,
+		timeout:   30 * time.Second,
+		endpoints: make(map[string]*watchedEndpoint),
+		subs:      make(map[chan ChangeEvent]struct{}),
+		saved:     make(map[string]watcherState),
+		dirty:     make(map[string]struct{}),
+	}
+}
+
+// Watch adds an endpoint, identified by its TDX path, to the polling set.
+// Watching the same path again replaces its parameters.
+func (w *Watcher) Watch(path string, params map[string]string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	endpoint := &watchedEndpoint{path: path, params: params}
+	w.restore(endpoint)
+	w.endpoints[path] = endpoint
+}
+
+// restore applies the loaded state of an endpoint watched with the same
+// parameters. w.mu must be held.
+func (w *Watcher) restore(endpoint *watchedEndpoint) {
+	state, ok := w.saved[endpoint.path]
+	if !ok || !maps.Equal(state.Params, endpoint.params) {
+		return
+	}
+	endpoint.etag, endpoint.hash, endpoint.latest = state.ETag, state.Hash, state.Latest
+}
+
+// SetStateStore makes the watcher persist the ETag, content hash and latest
+// event of each endpoint in store, under key followed by "/" and the path.
+// Run loads the state when it starts, so that content unchanged across a
+// restart raises no change event and is not sent to sinks again, and saves
+// the state of the endpoints each round changed.
+func (w *Watcher) SetStateStore(store StateStore, key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.store, w.stateKey = store, key
+}
+
+// LoadState loads the saved state of the watched endpoints and applies it to
+// those watched with the same parameters. Run calls it.
+func (w *Watcher) LoadState(ctx context.Context) error {
+	w.mu.Lock()
+	store, key := w.store, w.stateKey
+	paths := sortedKeys(w.endpoints)
+	w.mu.Unlock()
+	if store == nil {
+		return nil
+	}
+	var errs []error
+	for _, path := range paths {
+		data, err := store.LoadState(ctx, key+"/"+path)
+		if err != nil || data == nil {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to load watcher state of %s: %w", path, err))
+			}
+			continue
+		}
+		var state watcherState
+		if err := json.Unmarshal(data, &state); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load watcher state of %s: %w", path, err))
+			continue
+		}
+		w.mu.Lock()
+		w.saved[path] = state
+		if endpoint, ok := w.endpoints[path]; ok && endpoint.hash == "" {
+			w.restore(endpoint)
+		}
+		w.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// SaveState writes the state of every watched endpoint to the state store.
+// Run and Poll save the endpoints that changed after every round.
+func (w *Watcher) SaveState(ctx context.Context) error {
+	w.mu.Lock()
+	paths := sortedKeys(w.endpoints)
+	w.mu.Unlock()
+	return w.saveState(ctx, paths)
+}
+
+// saveState writes the state of the endpoints at paths. Endpoints whose state
+// fails to save are saved again after the next round.
+func (w *Watcher) saveState(ctx context.Context, paths []string) error {
+	var errs []error
+	for _, path := range paths {
+		w.mu.Lock()
+		store, key := w.store, w.stateKey
+		endpoint, ok := w.endpoints[path]
+		var state watcherState
+		if ok {
+			state = watcherState{Params: endpoint.params, ETag: endpoint.etag, Hash: endpoint.hash, Latest: endpoint.latest}
+		}
+		delete(w.dirty, path)
+		w.mu.Unlock()
+		if store == nil || state.Hash == "" {
+			continue
+		}
+		data, err := json.Marshal(state)
+		if err == nil {
+			err = store.SaveState(ctx, key+"/"+path, data)
+		}
+		if err != nil {
+			w.mu.Lock()
+			w.dirty[path] = struct{}{}
+			w.mu.Unlock()
+			errs = append(errs, fmt.Errorf("failed to save watcher state of %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// saveIfDirty saves the state of the endpoints a poll changed, logging failures.
+func (w *Watcher) saveIfDirty(ctx context.Context) {
+	w.mu.Lock()
+	var paths []string
+	if w.store != nil {
+		paths = sortedKeys(w.dirty)
+	}
+	w.mu.Unlock()
+	if len(paths) == 0 {
+		return
+	}
+	if err := w.saveState(context.WithoutCancel(ctx), paths); err != nil {
+		w.proxy.log(ctx, slog.LevelWarn, "Failed to save watcher state", slog.String("error", err.Error()))
+	}
+}
+
+// Unwatch removes an endpoint from the polling set.
+func (w *Watcher) Unwatch(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.endpoints, path)
+}
+
+// IsWatched reports whether path is in the polling set.
+func (w *Watcher) IsWatched(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.endpoints[path]
+	return ok
+}
+
+// Endpoints returns the watched paths in sorted order.
+func (w *Watcher) Endpoints() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return sortedKeys(w.endpoints)
+}
+
+// Latest returns the most recent change event of a watched endpoint, if it has been fetched.
+func (w *Watcher) Latest(path string) (ChangeEvent, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	endpoint, ok := w.endpoints[path]
+	if !ok || endpoint.latest == nil {
+		return ChangeEvent{}, false
+	}
+	return *endpoint.latest, true
+}
+
+// Subscribe returns a channel receiving change events and a function ending the
+// subscription. Events are dropped for subscribers whose buffer is full, so a
+// slow consumer can't stall polling.
+func (w *Watcher) Subscribe(buffer int) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, buffer)
+	w.mu.Lock()
+	w.subs[ch] = struct{}{}
+	w.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.subs, ch)
+			w.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// SetAdaptiveInterval lets Run adjust the polling interval between min and max
+// after every round: it doubles when rate-limited responses outnumber changes,
+// grows by a quarter when most endpoints are unchanged, and halves when most
+// changed. A zero max turns adaptation off again.
+func (w *Watcher) SetAdaptiveInterval(minInterval, maxInterval time.Duration) {
+	if maxInterval != 0 && (minInterval <= 0 || maxInterval < minInterval) {
+		w.proxy.logger.Warn("Invalid adaptive interval bounds provided", slog.Duration("min", minInterval), slog.Duration("max", maxInterval))
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.minInterval, w.maxInterval = minInterval, maxInterval
+	if maxInterval != 0 {
+		w.interval = min(max(w.interval, minInterval), maxInterval)
+	}
+}
+
+// Interval returns the current polling interval.
+func (w *Watcher) Interval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interval
+}
+
+// Run polls all watched endpoints every interval until ctx is done. With a
+// state store, a failure to load the state is logged and polling starts
+// afresh.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := w.LoadState(ctx); err != nil {
+		w.proxy.log(ctx, slog.LevelWarn, "Failed to load watcher state", slog.String("error", err.Error()))
+	}
+	for {
+		w.adapt(w.poll(ctx))
+		w.saveIfDirty(ctx)
+		if err := w.proxy.sleep(ctx, w.Interval()); err != nil {
+			return err
+		}
+	}
+}
+
+// pollResult counts the outcomes of one polling round.
+type pollResult struct {
+	changed, unchanged, rateLimited int
+}
+
+// adapt adjusts the interval to the outcome of a round when adaptation is on.
+func (w *Watcher) adapt(result pollResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.maxInterval == 0 {
+		return
+	}
+	interval := w.interval
+	switch {
+	case result.rateLimited > 0 && result.rateLimited >= result.changed:
+		interval *= 2
+	case result.changed > result.unchanged:
+		interval /= 2
+	case result.unchanged > 0:
+		interval += interval / 4
+	default:
+		return
+	}
+	interval = min(max(interval, w.minInterval), w.maxInterval)
+	if interval != w.interval {
+		w.proxy.logger.Debug("Adjusted polling interval", slog.Duration("interval", interval))
+		w.interval = interval
+	}
+}
+
+// Poll checks every watched endpoint once.
+func (w *Watcher) Poll(ctx context.Context) {
+	w.poll(ctx)
+	w.saveIfDirty(ctx)
+}
+
+func (w *Watcher) poll(ctx context.Context) pollResult {
+	w.mu.Lock()
+	endpoints := make([]*watchedEndpoint, 0, len(w.endpoints))
+	for _, path := range sortedKeys(w.endpoints) {
+		endpoints = append(endpoints, w.endpoints[path])
+	}
+	w.mu.Unlock()
+
+	var result pollResult
+	for _, endpoint := range endpoints {
+		if ctx.Err() != nil {
+			return result
+		}
+		changed, err := w.pollEndpoint(ctx, endpoint)
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests:
+			result.rateLimited++
+		case err != nil:
+		case changed:
+			result.changed++
+		default:
+			result.unchanged++
+		}
+		if err != nil {
+			w.proxy.log(ctx, slog.LevelWarn, "Failed to poll watched endpoint", slog.String("url", endpoint.path), slog.String("error", err.Error()))
+		}
+	}
+	return result
+}
+
+// pollEndpoint fetches an endpoint and reports whether its content changed.
+func (w *Watcher) pollEndpoint(ctx context.Context, endpoint *watchedEndpoint) (bool, error) {
+	w.mu.Lock()
+	etag := endpoint.etag
+	w.mu.Unlock()
+
+	var headers map[string]string
+	if etag != "" {
+		headers = map[string]string{"If-None-Match": etag}
+	}
+	resp, err := w.proxy.GetContext(ctx, endpoint.path, endpoint.params, headers, w.timeout, NoCache())
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	w.mu.Lock()
+	etag = resp.Header.Get("ETag")
+	changed := hash != endpoint.hash
+	if changed || etag != endpoint.etag {
+		w.dirty[endpoint.path] = struct{}{}
+	}
+	endpoint.etag, endpoint.hash = etag, hash
+	w.mu.Unlock()
+
+	if !changed {
+		return false, nil
+	}
+	event := ChangeEvent{
+		Endpoint: endpoint.path,
+		Time:     w.proxy.clock.Now(),
+		Hash:     hash,
+		Data:     body,
+	}
+	w.mu.Lock()
+	endpoint.latest = &event
+	w.mu.Unlock()
+	w.publish(event)
+	return true, nil
+}
+
+// RunSink writes the records of every change event to sink, flushing after
+// each event, until ctx is done. Failures are logged and do not stop the sink.
+func (w *Watcher) RunSink(ctx context.Context, sink Sink) error {
+	events, unsubscribe := w.Subscribe(64)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := w.writeEvent(ctx, sink, event); err != nil {
+				w.proxy.log(ctx, slog.LevelError, "Failed to write change event", slog.String("url", event.Endpoint), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (w *Watcher) writeEvent(ctx context.Context, sink Sink, event ChangeEvent) error {
+	batch, err := eventBatch(event)
+	if err != nil {
+		return err
+	}
+	if err := sink.Write(ctx, batch); err != nil {
+		return err
+	}
+	return sink.Flush(ctx)
+}
+
+func (w *Watcher) publish(event ChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}